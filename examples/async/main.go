@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/tendant/simple-process/pkg/adapters"
 	busadapter "github.com/tendant/simple-process/pkg/adapters/bus"
 	metadataadapter "github.com/tendant/simple-process/pkg/adapters/metadata"
 	"github.com/tendant/simple-process/pkg/adapters/storage"
@@ -47,46 +48,35 @@ func runDemo() (map[string]interface{}, []contracts.Artifact, error) {
 		defer wg.Done()
 		syncRunner := runner.NewSyncRunner()
 
-		for {
-			select {
-			case <-ctx.Done():
-				done <- ctx.Err()
-				return
-			case job, ok := <-bus.Subscribe():
-				if !ok {
-					return
-				}
-
-				handler, found := registry[job.UoW]
-				if !found {
-					done <- fmt.Errorf("no handler registered for %s", job.UoW)
-					return
-				}
-
-				result, err := syncRunner.Run(ctx, handler, job)
-				if err != nil {
-					done <- err
-					return
-				}
-				if result == nil {
-					done <- errors.New("runner returned nil result")
-					return
-				}
-
-				if err := metadata.UpdateFileAttributes(ctx, result.FileID, result.AttributesPatch); err != nil {
-					done <- err
-					return
-				}
-				for _, artifact := range result.Artifacts {
-					if err := metadata.CreateArtifact(ctx, result.FileID, artifact); err != nil {
-						done <- err
-						return
-					}
-				}
-
-				done <- nil
-				return
+		// The example processes a single job, so stop consuming after the first delivery.
+		subCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		err := bus.Subscribe(subCtx, busadapter.DefaultTopic, "workers", func(ctx context.Context, msg adapters.Message) error {
+			defer stop()
+			job := msg.Job()
+
+			handler, found := registry[job.UoW]
+			if !found {
+				done <- fmt.Errorf("no handler registered for %s", job.UoW)
+				return nil
 			}
+
+			result, err := syncRunner.Run(ctx, handler, job)
+			if err != nil {
+				done <- err
+				return nil
+			}
+			if result == nil {
+				done <- errors.New("runner returned nil result")
+				return nil
+			}
+
+			_, err = metadataadapter.ApplyResult(ctx, metadata, *result, metadataadapter.ApplyOptions{})
+			done <- err
+			return nil
+		})
+		if err != nil {
+			done <- err
 		}
 	}()
 
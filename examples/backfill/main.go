@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	busadapter "github.com/tendant/simple-process/pkg/adapters/bus"
+	metadataadapter "github.com/tendant/simple-process/pkg/adapters/metadata"
+	"github.com/tendant/simple-process/pkg/backfill"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/runner"
+)
+
+// wordsUoW counts the words of a file's name. Version 2 started lower-casing them.
+type wordsUoW struct{}
+
+func (wordsUoW) Version() string { return "2" }
+
+func (wordsUoW) Process(ctx context.Context, job contracts.Job) (*contracts.Result, error) {
+	name, _ := job.File.Attributes["name"].(string)
+	return &contracts.Result{
+		JobID:           job.JobID,
+		UoW:             job.UoW,
+		FileID:          job.File.ID,
+		AttributesPatch: map[string]interface{}{"words": strings.Fields(strings.ToLower(name))},
+	}, nil
+}
+
+func main() {
+	rate := flag.Float64("rate", 50, "jobs enqueued per second")
+	batch := flag.Int("batch", 2, "files scanned per page")
+	flag.Parse()
+
+	progress, versions, err := runDemo(*rate, *batch)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("backfill %s: scanned %d, enqueued %d\n", progress.Name, progress.Scanned, progress.Enqueued)
+	fmt.Printf("words versions: %v\n", versions)
+}
+
+func runDemo(rate float64, batch int) (backfill.Progress, map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	metadata := metadataadapter.NewMemoryMetadata()
+	bus := busadapter.NewMemoryBus(8)
+	defer bus.Close()
+
+	// Three files were processed by version 1 of the UoW and one never was.
+	for i, name := range []string{"Quarterly Report", "Team Photo", "Invoice March", "Draft Notes"} {
+		result := contracts.Result{JobID: "seed", UoW: "words", FileID: fmt.Sprintf("file-%d", i+1), UoWVersion: "1",
+			AttributesPatch: map[string]interface{}{"name": name}}
+		if i == 3 {
+			result.UoW, result.UoWVersion = "upload", ""
+		}
+		if _, err := metadataadapter.ApplyResult(ctx, metadata, result, metadataadapter.ApplyOptions{}); err != nil {
+			return backfill.Progress{}, nil, err
+		}
+	}
+
+	// Workers run the current version and record it with the result.
+	var wg sync.WaitGroup
+	workerCtx, stopWorker := context.WithCancel(ctx)
+	defer stopWorker()
+	go bus.Subscribe(workerCtx, busadapter.DefaultTopic, "workers", func(ctx context.Context, msg adapters.Message) error {
+		result, err := runner.NewSyncRunner().Run(ctx, wordsUoW{}, msg.Job())
+		if err != nil {
+			return err
+		}
+		if _, err := metadataadapter.ApplyResult(ctx, metadata, *result, metadataadapter.ApplyOptions{}); err != nil {
+			return err
+		}
+		// Failed jobs are redelivered, so only count the ones that went through.
+		wg.Done()
+		return nil
+	})
+
+	b, err := backfill.New(metadata, countingBus{bus, &wg}, backfill.NewMemoryStore(), backfill.Config{
+		UoW:       "words",
+		Version:   wordsUoW{}.Version(),
+		Rate:      rate,
+		BatchSize: batch,
+	})
+	if err != nil {
+		return backfill.Progress{}, nil, err
+	}
+	progress, err := b.Run(ctx)
+	if err != nil {
+		return progress, nil, err
+	}
+	wg.Wait()
+
+	versions := make(map[string]string)
+	files, err := metadata.ScanFiles(ctx, "", 100)
+	if err != nil {
+		return progress, nil, err
+	}
+	for _, file := range files {
+		versions[file.ID], _ = metadataadapter.ProcessedVersion(file.Attributes, "words")
+	}
+	return progress, versions, nil
+}
+
+// countingBus lets the demo wait for every enqueued job to be processed.
+type countingBus struct {
+	adapters.Bus
+	wg *sync.WaitGroup
+}
+
+func (b countingBus) Publish(ctx context.Context, job contracts.Job) error {
+	b.wg.Add(1)
+	if err := b.Bus.Publish(ctx, job); err != nil {
+		b.wg.Done()
+		return err
+	}
+	return nil
+}
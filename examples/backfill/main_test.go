@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRunDemoBackfillsOldVersions(t *testing.T) {
+	progress, versions, err := runDemo(0, 2)
+	if err != nil {
+		t.Fatalf("runDemo returned error: %v", err)
+	}
+
+	if !progress.Done || progress.Scanned != 4 || progress.Enqueued != 4 {
+		t.Fatalf("unexpected progress: %+v", progress)
+	}
+	for id, version := range versions {
+		if version != "2" {
+			t.Fatalf("expected %s to be processed by version 2, got %q", id, version)
+		}
+	}
+	if len(versions) != 4 {
+		t.Fatalf("expected 4 files, got %v", versions)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	busadapter "github.com/tendant/simple-process/pkg/adapters/bus"
+	metadataadapter "github.com/tendant/simple-process/pkg/adapters/metadata"
+	"github.com/tendant/simple-process/pkg/adapters/storage"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/pipeline"
+	"github.com/tendant/simple-process/pkg/uow"
+	"github.com/tendant/simple-process/uows/go/hash"
+)
+
+//go:embed pipeline.yaml
+var defaultSpec []byte
+
+// announceUoW stands in for a remote worker that reports processed files.
+type announceUoW struct{}
+
+func (announceUoW) Process(ctx context.Context, job contracts.Job) (*contracts.Result, error) {
+	return &contracts.Result{
+		JobID:           job.JobID,
+		UoW:             job.UoW,
+		FileID:          job.File.ID,
+		AttributesPatch: map[string]interface{}{"announced_to": job.Hints["channel"]},
+	}, nil
+}
+
+func main() {
+	specPath := flag.String("spec", "", "pipeline spec to load instead of the embedded pipeline.yaml")
+	flag.Parse()
+
+	spec, err := loadSpec(*specPath)
+	if err != nil {
+		panic(err)
+	}
+	run, err := runDemo(spec)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("pipeline %s %s: %+v\n", run.Pipeline, run.Status, run.File.Attributes)
+}
+
+func loadSpec(path string) (*pipeline.Spec, error) {
+	if path != "" {
+		return pipeline.LoadSpecFile(path)
+	}
+	return pipeline.LoadSpec(bytes.NewReader(defaultSpec))
+}
+
+func runDemo(spec *pipeline.Spec) (pipeline.Run, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	storageAdapter := storage.NewInMemoryStorage()
+	metadata := metadataadapter.NewMemoryMetadata()
+	bus := busadapter.NewMemoryBus(8)
+	defer bus.Close()
+
+	registry := uow.NewRegistry()
+	if err := registry.Register("hash", &hash.HashUoW{Storage: storageAdapter}); err != nil {
+		return pipeline.Run{}, err
+	}
+	if err := registry.Register("announce", announceUoW{}); err != nil {
+		return pipeline.Run{}, err
+	}
+
+	p, err := spec.Build(registry)
+	if err != nil {
+		return pipeline.Run{}, err
+	}
+	engine, err := pipeline.NewEngine(p, bus, pipeline.WithRegistry(registry), pipeline.WithMetadata(metadata))
+	if err != nil {
+		return pipeline.Run{}, err
+	}
+
+	// Async steps are picked up by a worker, which persists the result and reports back.
+	workerCtx, stopWorker := context.WithCancel(ctx)
+	defer stopWorker()
+	go bus.Subscribe(workerCtx, busadapter.DefaultTopic, "workers", func(ctx context.Context, msg adapters.Message) error {
+		job := msg.Job()
+		handler, ok := registry.Lookup(job.UoW)
+		if !ok {
+			_, err := engine.HandleFailure(ctx, job.File.ID, job.JobID, fmt.Errorf("no handler registered for %s", job.UoW))
+			return err
+		}
+		result, err := handler.Process(ctx, job)
+		if err != nil {
+			return err
+		}
+		if _, err := metadataadapter.ApplyResult(ctx, metadata, *result, metadataadapter.ApplyOptions{}); err != nil {
+			return err
+		}
+		_, err = engine.HandleResult(ctx, *result)
+		return err
+	})
+
+	if err := storageAdapter.Put(ctx, "report.txt", strings.NewReader("hello pipeline")); err != nil {
+		return pipeline.Run{}, err
+	}
+	file := contracts.File{ID: "file-1", Blob: contracts.Blob{Location: "report.txt"}}
+	if _, err := engine.Start(ctx, file); err != nil {
+		return pipeline.Run{}, err
+	}
+
+	for {
+		run, err := engine.Status(file.ID)
+		if err != nil || run.Done() {
+			return run, err
+		}
+		select {
+		case <-ctx.Done():
+			return run, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/tendant/simple-process/pkg/pipeline"
+)
+
+func TestRunDemoCompletesPipeline(t *testing.T) {
+	spec, err := loadSpec("pipeline.yaml")
+	if err != nil {
+		t.Fatalf("loadSpec returned error: %v", err)
+	}
+	run, err := runDemo(spec)
+	if err != nil {
+		t.Fatalf("runDemo returned error: %v", err)
+	}
+
+	if run.Status != pipeline.RunSucceeded {
+		t.Fatalf("expected pipeline to succeed, got %+v", run)
+	}
+	if _, ok := run.File.Attributes["sha256"].(string); !ok {
+		t.Fatalf("expected sha256 attribute, got %#v", run.File.Attributes)
+	}
+	if run.File.Attributes["announced_to"] != "#uploads" {
+		t.Fatalf("expected announce step to run, got %#v", run.File.Attributes)
+	}
+}
@@ -0,0 +1,62 @@
+//go:build postgres && integration
+
+package sqldialect
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func TestPostgresDialectAgainstServer(t *testing.T) {
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		url = "postgres://postgres@localhost:5432/postgres?sslmode=disable"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		t.Skipf("skipping: unable to connect to postgres (%v)", err)
+	}
+
+	// A temporary table lives on one connection, so pin it.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("conn: %v", err)
+	}
+	defer conn.Close()
+
+	d := Postgres
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TEMPORARY TABLE sp_dialect_test (id %s, doc %s NOT NULL, at %s NOT NULL)`, d.SerialType(), d.JSONType(), d.TimeType())); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if _, err := conn.ExecContext(ctx, d.Rebind(`INSERT INTO sp_dialect_test (doc, at) VALUES (CAST(? AS JSONB), ?)`), `{"a": 1}`, at); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	// Placeholders inside string literals are left alone.
+	var (
+		id    int64
+		label string
+		got   time.Time
+	)
+	err = conn.QueryRowContext(ctx, d.Rebind(`SELECT id, '?' || CAST(doc -> 'a' AS TEXT), at FROM sp_dialect_test WHERE doc -> 'a' = CAST(? AS JSONB)`), "1").Scan(&id, &label, &got)
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if id != 1 || label != "?1" || !got.Equal(at) {
+		t.Fatalf("unexpected row: %d %q %v", id, label, got)
+	}
+}
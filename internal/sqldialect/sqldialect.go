@@ -0,0 +1,74 @@
+// Package sqldialect papers over the few SQL differences between the SQLite and
+// Postgres backends used by the database/sql adapters.
+package sqldialect
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies the SQL flavour spoken by a *sql.DB.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// Validate reports whether the dialect is supported.
+func (d Dialect) Validate() error {
+	switch d {
+	case SQLite, Postgres:
+		return nil
+	default:
+		return fmt.Errorf("unsupported sql dialect: %q", d)
+	}
+}
+
+// Rebind rewrites "?" placeholders into the dialect's positional form.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// JSONType is the column type used for JSON documents.
+func (d Dialect) JSONType() string {
+	if d == Postgres {
+		return "JSONB"
+	}
+	return "TEXT"
+}
+
+// TimeType is the column type used for timestamps.
+func (d Dialect) TimeType() string {
+	if d == Postgres {
+		return "TIMESTAMPTZ"
+	}
+	return "TIMESTAMP"
+}
+
+// SerialType is the column definition for an auto-incrementing integer primary key.
+func (d Dialect) SerialType() string {
+	if d == Postgres {
+		return "BIGSERIAL PRIMARY KEY"
+	}
+	return "INTEGER PRIMARY KEY AUTOINCREMENT"
+}
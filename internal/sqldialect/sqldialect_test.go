@@ -0,0 +1,14 @@
+package sqldialect
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	query := `SELECT * FROM t WHERE a = ? AND b = '?' AND c = ?`
+
+	if got := SQLite.Rebind(query); got != query {
+		t.Fatalf("sqlite rebind changed query: %s", got)
+	}
+	if got, want := Postgres.Rebind(query), `SELECT * FROM t WHERE a = $1 AND b = '?' AND c = $2`; got != want {
+		t.Fatalf("postgres rebind = %s, want %s", got, want)
+	}
+}
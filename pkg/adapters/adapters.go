@@ -3,6 +3,7 @@ package adapters
 import (
 	"context"
 	"io"
+	"time"
 
 	"github.com/tendant/simple-process/pkg/contracts"
 )
@@ -15,22 +16,215 @@ type Storage interface {
 	Put(ctx context.Context, location string, reader io.Reader) error
 	// PresignGet generates a presigned URL for getting a blob.
 	PresignGet(ctx context.Context, location string) (string, error)
+	// PresignPut generates a presigned URL that accepts an HTTP PUT of the blob content.
+	PresignPut(ctx context.Context, location string) (string, error)
+}
+
+// BlobInfo describes a stored blob without reading its content.
+type BlobInfo struct {
+	Size            int64
+	ETag            string
+	ContentType     string
+	ContentEncoding string
+}
+
+// BlobInfoStorage is implemented by Storage backends that persist blob metadata alongside the content.
+type BlobInfoStorage interface {
+	Storage
+	// PutWithInfo uploads a blob and records the supplied metadata with it.
+	PutWithInfo(ctx context.Context, location string, reader io.Reader, info BlobInfo) error
+	// Stat returns the metadata recorded for the blob at location.
+	Stat(ctx context.Context, location string) (BlobInfo, error)
+}
+
+// ExpiringPresigner is implemented by Storage backends whose presigned URLs can be
+// issued with a caller-chosen lifetime instead of the backend default.
+type ExpiringPresigner interface {
+	// PresignGetWithExpiry generates a presigned download URL valid for ttl.
+	PresignGetWithExpiry(ctx context.Context, location string, ttl time.Duration) (string, error)
+}
+
+// UploadPresigner is implemented by Storage backends that can grant write access
+// to every location under a prefix, letting remote workers upload artifacts
+// without holding storage credentials.
+type UploadPresigner interface {
+	// PresignUpload returns form upload instructions scoped to the location prefix.
+	PresignUpload(ctx context.Context, prefix string) (contracts.ArtifactUpload, error)
+}
+
+// MultipartUpload describes an in-progress multipart upload and the presigned URL for each part.
+type MultipartUpload struct {
+	Location string
+	UploadID string
+	PartURLs []string
+}
+
+// CompletedPart identifies a part uploaded through a presigned multipart URL.
+type CompletedPart struct {
+	Number int32
+	ETag   string
+}
+
+// MultipartPresigner is implemented by Storage backends that support presigned multipart uploads.
+type MultipartPresigner interface {
+	// PresignMultipart starts a multipart upload and presigns a PUT URL for each part.
+	PresignMultipart(ctx context.Context, location string, parts int) (MultipartUpload, error)
+	// CompleteMultipart assembles the uploaded parts into the final blob.
+	CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []CompletedPart) error
+	// AbortMultipart discards an unfinished multipart upload.
+	AbortMultipart(ctx context.Context, upload MultipartUpload) error
 }
 
 // Metadata provides an interface for interacting with file and artifact metadata.
 type Metadata interface {
-	// UpdateFileAttributes updates the attributes of a file.
+	// UpdateFileAttributes atomically applies an RFC 7396 JSON Merge Patch to the file's attributes:
+	// nested objects are merged and null values delete keys.
 	UpdateFileAttributes(ctx context.Context, fileID string, attributesPatch map[string]interface{}) error
-	// CreateArtifact creates a new artifact record.
+	// CreateArtifact records an artifact, replacing any artifact of the file with the same identity.
 	CreateArtifact(ctx context.Context, fileID string, artifact contracts.Artifact) error
 }
 
+// VersionedMetadata supports optimistic concurrency for file attribute updates.
+// Every successful update increments the file's revision; files without attributes are at revision 0.
+type VersionedMetadata interface {
+	// GetFileRevision returns the file's attributes together with their current revision.
+	GetFileRevision(ctx context.Context, fileID string) (map[string]interface{}, int64, error)
+	// UpdateFileAttributesIf applies the merge patch only if the file is still at expectedRevision.
+	// It returns the new revision, or ErrConflict when another writer got there first.
+	UpdateFileAttributesIf(ctx context.Context, fileID string, expectedRevision int64, attributesPatch map[string]interface{}) (int64, error)
+}
+
+// ArtifactManager is implemented by metadata backends that can retire artifacts.
+type ArtifactManager interface {
+	// DeleteArtifact removes the artifact sharing artifact's identity (UoW, Kind and Key),
+	// returning ErrNotFound when there is none.
+	DeleteArtifact(ctx context.Context, fileID string, artifact contracts.Artifact) error
+	// SupersedeArtifacts removes the file's artifacts produced by uow at a version other than
+	// version and returns them, so callers can delete the underlying blobs.
+	SupersedeArtifacts(ctx context.Context, fileID, uow, version string) ([]contracts.Artifact, error)
+}
+
+// AttributeAuditor is implemented by metadata backends that track who wrote each attribute.
+// Writers attach their identity with ContextWithProvenance before updating attributes.
+type AttributeAuditor interface {
+	// AttributeProvenance returns the provenance of the last write to each current attribute key.
+	AttributeProvenance(ctx context.Context, fileID string) (map[string]contracts.Provenance, error)
+	// AttributeHistory returns every recorded attribute change for the file, oldest first.
+	AttributeHistory(ctx context.Context, fileID string) ([]contracts.AttributeChange, error)
+}
+
+type provenanceKey struct{}
+
+// ContextWithProvenance attaches the writer's identity to ctx for AttributeAuditor backends.
+func ContextWithProvenance(ctx context.Context, p contracts.Provenance) context.Context {
+	return context.WithValue(ctx, provenanceKey{}, p)
+}
+
+// ProvenanceFromContext returns the provenance attached to ctx, stamping the current time if unset.
+func ProvenanceFromContext(ctx context.Context) contracts.Provenance {
+	p, _ := ctx.Value(provenanceKey{}).(contracts.Provenance)
+	if p.Timestamp.IsZero() {
+		p.Timestamp = time.Now().UTC()
+	}
+	return p
+}
+
+// PredicateOp is the comparison applied by an AttributePredicate.
+type PredicateOp string
+
+const (
+	// OpExists matches files that have the attribute key, whatever its value.
+	OpExists PredicateOp = "exists"
+	// OpEquals matches files whose attribute equals Value after JSON normalisation.
+	OpEquals PredicateOp = "equals"
+)
+
+// AttributePredicate matches files by a single top-level attribute.
+type AttributePredicate struct {
+	Key   string
+	Op    PredicateOp
+	Value interface{}
+}
+
+// AttributeExists matches files that have the attribute key.
+func AttributeExists(key string) AttributePredicate {
+	return AttributePredicate{Key: key, Op: OpExists}
+}
+
+// AttributeEquals matches files whose attribute key equals value.
+func AttributeEquals(key string, value interface{}) AttributePredicate {
+	return AttributePredicate{Key: key, Op: OpEquals, Value: value}
+}
+
+// MetadataReader provides read and query access to stored file metadata.
+type MetadataReader interface {
+	// GetFileAttributes returns the attributes of a file or ErrNotFound.
+	GetFileAttributes(ctx context.Context, fileID string) (map[string]interface{}, error)
+	// ListArtifacts returns the file's artifacts, optionally filtered by kind.
+	ListArtifacts(ctx context.Context, fileID string, kind string) ([]contracts.Artifact, error)
+	// FindFiles returns the IDs of files matching every predicate, in ascending order.
+	FindFiles(ctx context.Context, predicates ...AttributePredicate) ([]string, error)
+}
+
+// FileRecord is a file's stored attributes, as returned by FileScanner.
+type FileRecord struct {
+	ID         string
+	Attributes map[string]interface{}
+}
+
+// FileScanner pages through every file with stored metadata, e.g. to backfill them.
+type FileScanner interface {
+	// ScanFiles returns up to limit files whose ID sorts after the given one, in
+	// ascending ID order. Pass the last ID of a page to fetch the next.
+	ScanFiles(ctx context.Context, after string, limit int) ([]FileRecord, error)
+}
+
 // Bus provides an interface for publishing jobs to a message bus.
 type Bus interface {
 	// Publish sends a job to the bus.
 	Publish(ctx context.Context, job contracts.Job) error
 }
 
+// DelayingBus is implemented by buses that can hold a job until a later time
+// instead of delivering it straight away.
+type DelayingBus interface {
+	Bus
+	// PublishAt sends a job that must not be delivered before at.
+	PublishAt(ctx context.Context, job contracts.Job, at time.Time) error
+}
+
+// Message is a job delivered by a Subscriber. Ack confirms it was processed;
+// Nack asks the transport to redeliver it later.
+type Message interface {
+	// Job returns the delivered job.
+	Job() contracts.Job
+	// Attempt is 1 on first delivery and grows with each redelivery, when the transport tracks it.
+	Attempt() int
+	// Ack settles the message as processed.
+	Ack(ctx context.Context) error
+	// Nack settles the message as failed so it is redelivered.
+	Nack(ctx context.Context) error
+}
+
+// ExtendableMessage is implemented by messages that the transport hides from other
+// consumers only for a limited time. Extend renews that lease, e.g. while the
+// message waits in a worker.Pool, and fails once the lease has been lost.
+type ExtendableMessage interface {
+	Message
+	Extend(ctx context.Context) error
+}
+
+// MessageHandler processes a delivered message. Messages the handler leaves
+// unsettled are acked when it returns nil and nacked when it returns an error.
+type MessageHandler func(ctx context.Context, msg Message) error
+
+// Subscriber consumes jobs from a bus. Subscribers sharing a group split a topic's
+// messages between them, while every group receives each message.
+type Subscriber interface {
+	// Subscribe delivers messages from topic to handler until ctx is cancelled or the bus closes.
+	Subscribe(ctx context.Context, topic, group string, handler MessageHandler) error
+}
+
 // Logger provides a structured logging interface.
 type Logger interface {
 	// Info logs an informational message.
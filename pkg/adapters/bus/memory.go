@@ -2,39 +2,268 @@ package bus
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"time"
 
+	"github.com/tendant/simple-process/pkg/adapters"
 	"github.com/tendant/simple-process/pkg/contracts"
 )
 
-// MemoryBus is an in-memory implementation of adapters.Bus for examples and tests.
+// DefaultTopic is the topic MemoryBus.Publish uses unless a router is configured.
+const DefaultTopic = "jobs"
+
+// MemoryBus is an in-memory implementation of adapters.Bus and adapters.Subscriber
+// for examples and tests. Each consumer group on a topic receives every message;
+// subscribers within a group compete for them. Nacked messages are redelivered
+// after a delay until they reach the attempt limit.
 type MemoryBus struct {
-	jobs chan contracts.Job
+	buffer      int
+	route       func(contracts.Job) string
+	maxAttempts int
+	retryDelay  time.Duration
+	onDrop      func(contracts.Job, int)
+
+	mu      sync.Mutex
+	changed chan struct{}
+	closed  bool
+	topics  map[string]*memoryTopic
+}
+
+type memoryTopic struct {
+	// backlog holds messages published before any group subscribed; the first
+	// group to subscribe takes them over.
+	backlog []memoryDelivery
+	groups  map[string]*[]memoryDelivery
+}
+
+type memoryDelivery struct {
+	job     contracts.Job
+	attempt int
+}
+
+// MemoryOption customises a MemoryBus.
+type MemoryOption func(*MemoryBus)
+
+// WithTopicRouter chooses the topic Publish sends each job to, e.g. by job.UoW.
+func WithTopicRouter(route func(contracts.Job) string) MemoryOption {
+	return func(b *MemoryBus) { b.route = route }
+}
+
+// WithMaxAttempts drops a message once it has been nacked on its nth attempt;
+// defaults to 5.
+func WithMaxAttempts(n int) MemoryOption {
+	return func(b *MemoryBus) { b.maxAttempts = n }
+}
+
+// WithRedeliveryDelay holds a nacked message for d before it is delivered again;
+// defaults to no delay.
+func WithRedeliveryDelay(d time.Duration) MemoryOption {
+	return func(b *MemoryBus) { b.retryDelay = d }
+}
+
+// WithOnDrop calls fn with every message the bus drops, either past the attempt
+// limit or nacked after Close, and the number of attempts it had. Use it to log
+// or dead-letter those jobs.
+func WithOnDrop(fn func(job contracts.Job, attempts int)) MemoryOption {
+	return func(b *MemoryBus) { b.onDrop = fn }
 }
 
-// NewMemoryBus creates a MemoryBus with the provided channel buffer size.
-func NewMemoryBus(buffer int) *MemoryBus {
+// NewMemoryBus creates a MemoryBus. buffer bounds the undelivered messages per
+// consumer group; Publish blocks while a group is full.
+func NewMemoryBus(buffer int, opts ...MemoryOption) *MemoryBus {
 	if buffer <= 0 {
 		buffer = 1
 	}
-	return &MemoryBus{jobs: make(chan contracts.Job, buffer)}
+	b := &MemoryBus{
+		buffer:      buffer,
+		route:       func(contracts.Job) string { return DefaultTopic },
+		maxAttempts: 5,
+		changed:     make(chan struct{}),
+		topics:      make(map[string]*memoryTopic),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.maxAttempts <= 0 {
+		b.maxAttempts = 5
+	}
+	return b
 }
 
-// Publish enqueues the job onto the in-memory buffer or returns ctx error on cancellation.
+// Publish sends the job to the topic chosen by the router.
 func (b *MemoryBus) Publish(ctx context.Context, job contracts.Job) error {
+	return b.PublishTo(ctx, b.route(job), job)
+}
+
+// PublishTo enqueues the job for every consumer group of topic, waiting while a
+// group's buffer is full. It returns adapters.ErrClosed once the bus is closed.
+func (b *MemoryBus) PublishTo(ctx context.Context, topic string, job contracts.Job) error {
+	b.mu.Lock()
+	for {
+		if b.closed {
+			b.mu.Unlock()
+			return adapters.ErrClosed
+		}
+		t := b.topicLocked(topic)
+		if !t.fullLocked(b.buffer) {
+			d := memoryDelivery{job: job, attempt: 1}
+			if len(t.groups) == 0 {
+				t.backlog = append(t.backlog, d)
+			}
+			for _, queue := range t.groups {
+				*queue = append(*queue, d)
+			}
+			b.broadcastLocked()
+			b.mu.Unlock()
+			return nil
+		}
+		if err := b.waitLocked(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Subscribe delivers topic's messages for group to handler until ctx is cancelled,
+// or until the bus is closed and the group's queue is drained.
+func (b *MemoryBus) Subscribe(ctx context.Context, topic, group string, handler adapters.MessageHandler) error {
+	if topic == "" {
+		return errors.New("topic is required")
+	}
+	if group == "" {
+		return errors.New("group is required")
+	}
+	if handler == nil {
+		return errors.New("handler is required")
+	}
+
+	b.mu.Lock()
+	queue := b.groupLocked(topic, group)
+	for {
+		if len(*queue) == 0 {
+			if b.closed {
+				b.mu.Unlock()
+				return nil
+			}
+			if err := b.waitLocked(ctx); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		d := (*queue)[0]
+		*queue = (*queue)[1:]
+		b.broadcastLocked()
+		b.mu.Unlock()
+
+		msg := NewMessage(d.job, d.attempt, nil, func(context.Context) error {
+			b.redeliver(queue, memoryDelivery{job: d.job, attempt: d.attempt + 1})
+			return nil
+		})
+		Dispatch(ctx, msg, handler)
+
+		b.mu.Lock()
+	}
+}
+
+// Close stops the bus: further publishes fail with adapters.ErrClosed and
+// subscribers return once their queues are drained. It is safe to call more than once.
+func (b *MemoryBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		b.broadcastLocked()
+	}
+}
+
+// redeliver queues a nacked message again after the redelivery delay. Messages
+// past the attempt limit, or nacked after Close, are dropped and passed to WithOnDrop.
+func (b *MemoryBus) redeliver(queue *[]memoryDelivery, d memoryDelivery) {
+	if d.attempt > b.maxAttempts {
+		b.drop(d)
+		return
+	}
+	requeue := func() {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			b.drop(d)
+			return
+		}
+		*queue = append(*queue, d)
+		b.broadcastLocked()
+		b.mu.Unlock()
+	}
+	if b.retryDelay <= 0 {
+		requeue()
+		return
+	}
+	time.AfterFunc(b.retryDelay, requeue)
+}
+
+func (b *MemoryBus) drop(d memoryDelivery) {
+	if b.onDrop != nil {
+		b.onDrop(d.job, d.attempt-1)
+	}
+}
+
+func (b *MemoryBus) topicLocked(name string) *memoryTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &memoryTopic{groups: make(map[string]*[]memoryDelivery)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+func (b *MemoryBus) groupLocked(topic, group string) *[]memoryDelivery {
+	t := b.topicLocked(topic)
+	queue, ok := t.groups[group]
+	if !ok {
+		queue = new([]memoryDelivery)
+		if len(t.groups) == 0 {
+			*queue, t.backlog = t.backlog, nil
+		}
+		t.groups[group] = queue
+		b.broadcastLocked()
+	}
+	return queue
+}
+
+func (t *memoryTopic) fullLocked(buffer int) bool {
+	if len(t.groups) == 0 {
+		return len(t.backlog) >= buffer
+	}
+	for _, queue := range t.groups {
+		if len(*queue) >= buffer {
+			return true
+		}
+	}
+	return false
+}
+
+// waitLocked releases the lock until the bus state changes or ctx is done. On
+// success the lock is held again; on error it stays released.
+func (b *MemoryBus) waitLocked(ctx context.Context) error {
+	changed := b.changed
+	b.mu.Unlock()
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
-	case b.jobs <- job:
+	case <-changed:
+		b.mu.Lock()
 		return nil
 	}
 }
 
-// Subscribe exposes a read-only channel of published jobs for consumer goroutines.
-func (b *MemoryBus) Subscribe() <-chan contracts.Job {
-	return b.jobs
+func (b *MemoryBus) broadcastLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
 }
 
-// Close closes the underlying channel, signalling consumers to stop.
-func (b *MemoryBus) Close() {
-	close(b.jobs)
-}
+var (
+	_ adapters.Bus        = (*MemoryBus)(nil)
+	_ adapters.Subscriber = (*MemoryBus)(nil)
+)
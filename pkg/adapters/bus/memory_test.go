@@ -0,0 +1,187 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+func TestMemoryBusFansOutToGroupsAndRedelivers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	b := NewMemoryBus(10, WithTopicRouter(func(job contracts.Job) string { return job.UoW }))
+	for i := 0; i < 4; i++ {
+		if err := b.Publish(ctx, contracts.Job{JobID: fmt.Sprint(i), UoW: "hash"}); err != nil {
+			t.Fatalf("Publish error: %v", err)
+		}
+	}
+	var (
+		mu       sync.Mutex
+		received = map[string][]string{}
+		attempts = map[string]int{}
+		wg       sync.WaitGroup
+	)
+	subscribe := func(group string, handler adapters.MessageHandler) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.Subscribe(ctx, "hash", group, handler); err != nil {
+				t.Errorf("Subscribe error: %v", err)
+			}
+		}()
+	}
+
+	record := func(group string) adapters.MessageHandler {
+		return func(_ context.Context, msg adapters.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if group == "audit" && msg.Job().JobID == "1" && msg.Attempt() == 1 {
+				return errors.New("try again")
+			}
+			received[group] = append(received[group], msg.Job().JobID)
+			attempts[msg.Job().JobID] = msg.Attempt()
+			return nil
+		}
+	}
+	// Two subscribers in one group compete for the same messages.
+	subscribe("audit", record("audit"))
+	subscribe("audit", record("audit"))
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received["audit"]) == 4
+	})
+
+	// Messages published before a group subscribed reach only the existing groups.
+	subscribe("index", record("index"))
+	waitFor(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.topics["hash"].groups) == 2
+	})
+	if err := b.Publish(ctx, contracts.Job{JobID: "4", UoW: "hash"}); err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+
+	b.Close()
+	wg.Wait()
+
+	if len(received["audit"]) != 5 || len(received["index"]) != 1 || received["index"][0] != "4" {
+		t.Fatalf("unexpected deliveries: %v", received)
+	}
+	if attempts["1"] != 2 {
+		t.Fatalf("expected the nacked message to be redelivered as attempt 2, got %d", attempts["1"])
+	}
+}
+
+func TestMemoryBusCloseDuringPublish(t *testing.T) {
+	b := NewMemoryBus(1)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := b.Publish(ctx, contracts.Job{JobID: fmt.Sprint(i)})
+			if err != nil && !errors.Is(err, adapters.ErrClosed) {
+				t.Errorf("unexpected Publish error: %v", err)
+			}
+		}(i)
+	}
+	b.Close()
+	b.Close()
+	wg.Wait()
+
+	if err := b.Publish(ctx, contracts.Job{JobID: "late"}); !errors.Is(err, adapters.ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestMemoryBusLimitsRedelivery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	dropped := make(chan int, 10)
+	b := NewMemoryBus(10, WithMaxAttempts(3), WithRedeliveryDelay(20*time.Millisecond), WithOnDrop(func(_ contracts.Job, attempts int) {
+		dropped <- attempts
+	}))
+	b.Publish(ctx, contracts.Job{JobID: "poison"})
+	b.Publish(ctx, contracts.Job{JobID: "late"})
+
+	var (
+		mu       sync.Mutex
+		attempts = map[string][]time.Time{}
+	)
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Subscribe(ctx, DefaultTopic, "workers", func(_ context.Context, msg adapters.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts[msg.Job().JobID] = append(attempts[msg.Job().JobID], time.Now())
+			return errors.New("always fails")
+		})
+	}()
+
+	// The poison message stops after its third attempt instead of looping forever.
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(attempts["poison"]) == 3
+	})
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	if n := len(attempts["poison"]); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+	if gap := attempts["poison"][1].Sub(attempts["poison"][0]); gap < 20*time.Millisecond {
+		t.Fatalf("expected redelivery to wait 20ms, waited %v", gap)
+	}
+	mu.Unlock()
+	if got := <-dropped; got != 3 {
+		t.Fatalf("expected the dropped job to report 3 attempts, got %d", got)
+	}
+
+	// A nack after Close does not put the message back, so the subscriber can drain and return.
+	var closedDrops []string
+	b2 := NewMemoryBus(10, WithOnDrop(func(job contracts.Job, _ int) { closedDrops = append(closedDrops, job.JobID) }))
+	b2.Publish(ctx, contracts.Job{JobID: "closing"})
+	var calls int
+	if err := b2.Subscribe(ctx, DefaultTopic, "workers", func(context.Context, adapters.Message) error {
+		calls++
+		b2.Close()
+		return errors.New("nack during shutdown")
+	}); err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected no redelivery after Close, got %d calls", calls)
+	}
+	if len(closedDrops) != 1 || closedDrops[0] != "closing" {
+		t.Fatalf("expected the nacked job to be reported as dropped, got %v", closedDrops)
+	}
+
+	b.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,122 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// ErrSettled is returned when a message is acked or nacked more than once.
+var ErrSettled = errors.New("message already settled")
+
+// Message is an adapters.Message backed by transport callbacks. It settles at most
+// once, so transports can rely on exactly one of ack or nack being invoked.
+type Message struct {
+	job     contracts.Job
+	attempt int
+	ack     func(context.Context) error
+	nack    func(context.Context) error
+	extend  func(context.Context) error
+
+	mu      sync.Mutex
+	settled bool
+}
+
+// NewMessage wraps a delivered job. Nil callbacks are treated as no-ops.
+func NewMessage(job contracts.Job, attempt int, ack, nack func(context.Context) error) *Message {
+	return &Message{job: job, attempt: attempt, ack: ack, nack: nack}
+}
+
+// WithExtend sets the callback renewing the transport's lease on the message.
+// Dispatch then hands the handler an adapters.ExtendableMessage.
+func (m *Message) WithExtend(extend func(context.Context) error) *Message {
+	m.extend = extend
+	return m
+}
+
+// Job returns the delivered job.
+func (m *Message) Job() contracts.Job {
+	return m.job
+}
+
+// Attempt returns the delivery attempt, starting at 1.
+func (m *Message) Attempt() int {
+	return m.attempt
+}
+
+// Ack settles the message as processed.
+func (m *Message) Ack(ctx context.Context) error {
+	return m.settle(ctx, m.ack)
+}
+
+// Nack settles the message as failed so the transport redelivers it.
+func (m *Message) Nack(ctx context.Context) error {
+	return m.settle(ctx, m.nack)
+}
+
+// Settled reports whether Ack or Nack has been called.
+func (m *Message) Settled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.settled
+}
+
+func (m *Message) settle(ctx context.Context, fn func(context.Context) error) error {
+	m.mu.Lock()
+	if m.settled {
+		m.mu.Unlock()
+		return ErrSettled
+	}
+	m.settled = true
+	m.mu.Unlock()
+
+	if fn == nil {
+		return nil
+	}
+	return fn(ctx)
+}
+
+// Dispatch runs handler and settles msg if the handler did not: it is acked when
+// the handler returns nil and nacked otherwise. The handler error is returned.
+func Dispatch(ctx context.Context, msg *Message, handler adapters.MessageHandler) error {
+	var delivered adapters.Message = msg
+	if msg.extend != nil {
+		delivered = extendableMessage{msg}
+	}
+	err := handler(ctx, delivered)
+	if msg.Settled() {
+		return err
+	}
+
+	settle := msg.Ack
+	if err != nil {
+		settle = msg.Nack
+	}
+	// Settle even if ctx was cancelled while the handler ran, so work finished during
+	// shutdown is not redelivered. A handler that settles from another goroutine may
+	// race with this fallback; that is fine.
+	if settleErr := settle(context.WithoutCancel(ctx)); settleErr != nil && !errors.Is(settleErr, ErrSettled) {
+		return errors.Join(err, settleErr)
+	}
+	return err
+}
+
+// extendableMessage exposes the lease renewal of a Message set up WithExtend.
+type extendableMessage struct{ *Message }
+
+// Extend renews the transport's lease on an unsettled message.
+func (m extendableMessage) Extend(ctx context.Context) error {
+	if m.Settled() {
+		return ErrSettled
+	}
+	return m.extend(ctx)
+}
+
+var (
+	_ adapters.Message           = (*Message)(nil)
+	_ adapters.ExtendableMessage = extendableMessage{}
+)
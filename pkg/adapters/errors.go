@@ -5,3 +5,14 @@ import "errors"
 // ErrNotFound is returned when a requested resource is not found.
 var ErrNotFound = errors.New("not found")
 
+// ErrBlobTooLarge is returned when a blob exceeds the storage backend's configured size limit.
+var ErrBlobTooLarge = errors.New("blob too large")
+
+// ErrUnsupported is returned when a storage backend cannot perform the requested operation.
+var ErrUnsupported = errors.New("unsupported operation")
+
+// ErrConflict is returned when a compare-and-swap update finds the record changed since it was read.
+var ErrConflict = errors.New("conflict")
+
+// ErrClosed is returned when publishing to a bus that has been closed.
+var ErrClosed = errors.New("bus closed")
@@ -2,8 +2,11 @@ package metadata
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/tendant/simple-process/pkg/adapters"
 	"github.com/tendant/simple-process/pkg/contracts"
 )
 
@@ -11,6 +14,9 @@ import (
 type MemoryMetadata struct {
 	mu         sync.Mutex
 	attributes map[string]map[string]interface{}
+	revisions  map[string]int64
+	provenance map[string]map[string]contracts.Provenance
+	history    map[string][]contracts.AttributeChange
 	artifacts  map[string][]contracts.Artifact
 }
 
@@ -18,47 +24,215 @@ type MemoryMetadata struct {
 func NewMemoryMetadata() *MemoryMetadata {
 	return &MemoryMetadata{
 		attributes: make(map[string]map[string]interface{}),
+		revisions:  make(map[string]int64),
+		provenance: make(map[string]map[string]contracts.Provenance),
+		history:    make(map[string][]contracts.AttributeChange),
 		artifacts:  make(map[string][]contracts.Artifact),
 	}
 }
 
-// UpdateFileAttributes merges the patch into the stored attribute set.
+// UpdateFileAttributes merge-patches the stored attribute set and bumps its revision.
 func (m *MemoryMetadata) UpdateFileAttributes(ctx context.Context, fileID string, attributesPatch map[string]interface{}) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	attrs, ok := m.attributes[fileID]
+	m.applyLocked(fileID, attributesPatch, adapters.ProvenanceFromContext(ctx))
+	return nil
+}
+
+// GetFileRevision returns a deep copy of the attributes and their revision; unknown files are at revision 0.
+func (m *MemoryMetadata) GetFileRevision(ctx context.Context, fileID string) (map[string]interface{}, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return MergePatch(m.attributes[fileID], nil), m.revisions[fileID], nil
+}
+
+// UpdateFileAttributesIf merge-patches the attributes only if they are still at expectedRevision.
+func (m *MemoryMetadata) UpdateFileAttributesIf(ctx context.Context, fileID string, expectedRevision int64, attributesPatch map[string]interface{}) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.revisions[fileID] != expectedRevision {
+		return 0, adapters.ErrConflict
+	}
+	return m.applyLocked(fileID, attributesPatch, adapters.ProvenanceFromContext(ctx)), nil
+}
+
+// AttributeProvenance returns who last wrote each current attribute of the file.
+func (m *MemoryMetadata) AttributeProvenance(ctx context.Context, fileID string) (map[string]contracts.Provenance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[string]contracts.Provenance, len(m.provenance[fileID]))
+	for k, p := range m.provenance[fileID] {
+		out[k] = p
+	}
+	return out, nil
+}
+
+// AttributeHistory returns the file's attribute changes, oldest first.
+func (m *MemoryMetadata) AttributeHistory(ctx context.Context, fileID string) ([]contracts.AttributeChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]contracts.AttributeChange, len(m.history[fileID]))
+	copy(out, m.history[fileID])
+	return out, nil
+}
+
+func (m *MemoryMetadata) applyLocked(fileID string, patch map[string]interface{}, prov contracts.Provenance) int64 {
+	merged := MergePatch(m.attributes[fileID], patch)
+	m.attributes[fileID] = merged
+	m.revisions[fileID]++
+	revision := m.revisions[fileID]
+
+	provs, ok := m.provenance[fileID]
 	if !ok {
-		attrs = make(map[string]interface{})
-		m.attributes[fileID] = attrs
+		provs = make(map[string]contracts.Provenance)
+		m.provenance[fileID] = provs
 	}
-	for k, v := range attributesPatch {
-		attrs[k] = v
+	for _, change := range Changes(revision, merged, patch, prov) {
+		if change.Deleted {
+			delete(provs, change.Key)
+		} else {
+			provs[change.Key] = prov
+		}
+		m.history[fileID] = append(m.history[fileID], change)
 	}
-	return nil
+	return revision
 }
 
-// CreateArtifact appends the artifact to the file's artifact list.
+// CreateArtifact appends the artifact to the file's artifact list, or replaces it in
+// place when an artifact with the same identity already exists, so retries are idempotent.
 func (m *MemoryMetadata) CreateArtifact(ctx context.Context, fileID string, artifact contracts.Artifact) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if artifact.CreatedAt.IsZero() {
+		artifact.CreatedAt = time.Now().UTC()
+	}
+	for i, existing := range m.artifacts[fileID] {
+		if sameArtifact(existing, artifact) {
+			m.artifacts[fileID][i] = artifact
+			return nil
+		}
+	}
 	m.artifacts[fileID] = append(m.artifacts[fileID], artifact)
 	return nil
 }
 
-// Snapshot provides a copy of stored attributes and artifacts for inspection.
+// DeleteArtifact removes the artifact with the same identity as artifact.
+func (m *MemoryMetadata) DeleteArtifact(ctx context.Context, fileID string, artifact contracts.Artifact) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, existing := range m.artifacts[fileID] {
+		if sameArtifact(existing, artifact) {
+			m.artifacts[fileID] = append(m.artifacts[fileID][:i:i], m.artifacts[fileID][i+1:]...)
+			return nil
+		}
+	}
+	return adapters.ErrNotFound
+}
+
+// SupersedeArtifacts removes the artifacts uow produced at any version other than version.
+func (m *MemoryMetadata) SupersedeArtifacts(ctx context.Context, fileID, uow, version string) ([]contracts.Artifact, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var kept, removed []contracts.Artifact
+	for _, existing := range m.artifacts[fileID] {
+		if existing.UoW == uow && existing.Version != version {
+			removed = append(removed, existing)
+			continue
+		}
+		kept = append(kept, existing)
+	}
+	m.artifacts[fileID] = kept
+	return removed, nil
+}
+
+func sameArtifact(a, b contracts.Artifact) bool {
+	return a.UoW == b.UoW && a.Kind == b.Kind && a.Key == b.Key
+}
+
+// GetFileAttributes returns a deep copy of the file's attributes or adapters.ErrNotFound.
+func (m *MemoryMetadata) GetFileAttributes(ctx context.Context, fileID string) (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attrs, ok := m.attributes[fileID]
+	if !ok {
+		return nil, adapters.ErrNotFound
+	}
+	return MergePatch(attrs, nil), nil
+}
+
+// ListArtifacts returns the file's artifacts, restricted to kind when it is non-empty.
+func (m *MemoryMetadata) ListArtifacts(ctx context.Context, fileID string, kind string) ([]contracts.Artifact, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []contracts.Artifact
+	for _, artifact := range m.artifacts[fileID] {
+		if kind == "" || artifact.Kind == kind {
+			out = append(out, artifact)
+		}
+	}
+	return out, nil
+}
+
+// FindFiles returns the sorted IDs of files whose attributes satisfy every predicate.
+func (m *MemoryMetadata) FindFiles(ctx context.Context, predicates ...adapters.AttributePredicate) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []string
+	for id, attrs := range m.attributes {
+		matched, err := matchAll(attrs, predicates)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// ScanFiles returns up to limit files with IDs after the given one, in ascending order.
+func (m *MemoryMetadata) ScanFiles(ctx context.Context, after string, limit int) ([]adapters.FileRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, 0, len(m.attributes))
+	for id := range m.attributes {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	records := make([]adapters.FileRecord, len(ids))
+	for i, id := range ids {
+		records[i] = adapters.FileRecord{ID: id, Attributes: MergePatch(m.attributes[id], nil)}
+	}
+	return records, nil
+}
+
+// Snapshot provides a deep copy of stored attributes and artifacts for inspection.
 func (m *MemoryMetadata) Snapshot() (map[string]map[string]interface{}, map[string][]contracts.Artifact) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	attrsCopy := make(map[string]map[string]interface{}, len(m.attributes))
 	for id, attrs := range m.attributes {
-		clone := make(map[string]interface{}, len(attrs))
-		for k, v := range attrs {
-			clone[k] = v
-		}
-		attrsCopy[id] = clone
+		attrsCopy[id] = MergePatch(attrs, nil)
 	}
 
 	artifactsCopy := make(map[string][]contracts.Artifact, len(m.artifacts))
@@ -70,3 +244,11 @@ func (m *MemoryMetadata) Snapshot() (map[string]map[string]interface{}, map[stri
 
 	return attrsCopy, artifactsCopy
 }
+
+var (
+	_ adapters.Metadata          = (*MemoryMetadata)(nil)
+	_ adapters.MetadataReader    = (*MemoryMetadata)(nil)
+	_ adapters.VersionedMetadata = (*MemoryMetadata)(nil)
+	_ adapters.AttributeAuditor  = (*MemoryMetadata)(nil)
+	_ adapters.ArtifactManager   = (*MemoryMetadata)(nil)
+)
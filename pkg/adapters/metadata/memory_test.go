@@ -0,0 +1,255 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+func TestMemoryMetadataReadsAndQueries(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryMetadata()
+
+	m.UpdateFileAttributes(ctx, "f1", map[string]interface{}{"sha256": "abc", "pages": 3})
+	m.UpdateFileAttributes(ctx, "f2", map[string]interface{}{"pages": 3.0})
+	m.CreateArtifact(ctx, "f1", contracts.Artifact{Kind: "checksum"})
+	m.CreateArtifact(ctx, "f1", contracts.Artifact{Kind: "thumbnail"})
+
+	if _, err := m.GetFileAttributes(ctx, "missing"); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if artifacts, _ := m.ListArtifacts(ctx, "f1", "thumbnail"); len(artifacts) != 1 {
+		t.Fatalf("expected one thumbnail artifact, got %v", artifacts)
+	}
+
+	got, err := m.FindFiles(ctx, adapters.AttributeEquals("pages", 3))
+	if err != nil {
+		t.Fatalf("FindFiles error: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"f1", "f2"}) {
+		t.Fatalf("unexpected files: %v", got)
+	}
+
+	got, _ = m.FindFiles(ctx, adapters.AttributeExists("sha256"))
+	if !reflect.DeepEqual(got, []string{"f1"}) {
+		t.Fatalf("unexpected files: %v", got)
+	}
+}
+
+func TestMemoryMetadataMergePatchSemantics(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryMetadata()
+
+	m.UpdateFileAttributes(ctx, "f1", map[string]interface{}{
+		"ocr":  map[string]interface{}{"pages": 12, "lang": "en"},
+		"mime": "application/pdf",
+	})
+	m.UpdateFileAttributes(ctx, "f1", map[string]interface{}{
+		"ocr":  map[string]interface{}{"lang": "de", "confidence": 0.9},
+		"mime": nil,
+	})
+
+	attrs, revision, err := m.GetFileRevision(ctx, "f1")
+	if err != nil {
+		t.Fatalf("GetFileRevision error: %v", err)
+	}
+	want := map[string]interface{}{
+		"ocr": map[string]interface{}{"pages": 12, "lang": "de", "confidence": 0.9},
+	}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Fatalf("unexpected attributes: %#v", attrs)
+	}
+	if revision != 2 {
+		t.Fatalf("expected revision 2, got %d", revision)
+	}
+
+	if _, err := m.UpdateFileAttributesIf(ctx, "f1", 1, map[string]interface{}{"x": 1}); !errors.Is(err, adapters.ErrConflict) {
+		t.Fatalf("expected ErrConflict for stale revision, got %v", err)
+	}
+}
+
+func TestMemoryMetadataReturnsDeepCopies(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryMetadata()
+
+	patch := map[string]interface{}{
+		"ocr":  map[string]interface{}{"lang": "en"},
+		"tags": []interface{}{"invoice"},
+	}
+	m.UpdateFileAttributes(ctx, "f1", patch)
+	patch["ocr"].(map[string]interface{})["lang"] = "patched"
+
+	attrs, _ := m.GetFileAttributes(ctx, "f1")
+	attrs["ocr"].(map[string]interface{})["lang"] = "get"
+	attrs["tags"].([]interface{})[0] = "get"
+	records, _ := m.ScanFiles(ctx, "", 10)
+	records[0].Attributes["ocr"].(map[string]interface{})["lang"] = "scan"
+	snapshot, _ := m.Snapshot()
+	snapshot["f1"]["tags"].([]interface{})[0] = "snapshot"
+
+	want := map[string]interface{}{
+		"ocr":  map[string]interface{}{"lang": "en"},
+		"tags": []interface{}{"invoice"},
+	}
+	if attrs, _ := m.GetFileAttributes(ctx, "f1"); !reflect.DeepEqual(attrs, want) {
+		t.Fatalf("stored attributes changed through a copy: %#v", attrs)
+	}
+}
+
+func TestUpdateWithRetryDoesNotLoseConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryMetadata()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := UpdateWithRetry(ctx, m, "f1", 100, func(attrs map[string]interface{}) (map[string]interface{}, error) {
+				count, _ := attrs["count"].(int)
+				return map[string]interface{}{"count": count + 1}, nil
+			})
+			if err != nil {
+				t.Errorf("UpdateWithRetry error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	attrs, _ := m.GetFileAttributes(ctx, "f1")
+	if attrs["count"] != 20 {
+		t.Fatalf("expected 20 increments, got %v", attrs["count"])
+	}
+}
+
+func TestApplyResultRecordsProvenanceAndHistory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryMetadata()
+
+	result := contracts.Result{
+		JobID:           "job-1",
+		FileID:          "f1",
+		UoW:             "hash",
+		AttributesPatch: map[string]interface{}{"sha256": "abc"},
+	}
+	if _, err := ApplyResult(ctx, m, result, ApplyOptions{Namespace: true, Version: "v2"}); err != nil {
+		t.Fatalf("ApplyResult error: %v", err)
+	}
+	pctx := adapters.ContextWithProvenance(ctx, contracts.Provenance{UoW: "cleanup", JobID: "job-2"})
+	if err := m.UpdateFileAttributes(pctx, "f1", map[string]interface{}{"hash.sha256": nil}); err != nil {
+		t.Fatalf("UpdateFileAttributes error: %v", err)
+	}
+
+	history, err := m.AttributeHistory(ctx, "f1")
+	if err != nil {
+		t.Fatalf("AttributeHistory error: %v", err)
+	}
+	// The second entry records the version under uow_versions.
+	if len(history) != 3 || history[1].Key != VersionsAttribute {
+		t.Fatalf("expected three history entries, got %+v", history)
+	}
+	first, second := history[0], history[2]
+	if first.Key != "hash.sha256" || first.Value != "abc" || first.Provenance.JobID != "job-1" || first.Provenance.Version != "v2" {
+		t.Fatalf("unexpected first change: %+v", first)
+	}
+	if !second.Deleted || second.Revision != 2 || second.Provenance.UoW != "cleanup" {
+		t.Fatalf("unexpected second change: %+v", second)
+	}
+
+	provs, _ := m.AttributeProvenance(ctx, "f1")
+	if _, ok := provs["hash.sha256"]; ok {
+		t.Fatalf("expected deleted key to drop its provenance, got %v", provs)
+	}
+}
+
+func TestApplyResultRecordsUoWVersion(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryMetadata()
+
+	for _, version := range []string{"1", "2"} {
+		result := contracts.Result{JobID: "job-" + version, FileID: "f1", UoW: "ocr", UoWVersion: version, AttributesPatch: map[string]interface{}{"pages": 3}}
+		if _, err := ApplyResult(ctx, m, result, ApplyOptions{Namespace: true}); err != nil {
+			t.Fatalf("ApplyResult error: %v", err)
+		}
+	}
+	ApplyResult(ctx, m, contracts.Result{JobID: "job-3", FileID: "f1", UoW: "hash", UoWVersion: "1"}, ApplyOptions{})
+	// An explicit version wins over the result's and is the one recorded.
+	ApplyResult(ctx, m, contracts.Result{JobID: "job-4", FileID: "f1", UoW: "mime"}, ApplyOptions{Version: "7"})
+
+	attrs, _ := m.GetFileAttributes(ctx, "f1")
+	if version, ok := ProcessedVersion(attrs, "ocr"); !ok || version != "2" || attrs["ocr.pages"] != 3 {
+		t.Fatalf("expected ocr version 2, got %v", attrs)
+	}
+	if version, _ := ProcessedVersion(attrs, "hash"); version != "1" {
+		t.Fatalf("expected hash version 1, got %v", attrs)
+	}
+	if version, _ := ProcessedVersion(attrs, "mime"); version != "7" {
+		t.Fatalf("expected mime version 7 from the options, got %v", attrs)
+	}
+	if _, ok := ProcessedVersion(attrs, "thumbnail"); ok {
+		t.Fatalf("expected no thumbnail version, got %v", attrs)
+	}
+	provs, _ := m.AttributeProvenance(ctx, "f1")
+	if provs["ocr.pages"].Version != "2" {
+		t.Fatalf("expected provenance to default to the result's version, got %+v", provs)
+	}
+
+	page, err := m.ScanFiles(ctx, "", 10)
+	if err != nil || len(page) != 1 || page[0].ID != "f1" {
+		t.Fatalf("ScanFiles = %+v, %v", page, err)
+	}
+}
+
+func TestApplyResultUpsertsAndSupersedesArtifacts(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryMetadata()
+
+	result := contracts.Result{
+		JobID:  "job-1",
+		FileID: "f1",
+		UoW:    "thumbs",
+		Artifacts: []contracts.Artifact{
+			{Kind: "thumbnail", Key: "small", Location: "v1/small.png"},
+			{Kind: "thumbnail", Key: "large", Location: "v1/large.png"},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := ApplyResult(ctx, m, result, ApplyOptions{Version: "1"}); err != nil {
+			t.Fatalf("ApplyResult error: %v", err)
+		}
+	}
+	artifacts, _ := m.ListArtifacts(ctx, "f1", "")
+	if len(artifacts) != 2 || artifacts[0].JobID != "job-1" || artifacts[0].Version != "1" || artifacts[0].CreatedAt.IsZero() {
+		t.Fatalf("expected retried result to upsert two artifacts, got %+v", artifacts)
+	}
+
+	rerun := contracts.Result{
+		JobID:     "job-2",
+		FileID:    "f1",
+		UoW:       "thumbs",
+		Artifacts: []contracts.Artifact{{Kind: "thumbnail", Key: "small", Location: "v2/small.png"}},
+	}
+	removed, err := ApplyResult(ctx, m, rerun, ApplyOptions{Version: "2", Supersede: true})
+	if err != nil {
+		t.Fatalf("ApplyResult error: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Location != "v1/large.png" {
+		t.Fatalf("expected the stale large thumbnail to be superseded, got %+v", removed)
+	}
+	artifacts, _ = m.ListArtifacts(ctx, "f1", "")
+	if len(artifacts) != 1 || artifacts[0].Location != "v2/small.png" {
+		t.Fatalf("unexpected artifacts after rerun: %+v", artifacts)
+	}
+
+	if err := m.DeleteArtifact(ctx, "f1", artifacts[0]); err != nil {
+		t.Fatalf("DeleteArtifact error: %v", err)
+	}
+	if err := m.DeleteArtifact(ctx, "f1", artifacts[0]); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package metadata
+
+// MergePatch applies an RFC 7396 JSON Merge Patch to target and returns the result.
+// Nested objects are merged recursively and null values delete keys. Neither input
+// is modified and the result shares no maps or slices with them, so MergePatch(attrs, nil)
+// is a deep copy that callers may change freely.
+func MergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(target)+len(patch))
+	for k, v := range target {
+		out[k] = cloneValue(v)
+	}
+
+	for k, v := range patch {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		if patchObj, ok := v.(map[string]interface{}); ok {
+			targetObj, _ := out[k].(map[string]interface{})
+			out[k] = MergePatch(targetObj, patchObj)
+			continue
+		}
+		out[k] = cloneValue(v)
+	}
+	return out
+}
+
+// cloneValue deep-copies the objects and arrays of a decoded JSON value.
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return MergePatch(v, nil)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = cloneValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
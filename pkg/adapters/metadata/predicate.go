@@ -0,0 +1,48 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+)
+
+// Match reports whether attrs satisfies the predicate. Values are compared after a
+// JSON round trip so that, for example, int 12 equals the float64 12 read back from storage.
+func Match(attrs map[string]interface{}, predicate adapters.AttributePredicate) (bool, error) {
+	value, ok := attrs[predicate.Key]
+	switch predicate.Op {
+	case adapters.OpExists:
+		return ok, nil
+	case adapters.OpEquals:
+		if !ok {
+			return false, nil
+		}
+		return reflect.DeepEqual(normalize(value), normalize(predicate.Value)), nil
+	default:
+		return false, fmt.Errorf("unsupported predicate op: %q", predicate.Op)
+	}
+}
+
+func matchAll(attrs map[string]interface{}, predicates []adapters.AttributePredicate) (bool, error) {
+	for _, predicate := range predicates {
+		ok, err := Match(attrs, predicate)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func normalize(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
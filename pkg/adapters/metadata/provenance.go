@@ -0,0 +1,132 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// Changes lists the audit entries produced by applying patch, given the merged result.
+// Entries are ordered by key so histories are deterministic.
+func Changes(revision int64, merged, patch map[string]interface{}, prov contracts.Provenance) []contracts.AttributeChange {
+	keys := make([]string, 0, len(patch))
+	for k := range patch {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	changes := make([]contracts.AttributeChange, 0, len(keys))
+	for _, k := range keys {
+		value, ok := merged[k]
+		changes = append(changes, contracts.AttributeChange{
+			Revision:   revision,
+			Key:        k,
+			Value:      value,
+			Deleted:    !ok,
+			Provenance: prov,
+		})
+	}
+	return changes
+}
+
+// Namespace prefixes every top-level key of patch with "<namespace>." unless it already
+// carries that prefix, so attributes from different UoWs cannot collide.
+func Namespace(namespace string, patch map[string]interface{}) map[string]interface{} {
+	if namespace == "" {
+		return patch
+	}
+	prefix := namespace + "."
+	out := make(map[string]interface{}, len(patch))
+	for k, v := range patch {
+		if !strings.HasPrefix(k, prefix) {
+			k = prefix + k
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// VersionsAttribute is the attribute under which ApplyResult records, per UoW,
+// the version that last processed the file, e.g. {"uow_versions": {"ocr": "2"}}.
+const VersionsAttribute = "uow_versions"
+
+// ProcessedVersion returns the version of uow recorded in attrs by ApplyResult.
+func ProcessedVersion(attrs map[string]interface{}, uow string) (string, bool) {
+	versions, _ := attrs[VersionsAttribute].(map[string]interface{})
+	version, ok := versions[uow].(string)
+	return version, ok
+}
+
+// ApplyOptions controls how ApplyResult persists a Result.
+type ApplyOptions struct {
+	// Namespace prefixes attribute keys with the result's UoW name, e.g. "hash.sha256".
+	Namespace bool
+	// Version identifies the UoW implementation recorded in provenance and on artifacts.
+	// It defaults to the result's UoWVersion.
+	Version string
+	// Supersede removes artifacts the UoW produced at other versions once the new ones are
+	// recorded. It requires a backend implementing adapters.ArtifactManager.
+	Supersede bool
+}
+
+// ApplyResult persists a UoW result: it merge-patches the file's attributes with the
+// result's provenance attached and records every artifact, filling in the producing
+// UoW, job and version. The resolved version, from opts or the result, is also
+// recorded under VersionsAttribute. Superseded artifacts are returned for blob cleanup.
+func ApplyResult(ctx context.Context, m adapters.Metadata, result contracts.Result, opts ApplyOptions) ([]contracts.Artifact, error) {
+	version := opts.Version
+	if version == "" {
+		version = result.UoWVersion
+	}
+	ctx = adapters.ContextWithProvenance(ctx, contracts.Provenance{
+		UoW:     result.UoW,
+		JobID:   result.JobID,
+		Version: version,
+	})
+
+	patch := result.AttributesPatch
+	if opts.Namespace {
+		patch = Namespace(result.UoW, patch)
+	}
+	if version != "" && result.UoW != "" {
+		versioned := make(map[string]interface{}, len(patch)+1)
+		for k, v := range patch {
+			versioned[k] = v
+		}
+		versioned[VersionsAttribute] = map[string]interface{}{result.UoW: version}
+		patch = versioned
+	}
+	if len(patch) > 0 {
+		if err := m.UpdateFileAttributes(ctx, result.FileID, patch); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, artifact := range result.Artifacts {
+		if artifact.UoW == "" {
+			artifact.UoW = result.UoW
+		}
+		if artifact.JobID == "" {
+			artifact.JobID = result.JobID
+		}
+		if artifact.Version == "" {
+			artifact.Version = version
+		}
+		if err := m.CreateArtifact(ctx, result.FileID, artifact); err != nil {
+			return nil, err
+		}
+	}
+
+	if !opts.Supersede {
+		return nil, nil
+	}
+	manager, ok := m.(adapters.ArtifactManager)
+	if !ok {
+		return nil, fmt.Errorf("supersede artifacts: %w", adapters.ErrUnsupported)
+	}
+	return manager.SupersedeArtifacts(ctx, result.FileID, result.UoW, version)
+}
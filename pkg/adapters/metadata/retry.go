@@ -0,0 +1,39 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+)
+
+// UpdateWithRetry performs a read-modify-write of a file's attributes. It reads the
+// current attributes, asks fn for a merge patch and applies it with compare-and-swap,
+// retrying up to attempts times when a concurrent writer causes adapters.ErrConflict.
+func UpdateWithRetry(ctx context.Context, m adapters.VersionedMetadata, fileID string, attempts int, fn func(attrs map[string]interface{}) (map[string]interface{}, error)) (int64, error) {
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	for i := 0; i < attempts; i++ {
+		attrs, revision, err := m.GetFileRevision(ctx, fileID)
+		if err != nil {
+			return 0, err
+		}
+		patch, err := fn(attrs)
+		if err != nil {
+			return 0, err
+		}
+
+		newRevision, err := m.UpdateFileAttributesIf(ctx, fileID, revision, patch)
+		if errors.Is(err, adapters.ErrConflict) {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		return newRevision, err
+	}
+	return 0, fmt.Errorf("update %s after %d attempts: %w", fileID, attempts, adapters.ErrConflict)
+}
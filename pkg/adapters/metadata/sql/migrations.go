@@ -0,0 +1,166 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tendant/simple-process/internal/sqldialect"
+)
+
+// migration is a forward-only schema change rendered for the configured dialect.
+type migration struct {
+	version int
+	up      func(d sqldialect.Dialect) []string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		up: func(d sqldialect.Dialect) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS sp_files (
+	id TEXT PRIMARY KEY,
+	attributes %s NOT NULL,
+	updated_at %s NOT NULL
+)`, d.JSONType(), d.TimeType()),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS sp_artifacts (
+	id %s,
+	file_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	mime TEXT NOT NULL,
+	bytes BIGINT NOT NULL,
+	location TEXT NOT NULL,
+	created_at %s NOT NULL
+)`, d.SerialType(), d.TimeType()),
+				`CREATE INDEX IF NOT EXISTS sp_artifacts_file_id ON sp_artifacts (file_id)`,
+			}
+		},
+	},
+	{
+		// Revisions enable compare-and-swap updates; Postgres gains an RFC 7396 merge
+		// function to match SQLite's built-in json_patch.
+		version: 2,
+		up: func(d sqldialect.Dialect) []string {
+			stmts := []string{`ALTER TABLE sp_files ADD COLUMN revision BIGINT NOT NULL DEFAULT 1`}
+			if d == sqldialect.Postgres {
+				stmts = append(stmts, `CREATE OR REPLACE FUNCTION sp_jsonb_merge_patch(target JSONB, patch JSONB) RETURNS JSONB AS $$
+DECLARE
+	result JSONB;
+	k TEXT;
+	v JSONB;
+BEGIN
+	IF patch IS NULL OR jsonb_typeof(patch) <> 'object' THEN
+		RETURN patch;
+	END IF;
+	IF target IS NULL OR jsonb_typeof(target) <> 'object' THEN
+		result := '{}'::JSONB;
+	ELSE
+		result := target;
+	END IF;
+	FOR k, v IN SELECT * FROM jsonb_each(patch) LOOP
+		IF jsonb_typeof(v) = 'null' THEN
+			result := result - k;
+		ELSE
+			result := jsonb_set(result, ARRAY[k], sp_jsonb_merge_patch(result -> k, v));
+		END IF;
+	END LOOP;
+	RETURN result;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE`)
+			}
+			return stmts
+		},
+	},
+	{
+		// Provenance keeps the last writer of every current key; history keeps every change.
+		version: 3,
+		up: func(d sqldialect.Dialect) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS sp_attribute_provenance (
+	file_id TEXT NOT NULL,
+	key TEXT NOT NULL,
+	uow TEXT NOT NULL,
+	job_id TEXT NOT NULL,
+	version TEXT NOT NULL,
+	recorded_at %s NOT NULL,
+	PRIMARY KEY (file_id, key)
+)`, d.TimeType()),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS sp_attribute_history (
+	id %s,
+	file_id TEXT NOT NULL,
+	revision BIGINT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT,
+	deleted BOOLEAN NOT NULL,
+	uow TEXT NOT NULL,
+	job_id TEXT NOT NULL,
+	version TEXT NOT NULL,
+	recorded_at %s NOT NULL
+)`, d.SerialType(), d.TimeType()),
+				`CREATE INDEX IF NOT EXISTS sp_attribute_history_file_id ON sp_attribute_history (file_id)`,
+			}
+		},
+	},
+	{
+		// Artifacts gain a stable identity (file, uow, kind, key) so retries upsert instead of
+		// appending. Duplicates recorded before this migration collapse to the newest row.
+		version: 4,
+		up: func(d sqldialect.Dialect) []string {
+			return []string{
+				`ALTER TABLE sp_artifacts ADD COLUMN uow TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE sp_artifacts ADD COLUMN key TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE sp_artifacts ADD COLUMN checksum TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE sp_artifacts ADD COLUMN job_id TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE sp_artifacts ADD COLUMN version TEXT NOT NULL DEFAULT ''`,
+				`DELETE FROM sp_artifacts WHERE id NOT IN (SELECT MAX(id) FROM sp_artifacts GROUP BY file_id, uow, kind, key)`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS sp_artifacts_identity ON sp_artifacts (file_id, uow, kind, key)`,
+			}
+		},
+	},
+}
+
+// Migrate creates or upgrades the schema. It is safe to call on every start.
+func (m *Metadata) Migrate(ctx context.Context) error {
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS sp_schema_migrations (
+	version INTEGER PRIMARY KEY,
+	applied_at %s NOT NULL
+)`, m.dialect.TimeType())); err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+
+	for _, mig := range migrations {
+		if err := m.apply(ctx, mig); err != nil {
+			return fmt.Errorf("migration %d: %w", mig.version, err)
+		}
+	}
+	return nil
+}
+
+func (m *Metadata) apply(ctx context.Context, mig migration) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied int
+	err = tx.QueryRowContext(ctx, m.dialect.Rebind(`SELECT COUNT(*) FROM sp_schema_migrations WHERE version = ?`), mig.version).Scan(&applied)
+	if err != nil && err != stdsql.ErrNoRows {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	for _, stmt := range mig.up(m.dialect) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, m.dialect.Rebind(`INSERT INTO sp_schema_migrations (version, applied_at) VALUES (?, ?)`), mig.version, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,206 @@
+//go:build postgres && integration
+
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// newPostgresMetadata migrates a fresh schema on POSTGRES_URL, so tests never
+// see each other's files.
+func newPostgresMetadata(t *testing.T) (*Metadata, *stdsql.DB) {
+	t.Helper()
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		url = "postgres://postgres@localhost:5432/postgres?sslmode=disable"
+	}
+	cfg, err := pgx.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("parse POSTGRES_URL: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	admin := stdlib.OpenDB(*cfg)
+	t.Cleanup(func() { admin.Close() })
+	if err := admin.PingContext(ctx); err != nil {
+		t.Skipf("skipping: unable to connect to postgres (%v)", err)
+	}
+	schema := fmt.Sprintf("sp_test_%d", time.Now().UnixNano())
+	if _, err := admin.ExecContext(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	cfg.RuntimeParams["search_path"] = schema
+	db := stdlib.OpenDB(*cfg)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := New(db, Postgres)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	if err := m.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate error: %v", err)
+	}
+	if err := m.Migrate(ctx); err != nil {
+		t.Fatalf("second Migrate error: %v", err)
+	}
+	return m, db
+}
+
+func TestPostgresMetadataMergesAttributePatches(t *testing.T) {
+	ctx := context.Background()
+	m, db := newPostgresMetadata(t)
+
+	if err := m.UpdateFileAttributes(ctx, "f1", map[string]interface{}{"sha256": "abc", "mime": "text/plain"}); err != nil {
+		t.Fatalf("UpdateFileAttributes error: %v", err)
+	}
+	if err := m.UpdateFileAttributes(ctx, "f1", map[string]interface{}{"pages": 12, "mime": "application/pdf", "ocr.lang": "en"}); err != nil {
+		t.Fatalf("UpdateFileAttributes error: %v", err)
+	}
+
+	attrs, err := m.GetFileAttributes(ctx, "f1")
+	if err != nil {
+		t.Fatalf("GetFileAttributes error: %v", err)
+	}
+	if attrs["sha256"] != "abc" || attrs["mime"] != "application/pdf" || attrs["pages"] != float64(12) || attrs["ocr.lang"] != "en" {
+		t.Fatalf("unexpected merged attributes: %v", attrs)
+	}
+
+	if err := m.CreateArtifact(ctx, "f1", contracts.Artifact{Kind: "checksum", Location: "artifacts/f1.sha256"}); err != nil {
+		t.Fatalf("CreateArtifact error: %v", err)
+	}
+	var location string
+	if err := db.QueryRow(`SELECT location FROM sp_artifacts WHERE file_id = $1`, "f1").Scan(&location); err != nil || location != "artifacts/f1.sha256" {
+		t.Fatalf("unexpected artifact row: %s %v", location, err)
+	}
+}
+
+func TestPostgresMetadataFindsFiles(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newPostgresMetadata(t)
+
+	m.UpdateFileAttributes(ctx, "f1", map[string]interface{}{"sha256": "abc", "pages": 3, "ocr.lang": "en"})
+	m.UpdateFileAttributes(ctx, "f2", map[string]interface{}{"pages": 3.0, "flagged": true, "exif": map[string]interface{}{"camera": "X100"}})
+	m.UpdateFileAttributes(ctx, "f3", map[string]interface{}{"sha256": "def", "ocr": map[string]interface{}{"lang": "en"}, "tags": []interface{}{"a", "b"}})
+
+	cases := []struct {
+		predicates []adapters.AttributePredicate
+		want       []string
+	}{
+		{[]adapters.AttributePredicate{adapters.AttributeExists("sha256")}, []string{"f1", "f3"}},
+		// JSONB compares numbers by value, so 3 and 3.0 match either way.
+		{[]adapters.AttributePredicate{adapters.AttributeEquals("pages", 3)}, []string{"f1", "f2"}},
+		{[]adapters.AttributePredicate{adapters.AttributeEquals("pages", 3.0)}, []string{"f1", "f2"}},
+		{[]adapters.AttributePredicate{adapters.AttributeEquals("pages", "3")}, nil},
+		{[]adapters.AttributePredicate{adapters.AttributeEquals("flagged", true)}, []string{"f2"}},
+		{[]adapters.AttributePredicate{adapters.AttributeEquals("exif", map[string]interface{}{"camera": "X100"})}, []string{"f2"}},
+		{[]adapters.AttributePredicate{adapters.AttributeEquals("tags", []interface{}{"a", "b"})}, []string{"f3"}},
+		// Keys are top-level names, never paths.
+		{[]adapters.AttributePredicate{adapters.AttributeEquals("ocr.lang", "en")}, []string{"f1"}},
+		{[]adapters.AttributePredicate{adapters.AttributeExists("ocr")}, []string{"f3"}},
+		{[]adapters.AttributePredicate{adapters.AttributeExists("sha256"), adapters.AttributeEquals("pages", 3)}, []string{"f1"}},
+		{nil, []string{"f1", "f2", "f3"}},
+	}
+	for _, tc := range cases {
+		got, err := m.FindFiles(ctx, tc.predicates...)
+		if err != nil {
+			t.Fatalf("FindFiles(%v) error: %v", tc.predicates, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("FindFiles(%v) = %v, want %v", tc.predicates, got, tc.want)
+		}
+	}
+
+	page, err := m.ScanFiles(ctx, "f1", 1)
+	if err != nil || len(page) != 1 || page[0].ID != "f2" || page[0].Attributes["flagged"] != true {
+		t.Fatalf("ScanFiles = %+v, %v", page, err)
+	}
+}
+
+func TestPostgresMergePatchFunction(t *testing.T) {
+	ctx := context.Background()
+	_, db := newPostgresMetadata(t)
+
+	// The examples from RFC 7396, Appendix A.
+	cases := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tc := range cases {
+		var got bool
+		err := db.QueryRowContext(ctx, `SELECT sp_jsonb_merge_patch(CAST($1 AS JSONB), CAST($2 AS JSONB)) = CAST($3 AS JSONB)`, tc.target, tc.patch, tc.want).Scan(&got)
+		if err != nil {
+			t.Fatalf("merge %s with %s: %v", tc.target, tc.patch, err)
+		}
+		if !got {
+			t.Errorf("merge %s with %s: expected %s", tc.target, tc.patch, tc.want)
+		}
+	}
+}
+
+func TestPostgresMetadataMergePatchAndRevisions(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newPostgresMetadata(t)
+
+	rev, err := m.UpdateFileAttributesIf(ctx, "f1", 0, map[string]interface{}{
+		"ocr":  map[string]interface{}{"pages": 12, "lang": "en"},
+		"mime": "application/pdf",
+		"tmp":  nil,
+	})
+	if err != nil || rev != 1 {
+		t.Fatalf("first CAS update = %d, %v", rev, err)
+	}
+	if _, err := m.UpdateFileAttributesIf(ctx, "f1", 0, map[string]interface{}{"x": 1}); !errors.Is(err, adapters.ErrConflict) {
+		t.Fatalf("expected ErrConflict creating an existing file, got %v", err)
+	}
+
+	if err := m.UpdateFileAttributes(ctx, "f1", map[string]interface{}{
+		"ocr":  map[string]interface{}{"lang": "de"},
+		"mime": nil,
+	}); err != nil {
+		t.Fatalf("UpdateFileAttributes error: %v", err)
+	}
+
+	attrs, rev, err := m.GetFileRevision(ctx, "f1")
+	if err != nil {
+		t.Fatalf("GetFileRevision error: %v", err)
+	}
+	want := map[string]interface{}{"ocr": map[string]interface{}{"pages": float64(12), "lang": "de"}}
+	if !reflect.DeepEqual(attrs, want) || rev != 2 {
+		t.Fatalf("unexpected state: %#v at revision %d", attrs, rev)
+	}
+
+	if _, err := m.UpdateFileAttributesIf(ctx, "f1", 1, map[string]interface{}{"x": 1}); !errors.Is(err, adapters.ErrConflict) {
+		t.Fatalf("expected ErrConflict for stale revision, got %v", err)
+	}
+	if rev, err := m.UpdateFileAttributesIf(ctx, "f1", 2, map[string]interface{}{"x": 1}); err != nil || rev != 3 {
+		t.Fatalf("CAS update = %d, %v", rev, err)
+	}
+}
@@ -0,0 +1,486 @@
+// Package sql implements adapters.Metadata on top of database/sql for SQLite and
+// Postgres. Bring your own driver (e.g. modernc.org/sqlite or pgx's stdlib) and
+// call Migrate before use.
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tendant/simple-process/internal/sqldialect"
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/adapters/metadata"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// Dialect selects the SQL flavour used by the adapter.
+type Dialect = sqldialect.Dialect
+
+// Supported dialects.
+const (
+	SQLite   = sqldialect.SQLite
+	Postgres = sqldialect.Postgres
+)
+
+// Metadata persists file attributes and artifacts in SQL tables.
+type Metadata struct {
+	db      *stdsql.DB
+	dialect Dialect
+}
+
+// New wraps an open database handle. Call Migrate to create the schema.
+func New(db *stdsql.DB, dialect Dialect) (*Metadata, error) {
+	if db == nil {
+		return nil, errors.New("database handle is required")
+	}
+	if err := dialect.Validate(); err != nil {
+		return nil, err
+	}
+	return &Metadata{db: db, dialect: dialect}, nil
+}
+
+// UpdateFileAttributes applies the merge patch inside the database and bumps the
+// revision, so concurrent writers never lose each other's keys. Provenance attached
+// with adapters.ContextWithProvenance is recorded in the same transaction.
+func (m *Metadata) UpdateFileAttributes(ctx context.Context, fileID string, attributesPatch map[string]interface{}) error {
+	return m.inTx(ctx, func(tx *stdsql.Tx) error {
+		return m.UpdateFileAttributesTx(ctx, tx, fileID, attributesPatch)
+	})
+}
+
+// UpdateFileAttributesTx is UpdateFileAttributes inside the caller's transaction,
+// so the change commits or rolls back together with the caller's other writes,
+// such as an outbox entry for the job it triggers.
+func (m *Metadata) UpdateFileAttributesTx(ctx context.Context, tx *stdsql.Tx, fileID string, attributesPatch map[string]interface{}) error {
+	if tx == nil {
+		return errors.New("transaction is required")
+	}
+	if fileID == "" {
+		return errors.New("file id is required")
+	}
+
+	patch, err := json.Marshal(nonNil(attributesPatch))
+	if err != nil {
+		return fmt.Errorf("marshal attributes: %w", err)
+	}
+
+	query := `INSERT INTO sp_files (id, attributes, revision, updated_at) VALUES (?, ` + m.mergeSQL(m.emptyObject(), "?") + `, 1, ?)
+ON CONFLICT (id) DO UPDATE SET attributes = ` + m.mergeSQL("sp_files.attributes", "?") + `,
+	revision = sp_files.revision + 1, updated_at = excluded.updated_at`
+	// The patch is bound twice: the inserted value has nulls stripped, so it cannot drive the update.
+	if _, err := tx.ExecContext(ctx, m.dialect.Rebind(query), fileID, string(patch), time.Now().UTC(), string(patch)); err != nil {
+		return fmt.Errorf("update attributes: %w", err)
+	}
+	_, err = m.audit(ctx, tx, fileID, attributesPatch)
+	return err
+}
+
+// GetFileRevision returns the attributes and revision; unknown files are at revision 0.
+func (m *Metadata) GetFileRevision(ctx context.Context, fileID string) (map[string]interface{}, int64, error) {
+	return m.fileRevision(ctx, m.db, fileID)
+}
+
+// UpdateFileAttributesIf applies the merge patch only while the row is at expectedRevision.
+func (m *Metadata) UpdateFileAttributesIf(ctx context.Context, fileID string, expectedRevision int64, attributesPatch map[string]interface{}) (int64, error) {
+	if fileID == "" {
+		return 0, errors.New("file id is required")
+	}
+
+	patch, err := json.Marshal(nonNil(attributesPatch))
+	if err != nil {
+		return 0, fmt.Errorf("marshal attributes: %w", err)
+	}
+
+	var revision int64
+	err = m.inTx(ctx, func(tx *stdsql.Tx) error {
+		now := time.Now().UTC()
+		var res stdsql.Result
+		if expectedRevision == 0 {
+			query := `INSERT INTO sp_files (id, attributes, revision, updated_at) VALUES (?, ` + m.mergeSQL(m.emptyObject(), "?") + `, 1, ?)
+ON CONFLICT (id) DO NOTHING`
+			res, err = tx.ExecContext(ctx, m.dialect.Rebind(query), fileID, string(patch), now)
+		} else {
+			query := `UPDATE sp_files SET attributes = ` + m.mergeSQL("attributes", "?") + `, revision = revision + 1, updated_at = ?
+WHERE id = ? AND revision = ?`
+			res, err = tx.ExecContext(ctx, m.dialect.Rebind(query), string(patch), now, fileID, expectedRevision)
+		}
+		if err != nil {
+			return fmt.Errorf("update attributes: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return adapters.ErrConflict
+		}
+		revision, err = m.audit(ctx, tx, fileID, attributesPatch)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+// AttributeProvenance returns who last wrote each current attribute of the file.
+func (m *Metadata) AttributeProvenance(ctx context.Context, fileID string) (map[string]contracts.Provenance, error) {
+	rows, err := m.db.QueryContext(ctx, m.dialect.Rebind(`SELECT key, uow, job_id, version, recorded_at FROM sp_attribute_provenance WHERE file_id = ?`), fileID)
+	if err != nil {
+		return nil, fmt.Errorf("get provenance: %w", err)
+	}
+	defer rows.Close()
+
+	provs := make(map[string]contracts.Provenance)
+	for rows.Next() {
+		var (
+			key string
+			p   contracts.Provenance
+		)
+		if err := rows.Scan(&key, &p.UoW, &p.JobID, &p.Version, &p.Timestamp); err != nil {
+			return nil, err
+		}
+		provs[key] = p
+	}
+	return provs, rows.Err()
+}
+
+// AttributeHistory returns the file's attribute changes, oldest first.
+func (m *Metadata) AttributeHistory(ctx context.Context, fileID string) ([]contracts.AttributeChange, error) {
+	rows, err := m.db.QueryContext(ctx, m.dialect.Rebind(`SELECT revision, key, value, deleted, uow, job_id, version, recorded_at
+FROM sp_attribute_history WHERE file_id = ? ORDER BY id`), fileID)
+	if err != nil {
+		return nil, fmt.Errorf("get history: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []contracts.AttributeChange
+	for rows.Next() {
+		var (
+			c     contracts.AttributeChange
+			value stdsql.NullString
+		)
+		if err := rows.Scan(&c.Revision, &c.Key, &value, &c.Deleted, &c.Provenance.UoW, &c.Provenance.JobID, &c.Provenance.Version, &c.Provenance.Timestamp); err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			if err := json.Unmarshal([]byte(value.String), &c.Value); err != nil {
+				return nil, fmt.Errorf("decode history value: %w", err)
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// audit records provenance and history rows for a patch just applied in tx and
+// returns the file's new revision.
+func (m *Metadata) audit(ctx context.Context, tx *stdsql.Tx, fileID string, patch map[string]interface{}) (int64, error) {
+	merged, revision, err := m.fileRevision(ctx, tx, fileID)
+	if err != nil {
+		return 0, err
+	}
+
+	prov := adapters.ProvenanceFromContext(ctx)
+	for _, change := range metadata.Changes(revision, merged, patch, prov) {
+		var value interface{}
+		if !change.Deleted {
+			raw, err := json.Marshal(change.Value)
+			if err != nil {
+				return 0, fmt.Errorf("marshal history value: %w", err)
+			}
+			value = string(raw)
+		}
+		if _, err := tx.ExecContext(ctx, m.dialect.Rebind(`INSERT INTO sp_attribute_history (file_id, revision, key, value, deleted, uow, job_id, version, recorded_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`), fileID, revision, change.Key, value, change.Deleted, prov.UoW, prov.JobID, prov.Version, prov.Timestamp); err != nil {
+			return 0, fmt.Errorf("record history: %w", err)
+		}
+
+		if change.Deleted {
+			_, err = tx.ExecContext(ctx, m.dialect.Rebind(`DELETE FROM sp_attribute_provenance WHERE file_id = ? AND key = ?`), fileID, change.Key)
+		} else {
+			_, err = tx.ExecContext(ctx, m.dialect.Rebind(`INSERT INTO sp_attribute_provenance (file_id, key, uow, job_id, version, recorded_at) VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (file_id, key) DO UPDATE SET uow = excluded.uow, job_id = excluded.job_id, version = excluded.version, recorded_at = excluded.recorded_at`),
+				fileID, change.Key, prov.UoW, prov.JobID, prov.Version, prov.Timestamp)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("record provenance: %w", err)
+		}
+	}
+	return revision, nil
+}
+
+// queryer is satisfied by both *stdsql.DB and *stdsql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*stdsql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *stdsql.Row
+}
+
+func (m *Metadata) fileRevision(ctx context.Context, q queryer, fileID string) (map[string]interface{}, int64, error) {
+	var (
+		raw      string
+		revision int64
+	)
+	err := q.QueryRowContext(ctx, m.dialect.Rebind(`SELECT CAST(attributes AS TEXT), revision FROM sp_files WHERE id = ?`), fileID).Scan(&raw, &revision)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return map[string]interface{}{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("get attributes: %w", err)
+	}
+
+	attrs := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(raw), &attrs); err != nil {
+		return nil, 0, fmt.Errorf("decode attributes: %w", err)
+	}
+	return attrs, revision, nil
+}
+
+func (m *Metadata) inTx(ctx context.Context, fn func(tx *stdsql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// mergeSQL renders an RFC 7396 merge of the JSON text or column patch into target.
+func (m *Metadata) mergeSQL(target, patch string) string {
+	if m.dialect == Postgres {
+		if patch == "?" {
+			patch = "CAST(? AS JSONB)"
+		}
+		return "sp_jsonb_merge_patch(" + target + ", " + patch + ")"
+	}
+	return "json_patch(" + target + ", " + patch + ")"
+}
+
+func (m *Metadata) emptyObject() string {
+	if m.dialect == Postgres {
+		return `'{}'::JSONB`
+	}
+	return `'{}'`
+}
+
+// CreateArtifact records the artifact, replacing the row with the same identity so
+// retried jobs do not accumulate duplicates.
+func (m *Metadata) CreateArtifact(ctx context.Context, fileID string, artifact contracts.Artifact) error {
+	if fileID == "" {
+		return errors.New("file id is required")
+	}
+	if artifact.CreatedAt.IsZero() {
+		artifact.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := m.db.ExecContext(ctx, m.dialect.Rebind(`INSERT INTO sp_artifacts (file_id, uow, kind, key, mime, bytes, location, checksum, job_id, version, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (file_id, uow, kind, key) DO UPDATE SET mime = excluded.mime, bytes = excluded.bytes, location = excluded.location,
+	checksum = excluded.checksum, job_id = excluded.job_id, version = excluded.version, created_at = excluded.created_at`),
+		fileID, artifact.UoW, artifact.Kind, artifact.Key, artifact.MIME, artifact.Bytes, artifact.Location,
+		artifact.Checksum, artifact.JobID, artifact.Version, artifact.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create artifact: %w", err)
+	}
+	return nil
+}
+
+// DeleteArtifact removes the artifact with the same identity as artifact.
+func (m *Metadata) DeleteArtifact(ctx context.Context, fileID string, artifact contracts.Artifact) error {
+	res, err := m.db.ExecContext(ctx, m.dialect.Rebind(`DELETE FROM sp_artifacts WHERE file_id = ? AND uow = ? AND kind = ? AND key = ?`),
+		fileID, artifact.UoW, artifact.Kind, artifact.Key)
+	if err != nil {
+		return fmt.Errorf("delete artifact: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return adapters.ErrNotFound
+	}
+	return nil
+}
+
+// SupersedeArtifacts removes the artifacts uow produced at any version other than version.
+func (m *Metadata) SupersedeArtifacts(ctx context.Context, fileID, uow, version string) ([]contracts.Artifact, error) {
+	var removed []contracts.Artifact
+	err := m.inTx(ctx, func(tx *stdsql.Tx) error {
+		var err error
+		removed, err = m.queryArtifacts(ctx, tx, `WHERE file_id = ? AND uow = ? AND version <> ?`, fileID, uow, version)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, m.dialect.Rebind(`DELETE FROM sp_artifacts WHERE file_id = ? AND uow = ? AND version <> ?`), fileID, uow, version)
+		if err != nil {
+			return fmt.Errorf("supersede artifacts: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// GetFileAttributes returns the stored attributes or adapters.ErrNotFound.
+func (m *Metadata) GetFileAttributes(ctx context.Context, fileID string) (map[string]interface{}, error) {
+	var raw string
+	err := m.db.QueryRowContext(ctx, m.dialect.Rebind(`SELECT CAST(attributes AS TEXT) FROM sp_files WHERE id = ?`), fileID).Scan(&raw)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return nil, adapters.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get attributes: %w", err)
+	}
+
+	attrs := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(raw), &attrs); err != nil {
+		return nil, fmt.Errorf("decode attributes: %w", err)
+	}
+	return attrs, nil
+}
+
+// ListArtifacts returns the file's artifacts in creation order, restricted to kind when non-empty.
+func (m *Metadata) ListArtifacts(ctx context.Context, fileID string, kind string) ([]contracts.Artifact, error) {
+	where := `WHERE file_id = ?`
+	args := []interface{}{fileID}
+	if kind != "" {
+		where += ` AND kind = ?`
+		args = append(args, kind)
+	}
+	return m.queryArtifacts(ctx, m.db, where, args...)
+}
+
+func (m *Metadata) queryArtifacts(ctx context.Context, q queryer, where string, args ...interface{}) ([]contracts.Artifact, error) {
+	rows, err := q.QueryContext(ctx, m.dialect.Rebind(`SELECT uow, kind, key, mime, bytes, location, checksum, job_id, version, created_at
+FROM sp_artifacts `+where+` ORDER BY id`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("list artifacts: %w", err)
+	}
+	defer rows.Close()
+
+	var artifacts []contracts.Artifact
+	for rows.Next() {
+		var a contracts.Artifact
+		if err := rows.Scan(&a.UoW, &a.Kind, &a.Key, &a.MIME, &a.Bytes, &a.Location, &a.Checksum, &a.JobID, &a.Version, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, rows.Err()
+}
+
+// FindFiles returns the sorted IDs of files whose attributes satisfy every predicate.
+// Predicates are evaluated by the database using its JSON operators.
+func (m *Metadata) FindFiles(ctx context.Context, predicates ...adapters.AttributePredicate) ([]string, error) {
+	query := `SELECT id FROM sp_files`
+	var (
+		conds []string
+		args  []interface{}
+	)
+	for _, p := range predicates {
+		cond, condArgs, err := m.predicateSQL(p)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+		args = append(args, condArgs...)
+	}
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, ` AND `)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := m.db.QueryContext(ctx, m.dialect.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("find files: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ScanFiles returns up to limit files with IDs after the given one, in ascending order.
+func (m *Metadata) ScanFiles(ctx context.Context, after string, limit int) ([]adapters.FileRecord, error) {
+	rows, err := m.db.QueryContext(ctx, m.dialect.Rebind(`SELECT id, CAST(attributes AS TEXT) FROM sp_files WHERE id > ? ORDER BY id LIMIT ?`), after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("scan files: %w", err)
+	}
+	defer rows.Close()
+
+	var records []adapters.FileRecord
+	for rows.Next() {
+		var (
+			record adapters.FileRecord
+			raw    string
+		)
+		if err := rows.Scan(&record.ID, &raw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &record.Attributes); err != nil {
+			return nil, fmt.Errorf("decode attributes: %w", err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (m *Metadata) predicateSQL(p adapters.AttributePredicate) (string, []interface{}, error) {
+	switch p.Op {
+	case adapters.OpExists:
+		if m.dialect == Postgres {
+			return `attributes -> ? IS NOT NULL`, []interface{}{p.Key}, nil
+		}
+		return `json_type(attributes, ?) IS NOT NULL`, []interface{}{jsonPath(p.Key)}, nil
+	case adapters.OpEquals:
+		value, err := json.Marshal(p.Value)
+		if err != nil {
+			return "", nil, fmt.Errorf("marshal predicate value: %w", err)
+		}
+		if m.dialect == Postgres {
+			return `attributes -> ? = CAST(? AS JSONB)`, []interface{}{p.Key, string(value)}, nil
+		}
+		return `json_extract(attributes, ?) = json_extract(?, '$')`, []interface{}{jsonPath(p.Key), string(value)}, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported predicate op: %q", p.Op)
+	}
+}
+
+// jsonPath quotes a top-level key so dots and brackets in attribute names are literal.
+func jsonPath(key string) string {
+	return `$."` + strings.ReplaceAll(key, `"`, `\"`) + `"`
+}
+
+func nonNil(attrs map[string]interface{}) map[string]interface{} {
+	if attrs == nil {
+		return map[string]interface{}{}
+	}
+	return attrs
+}
+
+var (
+	_ adapters.Metadata          = (*Metadata)(nil)
+	_ adapters.MetadataReader    = (*Metadata)(nil)
+	_ adapters.VersionedMetadata = (*Metadata)(nil)
+	_ adapters.AttributeAuditor  = (*Metadata)(nil)
+	_ adapters.ArtifactManager   = (*Metadata)(nil)
+)
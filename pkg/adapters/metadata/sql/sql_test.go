@@ -0,0 +1,269 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+	_ "modernc.org/sqlite"
+)
+
+func newTestMetadata(t *testing.T) (*Metadata, *stdsql.DB) {
+	t.Helper()
+	db, err := stdsql.Open("sqlite", filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := New(db, SQLite)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	if err := m.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate error: %v", err)
+	}
+	// Migrations must be idempotent across restarts.
+	if err := m.Migrate(context.Background()); err != nil {
+		t.Fatalf("second Migrate error: %v", err)
+	}
+	return m, db
+}
+
+func TestMetadataMergesAttributePatches(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMetadata(t)
+
+	if err := m.UpdateFileAttributes(ctx, "f1", map[string]interface{}{"sha256": "abc", "mime": "text/plain"}); err != nil {
+		t.Fatalf("UpdateFileAttributes error: %v", err)
+	}
+	if err := m.UpdateFileAttributes(ctx, "f1", map[string]interface{}{"pages": 12, "mime": "application/pdf", "ocr.lang": "en"}); err != nil {
+		t.Fatalf("UpdateFileAttributes error: %v", err)
+	}
+
+	var raw string
+	if err := db.QueryRow(`SELECT attributes FROM sp_files WHERE id = ?`, "f1").Scan(&raw); err != nil {
+		t.Fatalf("query attributes: %v", err)
+	}
+	var attrs map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &attrs); err != nil {
+		t.Fatalf("decode attributes: %v", err)
+	}
+
+	if attrs["sha256"] != "abc" || attrs["mime"] != "application/pdf" || attrs["pages"] != float64(12) || attrs["ocr.lang"] != "en" {
+		t.Fatalf("unexpected merged attributes: %v", attrs)
+	}
+}
+
+func TestMetadataCreatesArtifacts(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMetadata(t)
+
+	artifact := contracts.Artifact{Kind: "checksum", MIME: "text/plain", Bytes: 64, Location: "artifacts/f1.sha256"}
+	if err := m.CreateArtifact(ctx, "f1", artifact); err != nil {
+		t.Fatalf("CreateArtifact error: %v", err)
+	}
+
+	var kind, location string
+	if err := db.QueryRow(`SELECT kind, location FROM sp_artifacts WHERE file_id = ?`, "f1").Scan(&kind, &location); err != nil {
+		t.Fatalf("query artifact: %v", err)
+	}
+	if kind != artifact.Kind || location != artifact.Location {
+		t.Fatalf("unexpected artifact row: %s %s", kind, location)
+	}
+}
+
+func TestMetadataReadsAndQueries(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestMetadata(t)
+
+	m.UpdateFileAttributes(ctx, "f1", map[string]interface{}{"sha256": "abc", "pages": 3})
+	m.UpdateFileAttributes(ctx, "f2", map[string]interface{}{"pages": 3, "flagged": true})
+	m.UpdateFileAttributes(ctx, "f3", map[string]interface{}{"sha256": "def"})
+	m.CreateArtifact(ctx, "f1", contracts.Artifact{Kind: "checksum", Location: "a/f1.sha256"})
+	m.CreateArtifact(ctx, "f1", contracts.Artifact{Kind: "thumbnail", Location: "a/f1.png"})
+
+	attrs, err := m.GetFileAttributes(ctx, "f1")
+	if err != nil {
+		t.Fatalf("GetFileAttributes error: %v", err)
+	}
+	if attrs["sha256"] != "abc" {
+		t.Fatalf("unexpected attributes: %v", attrs)
+	}
+	if _, err := m.GetFileAttributes(ctx, "missing"); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	checksums, err := m.ListArtifacts(ctx, "f1", "checksum")
+	if err != nil || len(checksums) != 1 || checksums[0].Location != "a/f1.sha256" {
+		t.Fatalf("unexpected checksum artifacts: %v %v", checksums, err)
+	}
+	all, _ := m.ListArtifacts(ctx, "f1", "")
+	if len(all) != 2 {
+		t.Fatalf("expected 2 artifacts, got %d", len(all))
+	}
+
+	cases := []struct {
+		predicates []adapters.AttributePredicate
+		want       []string
+	}{
+		{[]adapters.AttributePredicate{adapters.AttributeExists("sha256")}, []string{"f1", "f3"}},
+		{[]adapters.AttributePredicate{adapters.AttributeEquals("pages", 3)}, []string{"f1", "f2"}},
+		{[]adapters.AttributePredicate{adapters.AttributeEquals("flagged", true)}, []string{"f2"}},
+		{[]adapters.AttributePredicate{adapters.AttributeExists("sha256"), adapters.AttributeEquals("pages", 3)}, []string{"f1"}},
+	}
+	for _, tc := range cases {
+		got, err := m.FindFiles(ctx, tc.predicates...)
+		if err != nil {
+			t.Fatalf("FindFiles error: %v", err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("FindFiles(%v) = %v, want %v", tc.predicates, got, tc.want)
+		}
+	}
+
+	page, err := m.ScanFiles(ctx, "f1", 1)
+	if err != nil || len(page) != 1 || page[0].ID != "f2" || page[0].Attributes["flagged"] != true {
+		t.Fatalf("ScanFiles = %+v, %v", page, err)
+	}
+	if page, _ = m.ScanFiles(ctx, "f3", 10); len(page) != 0 {
+		t.Fatalf("expected the scan to end after f3, got %+v", page)
+	}
+}
+
+func TestMetadataMergePatchAndRevisions(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestMetadata(t)
+
+	if _, rev, _ := m.GetFileRevision(ctx, "f1"); rev != 0 {
+		t.Fatalf("expected revision 0 for unknown file, got %d", rev)
+	}
+
+	rev, err := m.UpdateFileAttributesIf(ctx, "f1", 0, map[string]interface{}{
+		"ocr":  map[string]interface{}{"pages": 12, "lang": "en"},
+		"mime": "application/pdf",
+		"tmp":  nil,
+	})
+	if err != nil || rev != 1 {
+		t.Fatalf("first CAS update = %d, %v", rev, err)
+	}
+	if _, err := m.UpdateFileAttributesIf(ctx, "f1", 0, map[string]interface{}{"x": 1}); !errors.Is(err, adapters.ErrConflict) {
+		t.Fatalf("expected ErrConflict creating an existing file, got %v", err)
+	}
+
+	if err := m.UpdateFileAttributes(ctx, "f1", map[string]interface{}{
+		"ocr":  map[string]interface{}{"lang": "de"},
+		"mime": nil,
+	}); err != nil {
+		t.Fatalf("UpdateFileAttributes error: %v", err)
+	}
+
+	attrs, rev, err := m.GetFileRevision(ctx, "f1")
+	if err != nil {
+		t.Fatalf("GetFileRevision error: %v", err)
+	}
+	want := map[string]interface{}{"ocr": map[string]interface{}{"pages": float64(12), "lang": "de"}}
+	if !reflect.DeepEqual(attrs, want) || rev != 2 {
+		t.Fatalf("unexpected state: %#v at revision %d", attrs, rev)
+	}
+
+	if _, err := m.UpdateFileAttributesIf(ctx, "f1", 1, map[string]interface{}{"x": 1}); !errors.Is(err, adapters.ErrConflict) {
+		t.Fatalf("expected ErrConflict for stale revision, got %v", err)
+	}
+	if rev, err := m.UpdateFileAttributesIf(ctx, "f1", 2, map[string]interface{}{"x": 1}); err != nil || rev != 3 {
+		t.Fatalf("CAS update = %d, %v", rev, err)
+	}
+}
+
+func TestMetadataRecordsProvenanceAndHistory(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestMetadata(t)
+
+	ocr := adapters.ContextWithProvenance(ctx, contracts.Provenance{UoW: "ocr", JobID: "job-1", Version: "1.0"})
+	if err := m.UpdateFileAttributes(ocr, "f1", map[string]interface{}{"ocr.pages": 3, "ocr.lang": "en"}); err != nil {
+		t.Fatalf("UpdateFileAttributes error: %v", err)
+	}
+	pdf := adapters.ContextWithProvenance(ctx, contracts.Provenance{UoW: "pdf", JobID: "job-2"})
+	if _, err := m.UpdateFileAttributesIf(pdf, "f1", 1, map[string]interface{}{"ocr.lang": nil, "pdf.pages": 4}); err != nil {
+		t.Fatalf("UpdateFileAttributesIf error: %v", err)
+	}
+
+	provs, err := m.AttributeProvenance(ctx, "f1")
+	if err != nil {
+		t.Fatalf("AttributeProvenance error: %v", err)
+	}
+	if len(provs) != 2 || provs["ocr.pages"].JobID != "job-1" || provs["pdf.pages"].UoW != "pdf" {
+		t.Fatalf("unexpected provenance: %+v", provs)
+	}
+	if provs["ocr.pages"].Timestamp.IsZero() {
+		t.Fatalf("expected provenance timestamp to be recorded")
+	}
+
+	history, err := m.AttributeHistory(ctx, "f1")
+	if err != nil {
+		t.Fatalf("AttributeHistory error: %v", err)
+	}
+	var got []string
+	for _, c := range history {
+		got = append(got, fmt.Sprintf("%d %s %v %t %s", c.Revision, c.Key, c.Value, c.Deleted, c.Provenance.UoW))
+	}
+	want := []string{
+		"1 ocr.lang en false ocr",
+		"1 ocr.pages 3 false ocr",
+		"2 ocr.lang <nil> true pdf",
+		"2 pdf.pages 4 false pdf",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected history:\n%v", got)
+	}
+}
+
+func TestMetadataArtifactIdentity(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestMetadata(t)
+
+	small := contracts.Artifact{UoW: "thumbs", Kind: "thumbnail", Key: "small", Location: "v1/small.png", Version: "1", Checksum: "sha256:aa"}
+	large := contracts.Artifact{UoW: "thumbs", Kind: "thumbnail", Key: "large", Location: "v1/large.png", Version: "1"}
+	for _, a := range []contracts.Artifact{small, large, small} {
+		if err := m.CreateArtifact(ctx, "f1", a); err != nil {
+			t.Fatalf("CreateArtifact error: %v", err)
+		}
+	}
+	small.Location, small.Version, small.JobID = "v2/small.png", "2", "job-2"
+	if err := m.CreateArtifact(ctx, "f1", small); err != nil {
+		t.Fatalf("CreateArtifact error: %v", err)
+	}
+
+	artifacts, err := m.ListArtifacts(ctx, "f1", "thumbnail")
+	if err != nil {
+		t.Fatalf("ListArtifacts error: %v", err)
+	}
+	if len(artifacts) != 2 || artifacts[0].Location != "v2/small.png" || artifacts[0].JobID != "job-2" || artifacts[0].Checksum != "sha256:aa" {
+		t.Fatalf("expected upserted artifacts in creation order, got %+v", artifacts)
+	}
+	if artifacts[0].CreatedAt.IsZero() {
+		t.Fatalf("expected created_at to be stamped")
+	}
+
+	removed, err := m.SupersedeArtifacts(ctx, "f1", "thumbs", "2")
+	if err != nil {
+		t.Fatalf("SupersedeArtifacts error: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Key != "large" {
+		t.Fatalf("unexpected superseded artifacts: %+v", removed)
+	}
+
+	if err := m.DeleteArtifact(ctx, "f1", small); err != nil {
+		t.Fatalf("DeleteArtifact error: %v", err)
+	}
+	if err := m.DeleteArtifact(ctx, "f1", small); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
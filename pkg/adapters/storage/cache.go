@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+)
+
+const cacheFileSuffix = ".blob"
+
+// CacheOptions configures the local disk cache used by CachedStorage.
+type CacheOptions struct {
+	// Dir is a directory dedicated to the cache; leftover cache files are removed on start.
+	Dir string
+	// MaxBytes bounds the total size of cached blobs; least recently used entries are evicted first.
+	MaxBytes int64
+}
+
+// CacheStats reports cache effectiveness counters.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+	// Shared counts misses that waited for a download another caller had started.
+	Shared    int64
+	Evictions int64
+	Bytes     int64
+	Entries   int
+}
+
+// CachedStorage is a read-through cache in front of a Storage backend. Blobs are
+// downloaded once into a local directory and served from disk while the backend's
+// ETag and size still match. Writes go straight to the backend and invalidate the
+// cached copy.
+type CachedStorage struct {
+	inner    adapters.BlobInfoStorage
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	bytes    int64
+	inflight map[string]*cacheFill
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	shared    atomic.Int64
+	evictions atomic.Int64
+}
+
+type cacheEntry struct {
+	location string
+	path     string
+	etag     string
+	size     int64
+	bytes    int64
+}
+
+type cacheFill struct {
+	done  chan struct{}
+	entry *cacheEntry
+	err   error
+}
+
+// NewCachedStorage wraps inner with a disk cache rooted at opts.Dir.
+func NewCachedStorage(inner adapters.BlobInfoStorage, opts CacheOptions) (*CachedStorage, error) {
+	if inner == nil {
+		return nil, errors.New("inner storage is required")
+	}
+	if opts.Dir == "" {
+		return nil, errors.New("cache directory is required")
+	}
+	if opts.MaxBytes <= 0 {
+		return nil, errors.New("cache max bytes must be positive")
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+
+	stale, err := filepath.Glob(filepath.Join(opts.Dir, "*"+cacheFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range stale {
+		os.Remove(path)
+	}
+
+	return &CachedStorage{
+		inner:    inner,
+		dir:      opts.Dir,
+		maxBytes: opts.MaxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*cacheFill),
+	}, nil
+}
+
+// Get serves the blob from the local cache when the backend copy is unchanged,
+// downloading it at most once for concurrent callers otherwise.
+func (s *CachedStorage) Get(ctx context.Context, location string) (io.ReadCloser, error) {
+	info, err := s.inner.Stat(ctx, location)
+	if err != nil {
+		if errors.Is(err, adapters.ErrNotFound) {
+			s.invalidate(location)
+		}
+		return nil, err
+	}
+
+	if reader, ok := s.lookup(location, info); ok {
+		s.hits.Add(1)
+		return reader, nil
+	}
+	if info.Size > s.maxBytes {
+		s.misses.Add(1)
+		return s.inner.Get(ctx, location)
+	}
+
+	entry, err := s.fill(ctx, location, info)
+	if err != nil {
+		return nil, err
+	}
+
+	// The entry may already have been evicted by a concurrent fill; stream from the backend then.
+	if reader, err := os.Open(entry.path); err == nil {
+		return reader, nil
+	}
+	return s.inner.Get(ctx, location)
+}
+
+// Put uploads the blob to the backend and drops any cached copy.
+func (s *CachedStorage) Put(ctx context.Context, location string, reader io.Reader) error {
+	return s.PutWithInfo(ctx, location, reader, adapters.BlobInfo{})
+}
+
+// PutWithInfo uploads the blob with metadata to the backend and drops any cached copy.
+func (s *CachedStorage) PutWithInfo(ctx context.Context, location string, reader io.Reader, info adapters.BlobInfo) error {
+	defer s.invalidate(location)
+	return s.inner.PutWithInfo(ctx, location, reader, info)
+}
+
+// Stat returns the backend metadata for the blob.
+func (s *CachedStorage) Stat(ctx context.Context, location string) (adapters.BlobInfo, error) {
+	return s.inner.Stat(ctx, location)
+}
+
+// PresignGet delegates to the backend so remote workers bypass the local cache.
+func (s *CachedStorage) PresignGet(ctx context.Context, location string) (string, error) {
+	return s.inner.PresignGet(ctx, location)
+}
+
+// PresignPut delegates to the backend; the cached copy is revalidated on the next Get.
+func (s *CachedStorage) PresignPut(ctx context.Context, location string) (string, error) {
+	return s.inner.PresignPut(ctx, location)
+}
+
+// Stats returns a snapshot of the cache counters.
+func (s *CachedStorage) Stats() CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return CacheStats{
+		Hits:      s.hits.Load(),
+		Misses:    s.misses.Load(),
+		Shared:    s.shared.Load(),
+		Evictions: s.evictions.Load(),
+		Bytes:     s.bytes,
+		Entries:   len(s.entries),
+	}
+}
+
+func (s *CachedStorage) lookup(location string, info adapters.BlobInfo) (io.ReadCloser, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[location]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if entry.etag != info.ETag || entry.size != info.Size {
+		s.removeLocked(elem)
+		return nil, false
+	}
+
+	reader, err := os.Open(entry.path)
+	if err != nil {
+		s.removeLocked(elem)
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	return reader, true
+}
+
+// fill downloads the blob into the cache once for all concurrent callers. The
+// download is detached from the callers' contexts, so a cancelled caller only
+// stops waiting and the others still get the blob.
+func (s *CachedStorage) fill(ctx context.Context, location string, info adapters.BlobInfo) (*cacheEntry, error) {
+	key := location + "\x00" + info.ETag
+
+	s.mu.Lock()
+	call, ok := s.inflight[key]
+	if ok {
+		s.shared.Add(1)
+	} else {
+		call = &cacheFill{done: make(chan struct{})}
+		s.inflight[key] = call
+		s.misses.Add(1)
+		go s.download(context.WithoutCancel(ctx), key, call, location, info)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.entry, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *CachedStorage) download(ctx context.Context, key string, call *cacheFill, location string, info adapters.BlobInfo) {
+	call.entry, call.err = s.fetch(ctx, location, info)
+
+	s.mu.Lock()
+	delete(s.inflight, key)
+	if call.err == nil {
+		s.insertLocked(call.entry)
+	}
+	s.mu.Unlock()
+	close(call.done)
+}
+
+func (s *CachedStorage) fetch(ctx context.Context, location string, info adapters.BlobInfo) (*cacheEntry, error) {
+	body, err := s.inner.Get(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(s.dir, "fill-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(location + "\x00" + info.ETag))
+	path := filepath.Join(s.dir, fmt.Sprintf("%x%s", sum, cacheFileSuffix))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	return &cacheEntry{
+		location: location,
+		path:     path,
+		etag:     info.ETag,
+		size:     info.Size,
+		bytes:    written,
+	}, nil
+}
+
+func (s *CachedStorage) insertLocked(entry *cacheEntry) {
+	if elem, ok := s.entries[entry.location]; ok {
+		if elem.Value.(*cacheEntry).path == entry.path {
+			// Same content was refilled; keep the file that was just written.
+			s.lru.Remove(elem)
+			delete(s.entries, entry.location)
+			s.bytes -= elem.Value.(*cacheEntry).bytes
+		} else {
+			s.removeLocked(elem)
+		}
+	}
+	if entry.bytes > s.maxBytes {
+		os.Remove(entry.path)
+		return
+	}
+
+	s.entries[entry.location] = s.lru.PushFront(entry)
+	s.bytes += entry.bytes
+
+	for s.bytes > s.maxBytes {
+		oldest := s.lru.Back()
+		if oldest == nil {
+			break
+		}
+		s.removeLocked(oldest)
+		s.evictions.Add(1)
+	}
+}
+
+func (s *CachedStorage) invalidate(location string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[location]; ok {
+		s.removeLocked(elem)
+	}
+}
+
+func (s *CachedStorage) removeLocked(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	s.lru.Remove(elem)
+	delete(s.entries, entry.location)
+	s.bytes -= entry.bytes
+	// Readers that already opened the file keep their handle after removal.
+	os.Remove(entry.path)
+}
+
+var _ adapters.BlobInfoStorage = (*CachedStorage)(nil)
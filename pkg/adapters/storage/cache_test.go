@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+)
+
+type countingStorage struct {
+	*InMemoryStorage
+	gets atomic.Int64
+}
+
+func (s *countingStorage) Get(ctx context.Context, location string) (io.ReadCloser, error) {
+	s.gets.Add(1)
+	return s.InMemoryStorage.Get(ctx, location)
+}
+
+var _ adapters.BlobInfoStorage = (*countingStorage)(nil)
+
+func TestCachedStorageDeduplicatesDownloads(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStorage{InMemoryStorage: NewInMemoryStorage()}
+	cache, err := NewCachedStorage(inner, CacheOptions{Dir: t.TempDir(), MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("NewCachedStorage error: %v", err)
+	}
+
+	if err := inner.Put(ctx, "video.mp4", strings.NewReader("frame data")); err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader, err := cache.Get(ctx, "video.mp4")
+			if err != nil {
+				t.Errorf("Get error: %v", err)
+				return
+			}
+			defer reader.Close()
+			data, _ := io.ReadAll(reader)
+			if string(data) != "frame data" {
+				t.Errorf("unexpected content: %q", data)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := inner.gets.Load(); got != 1 {
+		t.Fatalf("expected a single backend download, got %d", got)
+	}
+	stats := cache.Stats()
+	if stats.Misses != 1 || stats.Hits+stats.Shared != 7 || stats.Entries != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// Changing the backend blob invalidates the cached copy via its ETag.
+	if err := inner.Put(ctx, "video.mp4", strings.NewReader("new frames")); err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+	reader, err := cache.Get(ctx, "video.mp4")
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "new frames" {
+		t.Fatalf("expected refreshed content, got %q", data)
+	}
+	if got := inner.gets.Load(); got != 2 {
+		t.Fatalf("expected a second download after change, got %d", got)
+	}
+}
+
+func TestCachedStorageEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	inner := NewInMemoryStorage()
+	cache, err := NewCachedStorage(inner, CacheOptions{Dir: t.TempDir(), MaxBytes: 10})
+	if err != nil {
+		t.Fatalf("NewCachedStorage error: %v", err)
+	}
+
+	for _, location := range []string{"a", "b", "c"} {
+		if err := inner.Put(ctx, location, strings.NewReader("12345")); err != nil {
+			t.Fatalf("Put error: %v", err)
+		}
+	}
+
+	for _, location := range []string{"a", "b", "a", "c"} {
+		reader, err := cache.Get(ctx, location)
+		if err != nil {
+			t.Fatalf("Get error: %v", err)
+		}
+		reader.Close()
+	}
+
+	stats := cache.Stats()
+	if stats.Evictions != 1 || stats.Bytes != 10 || stats.Hits != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// "b" was least recently used and must be downloaded again.
+	reader, err := cache.Get(ctx, "b")
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	reader.Close()
+	if got := cache.Stats().Misses; got != 4 {
+		t.Fatalf("expected b to miss after eviction, misses=%d", got)
+	}
+}
+
+type blockingStorage struct {
+	*InMemoryStorage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStorage) Get(ctx context.Context, location string) (io.ReadCloser, error) {
+	close(s.started)
+	<-s.release
+	return s.InMemoryStorage.Get(ctx, location)
+}
+
+func TestCachedStorageFillSurvivesCancelledCaller(t *testing.T) {
+	inner := &blockingStorage{InMemoryStorage: NewInMemoryStorage(), started: make(chan struct{}), release: make(chan struct{})}
+	cache, _ := NewCachedStorage(inner, CacheOptions{Dir: t.TempDir(), MaxBytes: 1 << 20})
+	inner.Put(context.Background(), "video.mp4", strings.NewReader("frame data"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := cache.Get(ctx, "video.mp4")
+		first <- err
+	}()
+	<-inner.started
+	second := make(chan string, 1)
+	go func() {
+		reader, err := cache.Get(context.Background(), "video.mp4")
+		if err != nil {
+			second <- err.Error()
+			return
+		}
+		defer reader.Close()
+		data, _ := io.ReadAll(reader)
+		second <- string(data)
+	}()
+	for cache.Stats().Shared != 1 {
+		runtime.Gosched()
+	}
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancelled caller to stop waiting, got %v", err)
+	}
+	close(inner.release)
+	if got := <-second; got != "frame data" {
+		t.Fatalf("expected the other caller to get the blob, got %q", got)
+	}
+	if stats := cache.Stats(); stats.Misses != 1 || stats.Shared != 1 || stats.Hits != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
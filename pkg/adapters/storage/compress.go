@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/tendant/simple-process/pkg/adapters"
+)
+
+// Encodings recorded in adapters.BlobInfo.ContentEncoding by CompressedStorage.
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+const sniffLen = 512
+
+// CompressionOptions controls which blobs CompressedStorage compresses.
+type CompressionOptions struct {
+	// Encoding selects the codec; defaults to gzip, which every HTTP client can decode.
+	Encoding string
+	// MinSize is the smallest blob, in bytes, worth compressing; defaults to 1 KiB.
+	MinSize int
+	// ContentTypes lists media type prefixes treated as compressible.
+	ContentTypes []string
+}
+
+// DefaultCompressibleTypes are the media type prefixes compressed when none are configured.
+var DefaultCompressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/xml",
+	"application/x-ndjson",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+// CompressedStorage wraps a Storage backend and transparently compresses blobs on Put
+// and decompresses them on Get. The chosen encoding is recorded in the blob's
+// BlobInfo so uncompressed blobs written by other clients are returned untouched.
+type CompressedStorage struct {
+	inner adapters.BlobInfoStorage
+	opts  CompressionOptions
+}
+
+// NewCompressedStorage wraps inner with compression using the supplied options.
+func NewCompressedStorage(inner adapters.BlobInfoStorage, opts CompressionOptions) (*CompressedStorage, error) {
+	if inner == nil {
+		return nil, errors.New("inner storage is required")
+	}
+	switch opts.Encoding {
+	case "":
+		opts.Encoding = EncodingGzip
+	case EncodingGzip, EncodingZstd:
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", opts.Encoding)
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = 1024
+	}
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = DefaultCompressibleTypes
+	}
+	return &CompressedStorage{inner: inner, opts: opts}, nil
+}
+
+// Get returns a reader yielding the original, decompressed blob content.
+func (s *CompressedStorage) Get(ctx context.Context, location string) (io.ReadCloser, error) {
+	info, err := s.inner.Stat(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := s.inner.Get(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(body, info.ContentEncoding)
+}
+
+// decode wraps body with a decompressor for encoding. Unknown and empty encodings
+// are returned unchanged.
+func decode(body io.ReadCloser, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			body.Close()
+			return nil, fmt.Errorf("open gzip stream: %w", err)
+		}
+		return &decodingReader{Reader: zr, closers: []func() error{zr.Close, body.Close}}, nil
+	case EncodingZstd:
+		zr, err := zstd.NewReader(body)
+		if err != nil {
+			body.Close()
+			return nil, fmt.Errorf("open zstd stream: %w", err)
+		}
+		return &decodingReader{Reader: zr, closers: []func() error{func() error { zr.Close(); return nil }, body.Close}}, nil
+	default:
+		return body, nil
+	}
+}
+
+// Put compresses the blob when it is large enough and of a compressible type.
+func (s *CompressedStorage) Put(ctx context.Context, location string, reader io.Reader) error {
+	return s.PutWithInfo(ctx, location, reader, adapters.BlobInfo{})
+}
+
+// PutWithInfo behaves like Put but honours a caller supplied content type instead of sniffing one.
+func (s *CompressedStorage) PutWithInfo(ctx context.Context, location string, reader io.Reader, info adapters.BlobInfo) error {
+	peekLen := s.opts.MinSize
+	if peekLen < sniffLen {
+		peekLen = sniffLen
+	}
+
+	head := make([]byte, peekLen)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+	body := io.MultiReader(bytes.NewReader(head), reader)
+
+	if info.ContentType == "" {
+		info.ContentType = http.DetectContentType(head)
+	}
+
+	// Blobs that are already encoded, too small or not compressible are stored as-is.
+	if info.ContentEncoding != "" || n < s.opts.MinSize || !s.compressible(info.ContentType) {
+		return s.inner.PutWithInfo(ctx, location, body, info)
+	}
+
+	info.ContentEncoding = s.opts.Encoding
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.encode(pw, body))
+	}()
+
+	err = s.inner.PutWithInfo(ctx, location, pr, info)
+	pr.CloseWithError(err)
+	return err
+}
+
+// Stat returns the metadata recorded for the stored, possibly compressed, blob.
+func (s *CompressedStorage) Stat(ctx context.Context, location string) (adapters.BlobInfo, error) {
+	return s.inner.Stat(ctx, location)
+}
+
+// PresignGet delegates to the wrapped backend. Backends that serve the recorded
+// content encoding as a Content-Encoding header (such as S3) let HTTP clients
+// decompress gzip blobs transparently; zstd requires a zstd-aware client.
+func (s *CompressedStorage) PresignGet(ctx context.Context, location string) (string, error) {
+	return s.inner.PresignGet(ctx, location)
+}
+
+// PresignPut delegates to the wrapped backend. Blobs uploaded through the URL are
+// stored as sent and read back without decompression.
+func (s *CompressedStorage) PresignPut(ctx context.Context, location string) (string, error) {
+	return s.inner.PresignPut(ctx, location)
+}
+
+func (s *CompressedStorage) compressible(contentType string) bool {
+	for _, prefix := range s.opts.ContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CompressedStorage) encode(w io.Writer, r io.Reader) error {
+	var enc io.WriteCloser
+	switch s.opts.Encoding {
+	case EncodingZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		enc = zw
+	default:
+		enc = gzip.NewWriter(w)
+	}
+
+	if _, err := io.Copy(enc, r); err != nil {
+		enc.Close()
+		return err
+	}
+	return enc.Close()
+}
+
+type decodingReader struct {
+	io.Reader
+	closers []func() error
+}
+
+func (r *decodingReader) Close() error {
+	var firstErr error
+	for _, closeFn := range r.closers {
+		if err := closeFn(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+var _ adapters.BlobInfoStorage = (*CompressedStorage)(nil)
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressedStorageRoundTrip(t *testing.T) {
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} {
+		t.Run(encoding, func(t *testing.T) {
+			ctx := context.Background()
+			inner := NewInMemoryStorage()
+			store, err := NewCompressedStorage(inner, CompressionOptions{Encoding: encoding})
+			if err != nil {
+				t.Fatalf("NewCompressedStorage error: %v", err)
+			}
+
+			content := strings.Repeat("a transcript line that repeats\n", 200)
+			if err := store.Put(ctx, "transcript.txt", strings.NewReader(content)); err != nil {
+				t.Fatalf("Put error: %v", err)
+			}
+
+			info, err := inner.Stat(ctx, "transcript.txt")
+			if err != nil {
+				t.Fatalf("Stat error: %v", err)
+			}
+			if info.ContentEncoding != encoding {
+				t.Fatalf("expected encoding %s, got %q", encoding, info.ContentEncoding)
+			}
+			if info.Size >= int64(len(content)) {
+				t.Fatalf("expected compressed size below %d, got %d", len(content), info.Size)
+			}
+
+			reader, err := store.Get(ctx, "transcript.txt")
+			if err != nil {
+				t.Fatalf("Get error: %v", err)
+			}
+			defer reader.Close()
+
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("read error: %v", err)
+			}
+			if string(got) != content {
+				t.Fatalf("round trip mismatch")
+			}
+
+			// Presigned URLs must yield the content too, not the stored compressed bytes.
+			url, err := store.PresignGet(ctx, "transcript.txt")
+			if err != nil {
+				t.Fatalf("PresignGet error: %v", err)
+			}
+			presigned, err := OpenPresigned(ctx, nil, url)
+			if err != nil {
+				t.Fatalf("OpenPresigned error: %v", err)
+			}
+			defer presigned.Close()
+			if got, err := io.ReadAll(presigned); err != nil || string(got) != content {
+				t.Fatalf("presigned read mismatch: %v", err)
+			}
+		})
+	}
+}
+
+func TestCompressedStorageSkipsSmallAndBinaryBlobs(t *testing.T) {
+	ctx := context.Background()
+	inner := NewInMemoryStorage()
+	store, err := NewCompressedStorage(inner, CompressionOptions{})
+	if err != nil {
+		t.Fatalf("NewCompressedStorage error: %v", err)
+	}
+
+	if err := store.Put(ctx, "small.txt", strings.NewReader("tiny")); err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+	binary := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 4096)
+	if err := store.Put(ctx, "image.png", strings.NewReader(binary)); err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+
+	for _, location := range []string{"small.txt", "image.png"} {
+		info, err := inner.Stat(ctx, location)
+		if err != nil {
+			t.Fatalf("Stat error: %v", err)
+		}
+		if info.ContentEncoding != "" {
+			t.Fatalf("expected %s to be stored uncompressed, got %q", location, info.ContentEncoding)
+		}
+	}
+
+	reader, err := store.Get(ctx, "small.txt")
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	defer reader.Close()
+	got, _ := io.ReadAll(reader)
+	if string(got) != "tiny" {
+		t.Fatalf("unexpected content: %q", got)
+	}
+}
@@ -0,0 +1,538 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+const (
+	fsInfoDir = ".info"
+	// fsUploadsDir holds the parts of unfinished multipart uploads, inside fsInfoDir
+	// so that no blob location can reach it.
+	fsUploadsDir = "uploads"
+	// fsMaxParts matches the S3 limit on parts per multipart upload.
+	fsMaxParts = 10000
+)
+
+// FSConfig configures a filesystem-backed storage adapter.
+type FSConfig struct {
+	// Root is the directory blobs are stored under.
+	Root string
+	// BaseURL is the public address where Handler is mounted; required for presigning.
+	BaseURL string
+	// Secret signs presigned URLs; required for presigning.
+	Secret []byte
+	// PresignExpiry bounds how long presigned URLs stay valid; defaults to 15 minutes.
+	PresignExpiry time.Duration
+}
+
+// FSStorage stores blobs as files on local disk. When configured with a BaseURL
+// and Secret it issues HMAC-signed URLs that its Handler serves, mirroring the
+// presigned GET/PUT/POST flows of object stores for local development and tests.
+type FSStorage struct {
+	root    string
+	baseURL string
+	secret  []byte
+	expiry  time.Duration
+	now     func() time.Time
+}
+
+// NewFSStorage creates the root directory if needed and returns the adapter.
+func NewFSStorage(cfg FSConfig) (*FSStorage, error) {
+	if cfg.Root == "" {
+		return nil, errors.New("root directory is required")
+	}
+	if err := os.MkdirAll(cfg.Root, 0o755); err != nil {
+		return nil, fmt.Errorf("create root dir: %w", err)
+	}
+	if cfg.PresignExpiry <= 0 {
+		cfg.PresignExpiry = 15 * time.Minute
+	}
+	return &FSStorage{
+		root:    cfg.Root,
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		secret:  cfg.Secret,
+		expiry:  cfg.PresignExpiry,
+		now:     time.Now,
+	}, nil
+}
+
+// Get returns a reader for the given blob location.
+func (s *FSStorage) Get(ctx context.Context, location string) (io.ReadCloser, error) {
+	p, err := s.path(location)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, adapters.ErrNotFound
+	}
+	return f, err
+}
+
+// Put uploads a blob from a reader to the given location.
+func (s *FSStorage) Put(ctx context.Context, location string, reader io.Reader) error {
+	return s.PutWithInfo(ctx, location, reader, adapters.BlobInfo{})
+}
+
+// PutWithInfo writes the blob atomically and records its content type and encoding.
+func (s *FSStorage) PutWithInfo(ctx context.Context, location string, reader io.Reader, info adapters.BlobInfo) error {
+	p, err := s.path(location)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(p, reader); err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(fsBlobInfo{ContentType: info.ContentType, ContentEncoding: info.ContentEncoding})
+	if err != nil {
+		return err
+	}
+	infoPath := s.infoPath(location)
+	if err := os.MkdirAll(filepath.Dir(infoPath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(infoPath, meta, 0o644)
+}
+
+// Stat returns the size, a modification-based ETag and the recorded content headers.
+func (s *FSStorage) Stat(ctx context.Context, location string) (adapters.BlobInfo, error) {
+	p, err := s.path(location)
+	if err != nil {
+		return adapters.BlobInfo{}, err
+	}
+	fi, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return adapters.BlobInfo{}, adapters.ErrNotFound
+	}
+	if err != nil {
+		return adapters.BlobInfo{}, err
+	}
+
+	info := adapters.BlobInfo{
+		Size: fi.Size(),
+		ETag: fmt.Sprintf("%x-%x", fi.ModTime().UnixNano(), fi.Size()),
+	}
+	if data, err := os.ReadFile(s.infoPath(location)); err == nil {
+		var meta fsBlobInfo
+		if json.Unmarshal(data, &meta) == nil {
+			info.ContentType = meta.ContentType
+			info.ContentEncoding = meta.ContentEncoding
+		}
+	}
+	return info, nil
+}
+
+// PresignGet returns a signed URL served by Handler.
+func (s *FSStorage) PresignGet(ctx context.Context, location string) (string, error) {
+	return s.presign(http.MethodGet, location, s.expiry)
+}
+
+// PresignGetWithExpiry returns a signed download URL valid for ttl.
+func (s *FSStorage) PresignGetWithExpiry(ctx context.Context, location string, ttl time.Duration) (string, error) {
+	return s.presign(http.MethodGet, location, ttl)
+}
+
+// PresignPut returns a signed URL that accepts an HTTP PUT served by Handler.
+func (s *FSStorage) PresignPut(ctx context.Context, location string) (string, error) {
+	return s.presign(http.MethodPut, location, s.expiry)
+}
+
+// PresignUpload grants form-upload access to every location under prefix. The
+// prefix is treated as a directory: "jobs/1" grants "jobs/1/..." but not "jobs/10/...".
+func (s *FSStorage) PresignUpload(ctx context.Context, prefix string) (contracts.ArtifactUpload, error) {
+	if err := s.canPresign(); err != nil {
+		return contracts.ArtifactUpload{}, err
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return contracts.ArtifactUpload{}, errors.New("upload prefix is required")
+	}
+	prefix += "/"
+	expires := s.now().Add(s.expiry)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+
+	return contracts.ArtifactUpload{
+		Prefix:    prefix,
+		KeyPrefix: prefix,
+		URL:       s.baseURL + "/",
+		Fields: map[string]string{
+			"prefix":    prefix,
+			"expires":   exp,
+			"signature": s.sign(http.MethodPost, prefix, exp),
+		},
+		Expires: expires.UTC(),
+	}, nil
+}
+
+// PresignMultipart starts a multipart upload and signs a PUT URL for each part.
+// Parts are staged on disk until CompleteMultipart assembles them.
+func (s *FSStorage) PresignMultipart(ctx context.Context, location string, parts int) (adapters.MultipartUpload, error) {
+	if err := s.canPresign(); err != nil {
+		return adapters.MultipartUpload{}, err
+	}
+	if parts <= 0 || parts > fsMaxParts {
+		return adapters.MultipartUpload{}, fmt.Errorf("part count must be between 1 and %d, got %d", fsMaxParts, parts)
+	}
+	location = strings.TrimLeft(location, "/")
+	if _, err := s.path(location); err != nil {
+		return adapters.MultipartUpload{}, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return adapters.MultipartUpload{}, err
+	}
+	upload := adapters.MultipartUpload{Location: location, UploadID: hex.EncodeToString(id)}
+	dir, _ := s.uploadDir(upload.UploadID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return adapters.MultipartUpload{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "location"), []byte(location), 0o644); err != nil {
+		return adapters.MultipartUpload{}, err
+	}
+
+	exp := strconv.FormatInt(s.now().Add(s.expiry).Unix(), 10)
+	for i := 1; i <= parts; i++ {
+		number := strconv.Itoa(i)
+		query := url.Values{}
+		query.Set("uploadId", upload.UploadID)
+		query.Set("partNumber", number)
+		query.Set("expires", exp)
+		query.Set("signature", s.sign(http.MethodPut, partTarget(location, upload.UploadID, number), exp))
+		upload.PartURLs = append(upload.PartURLs, s.baseURL+"/"+(&url.URL{Path: location}).EscapedPath()+"?"+query.Encode())
+	}
+	return upload, nil
+}
+
+// CompleteMultipart checks each part against its ETag and writes them, in
+// order, to the upload's location.
+func (s *FSStorage) CompleteMultipart(ctx context.Context, upload adapters.MultipartUpload, parts []adapters.CompletedPart) error {
+	dir, err := s.openUpload(upload)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return errors.New("at least one part is required")
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for i, part := range parts {
+		if i > 0 && part.Number <= parts[i-1].Number {
+			return errors.New("parts must be in ascending order")
+		}
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(int(part.Number))))
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("part %d was not uploaded", part.Number)
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		etag, err := partETag(f)
+		if err != nil {
+			return err
+		}
+		if etag != strings.Trim(part.ETag, `"`) {
+			return fmt.Errorf("part %d does not match its ETag", part.Number)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		readers = append(readers, f)
+	}
+
+	if err := s.Put(ctx, upload.Location, io.MultiReader(readers...)); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// AbortMultipart discards an unfinished multipart upload and its parts.
+func (s *FSStorage) AbortMultipart(ctx context.Context, upload adapters.MultipartUpload) error {
+	dir, err := s.openUpload(upload)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// Handler serves presigned GET, PUT and form POST requests. Mount it at BaseURL,
+// stripping any path prefix so the request path is the blob location.
+func (s *FSStorage) Handler() http.Handler {
+	return http.HandlerFunc(s.serveHTTP)
+}
+
+func (s *FSStorage) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	location := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !s.verify(http.MethodGet, location, query.Get("expires"), query.Get("signature")) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		s.serveBlob(w, r, location)
+	case http.MethodPut:
+		if query.Has("uploadId") {
+			s.servePart(w, r, location)
+			return
+		}
+		if !s.verify(http.MethodPut, location, query.Get("expires"), query.Get("signature")) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		info := adapters.BlobInfo{ContentType: r.Header.Get("Content-Type"), ContentEncoding: r.Header.Get("Content-Encoding")}
+		if err := s.PutWithInfo(r.Context(), location, r.Body, info); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPost:
+		s.serveFormUpload(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *FSStorage) serveBlob(w http.ResponseWriter, r *http.Request, location string) {
+	info, err := s.Stat(r.Context(), location)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	f, err := s.Get(r.Context(), location)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if info.ContentEncoding != "" {
+		w.Header().Set("Content-Encoding", info.ContentEncoding)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("ETag", strconv.Quote(info.ETag))
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.Copy(w, f)
+}
+
+// servePart stages one part of a multipart upload and returns its ETag.
+func (s *FSStorage) servePart(w http.ResponseWriter, r *http.Request, location string) {
+	query := r.URL.Query()
+	upload := adapters.MultipartUpload{Location: location, UploadID: query.Get("uploadId")}
+	number := query.Get("partNumber")
+	if !s.verify(http.MethodPut, partTarget(location, upload.UploadID, number), query.Get("expires"), query.Get("signature")) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	dir, err := s.openUpload(upload)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	hash := sha256.New()
+	if err := writeFileAtomic(filepath.Join(dir, number), io.TeeReader(r.Body, hash)); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("ETag", strconv.Quote(hex.EncodeToString(hash.Sum(nil))))
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveFormUpload streams the "file" part of a form POST; all other fields must precede it.
+func (s *FSStorage) serveFormUpload(w http.ResponseWriter, r *http.Request) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	fields := make(map[string]string)
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+
+		// The signed prefix ends in "/", so a sibling such as "jobs/10" never matches "jobs/1/".
+		prefix := fields["prefix"]
+		key := strings.TrimPrefix(path.Clean("/"+fields["key"]), "/")
+		if !s.verify(http.MethodPost, prefix, fields["expires"], fields["signature"]) ||
+			prefix == "/" || !strings.HasSuffix(prefix, "/") || !strings.HasPrefix(key, prefix) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		contentType := fields["Content-Type"]
+		if contentType == "" {
+			contentType = part.Header.Get("Content-Type")
+		}
+		if err := s.PutWithInfo(r.Context(), key, part, adapters.BlobInfo{ContentType: contentType}); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
+
+func (s *FSStorage) presign(method, location string, ttl time.Duration) (string, error) {
+	if err := s.canPresign(); err != nil {
+		return "", err
+	}
+	location = strings.TrimLeft(location, "/")
+	if _, err := s.path(location); err != nil {
+		return "", err
+	}
+	exp := strconv.FormatInt(s.now().Add(ttl).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", exp)
+	query.Set("signature", s.sign(method, location, exp))
+	return s.baseURL + "/" + (&url.URL{Path: location}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+func (s *FSStorage) canPresign() error {
+	if s.baseURL == "" || len(s.secret) == 0 {
+		return fmt.Errorf("fs storage presigning requires a base URL and secret: %w", adapters.ErrUnsupported)
+	}
+	return nil
+}
+
+func (s *FSStorage) sign(method, target, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(method + "\n" + target + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *FSStorage) verify(method, target, expires, signature string) bool {
+	if len(s.secret) == 0 || expires == "" || signature == "" {
+		return false
+	}
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || s.now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.sign(method, target, expires)))
+}
+
+func (s *FSStorage) path(location string) (string, error) {
+	clean := path.Clean("/" + strings.TrimLeft(location, "/"))
+	if clean == "/" || strings.HasPrefix(clean, "/"+fsInfoDir+"/") || clean == "/"+fsInfoDir {
+		return "", fmt.Errorf("invalid location: %q", location)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+// uploadDir returns where the parts of upload id are staged.
+func (s *FSStorage) uploadDir(id string) (string, error) {
+	if len(id) != 32 || strings.Trim(id, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid upload id: %q", id)
+	}
+	return filepath.Join(s.root, fsInfoDir, fsUploadsDir, id), nil
+}
+
+// openUpload returns the staging directory of an upload started for upload.Location.
+func (s *FSStorage) openUpload(upload adapters.MultipartUpload) (string, error) {
+	dir, err := s.uploadDir(upload.UploadID)
+	if err != nil {
+		return "", err
+	}
+	location, err := os.ReadFile(filepath.Join(dir, "location"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", adapters.ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if string(location) != strings.TrimLeft(upload.Location, "/") {
+		return "", adapters.ErrNotFound
+	}
+	return dir, nil
+}
+
+func partTarget(location, uploadID, number string) string {
+	return location + "?uploadId=" + uploadID + "&partNumber=" + number
+}
+
+func partETag(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *FSStorage) infoPath(location string) string {
+	clean := path.Clean("/" + strings.TrimLeft(location, "/"))
+	return filepath.Join(s.root, fsInfoDir, filepath.FromSlash(clean)+".json")
+}
+
+type fsBlobInfo struct {
+	ContentType     string `json:"content_type,omitempty"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+}
+
+func writeFileAtomic(p string, reader io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+var (
+	_ adapters.BlobInfoStorage    = (*FSStorage)(nil)
+	_ adapters.ExpiringPresigner  = (*FSStorage)(nil)
+	_ adapters.UploadPresigner    = (*FSStorage)(nil)
+	_ adapters.MultipartPresigner = (*FSStorage)(nil)
+)
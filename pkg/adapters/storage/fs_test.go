@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+)
+
+func newTestFSStorage(t *testing.T) (*FSStorage, *httptest.Server) {
+	t.Helper()
+	store, err := NewFSStorage(FSConfig{Root: t.TempDir(), Secret: []byte("test-secret")})
+	if err != nil {
+		t.Fatalf("NewFSStorage error: %v", err)
+	}
+	server := httptest.NewServer(store.Handler())
+	t.Cleanup(server.Close)
+	store.baseURL = server.URL
+	return store, server
+}
+
+func TestFSStoragePresignedPutAndGet(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestFSStorage(t)
+
+	putURL, err := store.PresignPut(ctx, "artifacts/f1/ocr.txt")
+	if err != nil {
+		t.Fatalf("PresignPut error: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodPut, putURL, strings.NewReader("page one"))
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected PUT status: %s", resp.Status)
+	}
+
+	getURL, err := store.PresignGet(ctx, "artifacts/f1/ocr.txt")
+	if err != nil {
+		t.Fatalf("PresignGet error: %v", err)
+	}
+	resp, err = http.Get(getURL)
+	if err != nil {
+		t.Fatalf("GET error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "page one" || resp.Header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("unexpected GET response: %q %s", body, resp.Header.Get("Content-Type"))
+	}
+
+	// A PUT signature must not authorise reads of the same location.
+	resp, err = http.Get(putURL)
+	if err != nil {
+		t.Fatalf("GET error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected forbidden, got %s", resp.Status)
+	}
+}
+
+func TestFSStorageUploadArtifactScopedToPrefix(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestFSStorage(t)
+
+	upload, err := store.PresignUpload(ctx, "artifacts/job-1/")
+	if err != nil {
+		t.Fatalf("PresignUpload error: %v", err)
+	}
+
+	location, err := UploadArtifact(ctx, nil, upload, "thumb.txt", strings.NewReader("thumbnail"))
+	if err != nil {
+		t.Fatalf("UploadArtifact error: %v", err)
+	}
+	if location != "artifacts/job-1/thumb.txt" {
+		t.Fatalf("unexpected location: %s", location)
+	}
+
+	reader, err := store.Get(ctx, location)
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "thumbnail" {
+		t.Fatalf("unexpected content: %q", data)
+	}
+
+	if _, err := UploadArtifact(ctx, nil, upload, "../escape.txt", strings.NewReader("x")); err == nil {
+		t.Fatalf("expected upload outside prefix to be rejected")
+	}
+
+	store.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := UploadArtifact(ctx, nil, upload, "late.txt", strings.NewReader("x")); err == nil {
+		t.Fatalf("expected expired upload to be rejected")
+	}
+}
+
+func TestFSStorageUploadPrefixIsADirectory(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestFSStorage(t)
+
+	if _, err := store.PresignUpload(ctx, "/"); err == nil {
+		t.Fatalf("expected an empty prefix to be rejected")
+	}
+	upload, err := store.PresignUpload(ctx, "artifacts/job-1")
+	if err != nil {
+		t.Fatalf("PresignUpload error: %v", err)
+	}
+	if upload.Prefix != "artifacts/job-1/" {
+		t.Fatalf("unexpected prefix: %s", upload.Prefix)
+	}
+	if location, err := UploadArtifact(ctx, nil, upload, "thumb.txt", strings.NewReader("x")); err != nil || location != "artifacts/job-1/thumb.txt" {
+		t.Fatalf("UploadArtifact = %s, %v", location, err)
+	}
+
+	// The signature for job-1 must not reach its sibling job-10.
+	sibling := upload
+	sibling.Prefix, sibling.KeyPrefix = "artifacts/job-10/", "artifacts/job-10/"
+	if _, err := UploadArtifact(ctx, nil, sibling, "thumb.txt", strings.NewReader("x")); err == nil {
+		t.Fatalf("expected upload to a sibling prefix to be rejected")
+	}
+}
+
+func TestFSStorageMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestFSStorage(t)
+
+	upload, err := store.PresignMultipart(ctx, "videos/f1/raw.mp4", 3)
+	if err != nil {
+		t.Fatalf("PresignMultipart error: %v", err)
+	}
+	if len(upload.PartURLs) != 3 {
+		t.Fatalf("expected 3 part URLs, got %d", len(upload.PartURLs))
+	}
+
+	// Parts may arrive in any order; the ETags come back for CompleteMultipart.
+	parts := make([]adapters.CompletedPart, 3)
+	for _, i := range []int{2, 0, 1} {
+		req, _ := http.NewRequest(http.MethodPut, upload.PartURLs[i], strings.NewReader(fmt.Sprintf("part%d;", i+1)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PUT part error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected part status: %s", resp.Status)
+		}
+		parts[i] = adapters.CompletedPart{Number: int32(i + 1), ETag: resp.Header.Get("ETag")}
+	}
+
+	// A part URL is bound to its upload, location and part number.
+	tampered := strings.Replace(upload.PartURLs[0], "partNumber=1", "partNumber=4", 1)
+	req, _ := http.NewRequest(http.MethodPut, tampered, strings.NewReader("x"))
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a tampered part URL to be forbidden, got %v %v", resp, err)
+	}
+
+	bad := []adapters.CompletedPart{parts[0], {Number: 2, ETag: `"wrong"`}, parts[2]}
+	if err := store.CompleteMultipart(ctx, upload, bad); err == nil {
+		t.Fatalf("expected a mismatched ETag to be rejected")
+	}
+	if err := store.CompleteMultipart(ctx, upload, parts); err != nil {
+		t.Fatalf("CompleteMultipart error: %v", err)
+	}
+	reader, err := store.Get(ctx, "videos/f1/raw.mp4")
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "part1;part2;part3;" {
+		t.Fatalf("unexpected content: %q", data)
+	}
+	if err := store.CompleteMultipart(ctx, upload, parts); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("expected a completed upload to be gone, got %v", err)
+	}
+
+	aborted, _ := store.PresignMultipart(ctx, "videos/f2/raw.mp4", 1)
+	if err := store.AbortMultipart(ctx, aborted); err != nil {
+		t.Fatalf("AbortMultipart error: %v", err)
+	}
+	req, _ = http.NewRequest(http.MethodPut, aborted.PartURLs[0], strings.NewReader("x"))
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected an aborted upload to refuse parts, got %v %v", resp, err)
+	}
+}
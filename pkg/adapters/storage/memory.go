@@ -3,7 +3,9 @@ package storage
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"encoding/base64"
+	"fmt"
 	"io"
 	"sync"
 
@@ -13,15 +15,31 @@ import (
 // InMemoryStorage is an in-memory implementation of the Storage interface.
 // It is useful for testing and local development.
 type InMemoryStorage struct {
-	mu    sync.RWMutex
-	blobs map[string][]byte
+	mu      sync.RWMutex
+	blobs   map[string][]byte
+	infos   map[string]adapters.BlobInfo
+	maxSize int64
+}
+
+// MemoryOption customises an InMemoryStorage.
+type MemoryOption func(*InMemoryStorage)
+
+// WithMaxBlobSize rejects blobs larger than size bytes with adapters.ErrBlobTooLarge,
+// surfacing accidental buffering of large files in tests.
+func WithMaxBlobSize(size int64) MemoryOption {
+	return func(s *InMemoryStorage) { s.maxSize = size }
 }
 
 // NewInMemoryStorage creates a new InMemoryStorage.
-func NewInMemoryStorage() *InMemoryStorage {
-	return &InMemoryStorage{
+func NewInMemoryStorage(opts ...MemoryOption) *InMemoryStorage {
+	s := &InMemoryStorage{
 		blobs: make(map[string][]byte),
+		infos: make(map[string]adapters.BlobInfo),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Get returns a reader for the given blob location.
@@ -39,20 +57,49 @@ func (s *InMemoryStorage) Get(ctx context.Context, location string) (io.ReadClos
 
 // Put uploads a blob from a reader to the given location.
 func (s *InMemoryStorage) Put(ctx context.Context, location string, reader io.Reader) error {
+	return s.PutWithInfo(ctx, location, reader, adapters.BlobInfo{})
+}
+
+// PutWithInfo uploads a blob and records the supplied metadata with it.
+func (s *InMemoryStorage) PutWithInfo(ctx context.Context, location string, reader io.Reader, info adapters.BlobInfo) error {
+	if s.maxSize > 0 {
+		reader = io.LimitReader(reader, s.maxSize+1)
+	}
+
 	data, err := io.ReadAll(reader)
 	if err != nil {
 		return err
 	}
+	if s.maxSize > 0 && int64(len(data)) > s.maxSize {
+		return fmt.Errorf("%s: %w", location, adapters.ErrBlobTooLarge)
+	}
+
+	info.Size = int64(len(data))
+	info.ETag = fmt.Sprintf("%x", md5.Sum(data))
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.blobs[location] = data
+	s.infos[location] = info
 	return nil
 }
 
+// Stat returns the metadata recorded for the blob at location.
+func (s *InMemoryStorage) Stat(ctx context.Context, location string) (adapters.BlobInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info, ok := s.infos[location]
+	if !ok {
+		return adapters.BlobInfo{}, adapters.ErrNotFound
+	}
+	return info, nil
+}
+
 // PresignGet generates a presigned URL for getting a blob.
-// For in-memory storage, it returns a data URI.
+// For in-memory storage, it returns a data URI. Blobs stored compressed, e.g. by
+// CompressedStorage, carry a content-encoding parameter that OpenPresigned decodes.
 func (s *InMemoryStorage) PresignGet(ctx context.Context, location string) (string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -62,6 +109,23 @@ func (s *InMemoryStorage) PresignGet(ctx context.Context, location string) (stri
 		return "", adapters.ErrNotFound
 	}
 
+	info := s.infos[location]
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if info.ContentEncoding != "" {
+		contentType += ";content-encoding=" + info.ContentEncoding
+	}
+
 	encoded := base64.StdEncoding.EncodeToString(data)
-	return "data:application/octet-stream;base64," + encoded, nil
+	return "data:" + contentType + ";base64," + encoded, nil
 }
+
+// PresignPut is not supported by in-memory storage because nothing serves its URLs.
+// Use FSStorage when tests need presigned uploads.
+func (s *InMemoryStorage) PresignPut(ctx context.Context, location string) (string, error) {
+	return "", adapters.ErrUnsupported
+}
+
+var _ adapters.BlobInfoStorage = (*InMemoryStorage)(nil)
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+)
+
+func TestInMemoryStorageEnforcesMaxBlobSize(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStorage(WithMaxBlobSize(8))
+
+	if err := store.Put(ctx, "ok.txt", strings.NewReader("12345678")); err != nil {
+		t.Fatalf("Put at limit returned error: %v", err)
+	}
+
+	err := store.Put(ctx, "big.txt", strings.NewReader("123456789"))
+	if !errors.Is(err, adapters.ErrBlobTooLarge) {
+		t.Fatalf("expected ErrBlobTooLarge, got %v", err)
+	}
+	if _, err := store.Stat(ctx, "big.txt"); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("oversized blob should not be stored, got %v", err)
+	}
+}
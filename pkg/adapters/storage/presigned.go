@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// OpenJobBlob returns the content of the job's file. It reads through st when a
+// Storage adapter is configured and falls back to Job.PresignedGet otherwise.
+func OpenJobBlob(ctx context.Context, st adapters.Storage, job contracts.Job) (io.ReadCloser, error) {
+	if st != nil {
+		return st.Get(ctx, job.File.Blob.Location)
+	}
+	if job.PresignedGet == "" {
+		return nil, errors.New("job has neither a storage adapter nor a presigned URL")
+	}
+	return OpenPresigned(ctx, nil, job.PresignedGet)
+}
+
+// OpenPresigned downloads a presigned URL, decoding gzip or zstd Content-Encoding.
+// data: URIs, as issued by InMemoryStorage, are decoded in place, honouring a
+// content-encoding parameter the same way.
+func OpenPresigned(ctx context.Context, client *http.Client, rawURL string) (io.ReadCloser, error) {
+	if strings.HasPrefix(rawURL, "data:") {
+		return openDataURI(rawURL)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, adapters.ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("presigned download failed: %s", resp.Status)
+	}
+
+	// net/http already removes gzip encoding it negotiated itself; handle the rest here.
+	return decode(resp.Body, resp.Header.Get("Content-Encoding"))
+}
+
+func openDataURI(uri string) (io.ReadCloser, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok {
+		return nil, errors.New("malformed data URI")
+	}
+	var encoding string
+	for _, param := range strings.Split(header, ";")[1:] {
+		if value, ok := strings.CutPrefix(param, "content-encoding="); ok {
+			encoding = value
+		}
+	}
+	if !strings.HasSuffix(header, ";base64") {
+		text, err := url.PathUnescape(payload)
+		if err != nil {
+			return nil, err
+		}
+		return decode(io.NopCloser(strings.NewReader(text)), encoding)
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("decode data URI: %w", err)
+	}
+	return decode(io.NopCloser(bytes.NewReader(data)), encoding)
+}
+
+// UploadArtifact streams content to the storage backend through the presigned form
+// upload carried in a Job, returning the artifact location to report in the Result.
+func UploadArtifact(ctx context.Context, client *http.Client, upload contracts.ArtifactUpload, name string, content io.Reader) (string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if name == "" {
+		return "", fmt.Errorf("artifact name is required")
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeUploadForm(form, upload, name, contentType, content))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upload.URL, pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		pr.CloseWithError(err)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("artifact upload failed: %s: %s", resp.Status, body)
+	}
+	return upload.Prefix + name, nil
+}
+
+// writeUploadForm writes the signed fields first because backends read them before the file.
+func writeUploadForm(form *multipart.Writer, upload contracts.ArtifactUpload, name, contentType string, content io.Reader) error {
+	for field, value := range upload.Fields {
+		if field == "key" {
+			continue
+		}
+		if err := form.WriteField(field, value); err != nil {
+			return err
+		}
+	}
+	if err := form.WriteField("key", upload.KeyPrefix+name); err != nil {
+		return err
+	}
+	if err := form.WriteField("Content-Type", contentType); err != nil {
+		return err
+	}
+
+	part, err := form.CreateFormFile("file", path.Base(name))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return err
+	}
+	return form.Close()
+}
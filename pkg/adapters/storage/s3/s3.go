@@ -5,17 +5,21 @@ package s3
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/url"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
 )
 
 // Config captures the information required to construct an S3-compatible storage adapter.
@@ -27,6 +31,41 @@ type Config struct {
 	ForcePathStyle bool
 	Credentials    aws.CredentialsProvider
 	PresignExpiry  time.Duration
+	// PartSize is the multipart chunk size in bytes; zero uses the SDK default of 5 MiB.
+	PartSize int64
+	// Concurrency is the number of parts uploaded in parallel; zero uses the SDK default.
+	Concurrency int
+	// ChecksumAlgorithm asks S3 to verify uploads with CRC32C or SHA256; empty disables it.
+	ChecksumAlgorithm string
+	// Progress, when set, is called as upload bytes are read from the source reader.
+	Progress ProgressFunc
+}
+
+// ProgressFunc reports the number of source bytes read so far while uploading location.
+type ProgressFunc func(location string, transferred int64)
+
+// Option customises upload behaviour of the Storage adapter.
+type Option func(*Storage)
+
+// WithPartSize sets the multipart chunk size in bytes.
+func WithPartSize(size int64) Option {
+	return func(s *Storage) { s.partSize = size }
+}
+
+// WithConcurrency sets how many parts are uploaded in parallel.
+func WithConcurrency(n int) Option {
+	return func(s *Storage) { s.concurrency = n }
+}
+
+// WithChecksum enables S3-side integrity checks using CRC32C or SHA256.
+func WithChecksum(algorithm string) Option {
+	return func(s *Storage) { s.checksum = types.ChecksumAlgorithm(strings.ToUpper(algorithm)) }
+}
+
+// WithProgress registers a callback invoked as upload bytes are read. Seekable
+// sources keep their io.Seeker and io.ReaderAt, so parts are not buffered.
+func WithProgress(fn ProgressFunc) Option {
+	return func(s *Storage) { s.progress = fn }
 }
 
 // Storage implements adapters.Storage using an AWS S3 compatible backend.
@@ -37,6 +76,11 @@ type Storage struct {
 	bucket   string
 	prefix   string
 	expiry   time.Duration
+
+	partSize    int64
+	concurrency int
+	checksum    types.ChecksumAlgorithm
+	progress    ProgressFunc
 }
 
 // New initialises the storage adapter using the provided configuration.
@@ -50,7 +94,6 @@ func New(ctx context.Context, cfg Config) (*Storage, error) {
 	if cfg.PresignExpiry <= 0 {
 		cfg.PresignExpiry = 15 * time.Minute
 	}
-
 	loadOpts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(cfg.Region)}
 	if cfg.Credentials != nil {
 		loadOpts = append(loadOpts, awsconfig.WithCredentialsProvider(cfg.Credentials))
@@ -74,11 +117,17 @@ func New(ctx context.Context, cfg Config) (*Storage, error) {
 		o.UsePathStyle = cfg.ForcePathStyle
 	}
 
+	opts := []Option{WithPartSize(cfg.PartSize), WithConcurrency(cfg.Concurrency), WithProgress(cfg.Progress)}
+	if cfg.ChecksumAlgorithm != "" {
+		opts = append(opts, WithChecksum(cfg.ChecksumAlgorithm))
+	}
+
 	client := awss3.NewFromConfig(awsCfg, s3Opts)
-	return NewWithClient(client, cfg.Bucket, cfg.Prefix, cfg.PresignExpiry), nil
+	return NewWithClientOptions(client, cfg.Bucket, cfg.Prefix, cfg.PresignExpiry, opts...)
 }
 
-// NewWithClient wires an existing S3 client into the adapter.
+// NewWithClient wires an existing S3 client into the adapter with the default
+// upload settings.
 func NewWithClient(client *awss3.Client, bucket, prefix string, presignExpiry time.Duration) *Storage {
 	if presignExpiry <= 0 {
 		presignExpiry = 15 * time.Minute
@@ -94,6 +143,59 @@ func NewWithClient(client *awss3.Client, bucket, prefix string, presignExpiry ti
 	}
 }
 
+// NewWithClientOptions is NewWithClient with upload options. Invalid options,
+// such as a part size below the S3 minimum, are rejected.
+func NewWithClientOptions(client *awss3.Client, bucket, prefix string, presignExpiry time.Duration, opts ...Option) (*Storage, error) {
+	if client == nil {
+		return nil, errors.New("s3 client is required")
+	}
+	if bucket == "" {
+		return nil, errors.New("bucket is required")
+	}
+	if presignExpiry <= 0 {
+		presignExpiry = 15 * time.Minute
+	}
+
+	s := &Storage{
+		client:  client,
+		presign: awss3.NewPresignClient(client),
+		bucket:  bucket,
+		prefix:  strings.Trim(prefix, "/"),
+		expiry:  presignExpiry,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := validateUpload(s.partSize, s.concurrency, s.checksum); err != nil {
+		return nil, err
+	}
+
+	s.uploader = manager.NewUploader(client, func(u *manager.Uploader) {
+		if s.partSize > 0 {
+			u.PartSize = s.partSize
+		}
+		if s.concurrency > 0 {
+			u.Concurrency = s.concurrency
+		}
+	})
+	return s, nil
+}
+
+func validateUpload(partSize int64, concurrency int, checksum types.ChecksumAlgorithm) error {
+	if partSize < 0 || (partSize != 0 && partSize < manager.MinUploadPartSize) {
+		return fmt.Errorf("part size must be at least %d bytes", manager.MinUploadPartSize)
+	}
+	if concurrency < 0 {
+		return errors.New("concurrency must not be negative")
+	}
+	switch checksum {
+	case "", types.ChecksumAlgorithmCrc32c, types.ChecksumAlgorithmSha256:
+		return nil
+	default:
+		return fmt.Errorf("unsupported checksum algorithm: %s", checksum)
+	}
+}
+
 // Get returns a reader for the given blob location.
 func (s *Storage) Get(ctx context.Context, location string) (io.ReadCloser, error) {
 	key, bucket := s.resolve(location)
@@ -109,22 +211,84 @@ func (s *Storage) Get(ctx context.Context, location string) (io.ReadCloser, erro
 
 // Put uploads a blob from a reader to the given location.
 func (s *Storage) Put(ctx context.Context, location string, reader io.Reader) error {
+	return s.PutWithInfo(ctx, location, reader, adapters.BlobInfo{})
+}
+
+// PutWithInfo uploads a blob and stores the content type and encoding as object headers.
+func (s *Storage) PutWithInfo(ctx context.Context, location string, reader io.Reader, info adapters.BlobInfo) error {
 	key, bucket := s.resolve(location)
-	_, err := s.uploader.Upload(ctx, &awss3.PutObjectInput{
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	input := &awss3.PutObjectInput{
 		Bucket:      aws.String(bucket),
 		Key:         aws.String(key),
 		Body:        reader,
-		ContentType: aws.String("application/octet-stream"),
-	})
+		ContentType: aws.String(contentType),
+	}
+	if info.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(info.ContentEncoding)
+	}
+	if s.checksum != "" {
+		input.ChecksumAlgorithm = s.checksum
+	}
+	if s.progress != nil {
+		input.Body = withProgress(reader, location, s.progress)
+	}
+
+	_, err := s.uploader.Upload(ctx, input)
 	return err
 }
 
+// Stat returns the object headers recorded for the blob at location.
+func (s *Storage) Stat(ctx context.Context, location string) (adapters.BlobInfo, error) {
+	key, bucket := s.resolve(location)
+	output, err := s.client.HeadObject(ctx, &awss3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return adapters.BlobInfo{}, adapters.ErrNotFound
+		}
+		return adapters.BlobInfo{}, err
+	}
+
+	return adapters.BlobInfo{
+		Size:            aws.ToInt64(output.ContentLength),
+		ETag:            aws.ToString(output.ETag),
+		ContentType:     aws.ToString(output.ContentType),
+		ContentEncoding: aws.ToString(output.ContentEncoding),
+	}, nil
+}
+
 // PresignGet generates a presigned URL for getting a blob.
 func (s *Storage) PresignGet(ctx context.Context, location string) (string, error) {
+	return s.PresignGetWithExpiry(ctx, location, s.expiry)
+}
+
+// PresignGetWithExpiry generates a presigned download URL valid for ttl.
+func (s *Storage) PresignGetWithExpiry(ctx context.Context, location string, ttl time.Duration) (string, error) {
 	key, bucket := s.resolve(location)
 	result, err := s.presign.PresignGetObject(ctx, &awss3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
+	}, awss3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+	return result.URL, nil
+}
+
+// PresignPut generates a presigned URL for uploading a blob with HTTP PUT.
+func (s *Storage) PresignPut(ctx context.Context, location string) (string, error) {
+	key, bucket := s.resolve(location)
+	result, err := s.presign.PresignPutObject(ctx, &awss3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
 	}, awss3.WithPresignExpires(s.expiry))
 	if err != nil {
 		return "", err
@@ -132,6 +296,206 @@ func (s *Storage) PresignGet(ctx context.Context, location string) (string, erro
 	return result.URL, nil
 }
 
+// PresignUpload issues a presigned POST policy that accepts any key under prefix.
+func (s *Storage) PresignUpload(ctx context.Context, prefix string) (contracts.ArtifactUpload, error) {
+	keyPrefix, bucket := s.resolve(prefix)
+	if strings.HasSuffix(prefix, "/") && !strings.HasSuffix(keyPrefix, "/") {
+		keyPrefix += "/"
+	}
+
+	expires := time.Now().Add(s.expiry)
+	result, err := s.presign.PresignPostObject(ctx, &awss3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(keyPrefix + "${filename}"),
+	}, func(o *awss3.PresignPostOptions) {
+		o.Expires = s.expiry
+		o.Conditions = []interface{}{
+			[]interface{}{"starts-with", "$key", keyPrefix},
+			[]interface{}{"starts-with", "$Content-Type", ""},
+		}
+	})
+	if err != nil {
+		return contracts.ArtifactUpload{}, err
+	}
+
+	return contracts.ArtifactUpload{
+		Prefix:    prefix,
+		KeyPrefix: keyPrefix,
+		URL:       result.URL,
+		Fields:    result.Values,
+		Expires:   expires.UTC(),
+	}, nil
+}
+
+// PresignMultipart starts a multipart upload and presigns an UploadPart URL for each part.
+func (s *Storage) PresignMultipart(ctx context.Context, location string, parts int) (adapters.MultipartUpload, error) {
+	if parts <= 0 || parts > 10000 {
+		return adapters.MultipartUpload{}, fmt.Errorf("part count must be between 1 and 10000, got %d", parts)
+	}
+
+	key, bucket := s.resolve(location)
+	created, err := s.client.CreateMultipartUpload(ctx, &awss3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return adapters.MultipartUpload{}, err
+	}
+
+	upload := adapters.MultipartUpload{Location: location, UploadID: aws.ToString(created.UploadId)}
+	for i := 1; i <= parts; i++ {
+		part, err := s.presign.PresignUploadPart(ctx, &awss3.UploadPartInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(key),
+			UploadId:   created.UploadId,
+			PartNumber: aws.Int32(int32(i)),
+		}, awss3.WithPresignExpires(s.expiry))
+		if err != nil {
+			s.AbortMultipart(ctx, upload)
+			return adapters.MultipartUpload{}, err
+		}
+		upload.PartURLs = append(upload.PartURLs, part.URL)
+	}
+	return upload, nil
+}
+
+// CompleteMultipart assembles parts uploaded through the presigned URLs.
+func (s *Storage) CompleteMultipart(ctx context.Context, upload adapters.MultipartUpload, parts []adapters.CompletedPart) error {
+	key, bucket := s.resolve(upload.Location)
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, types.CompletedPart{
+			PartNumber: aws.Int32(part.Number),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+
+	_, err := s.client.CompleteMultipartUpload(ctx, &awss3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(upload.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	return err
+}
+
+// AbortMultipart discards an unfinished multipart upload and its parts.
+func (s *Storage) AbortMultipart(ctx context.Context, upload adapters.MultipartUpload) error {
+	key, bucket := s.resolve(upload.Location)
+	_, err := s.client.AbortMultipartUpload(ctx, &awss3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(upload.UploadID),
+	})
+	return err
+}
+
+// withProgress wraps reader to report upload progress. Seekable readers stay
+// seekable, and io.ReaderAt is kept too, so the uploader can still read parts in
+// place, compute checksums and retry instead of buffering every part. Progress
+// counts the distinct source bytes read, so a part read again for a checksum or a
+// retry is not counted twice.
+func withProgress(reader io.Reader, location string, report ProgressFunc) io.Reader {
+	counter := &progressCounter{location: location, report: report}
+	switch r := reader.(type) {
+	case readerAtSeeker:
+		return &progressReaderAt{progressReadSeeker{ReadSeeker: r, counter: counter}, r}
+	case io.ReadSeeker:
+		return &progressReadSeeker{ReadSeeker: r, counter: counter}
+	default:
+		return &progressReader{reader: reader, counter: counter}
+	}
+}
+
+type readerAtSeeker interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// progressCounter tracks the byte ranges read so far. Parts may be read
+// concurrently, so it also serialises reports.
+type progressCounter struct {
+	mu          sync.Mutex
+	location    string
+	ranges      [][2]int64
+	transferred int64
+	report      ProgressFunc
+}
+
+func (c *progressCounter) add(off int64, n int) {
+	if n <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start, end := off, off+int64(n)
+	ranges := make([][2]int64, 0, len(c.ranges)+1)
+	for _, r := range c.ranges {
+		if r[1] < start || r[0] > end {
+			ranges = append(ranges, r)
+			continue
+		}
+		start, end = min(start, r[0]), max(end, r[1])
+	}
+	ranges = append(ranges, [2]int64{start, end})
+	c.ranges = ranges
+
+	var total int64
+	for _, r := range ranges {
+		total += r[1] - r[0]
+	}
+	if total > c.transferred {
+		c.transferred = total
+		c.report(c.location, total)
+	}
+}
+
+type progressReader struct {
+	reader  io.Reader
+	counter *progressCounter
+	pos     int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.counter.add(r.pos, n)
+	r.pos += int64(n)
+	return n, err
+}
+
+type progressReadSeeker struct {
+	io.ReadSeeker
+	counter *progressCounter
+	pos     int64
+}
+
+func (r *progressReadSeeker) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	r.counter.add(r.pos, n)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *progressReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.ReadSeeker.Seek(offset, whence)
+	if err == nil {
+		r.pos = pos
+	}
+	return pos, err
+}
+
+type progressReaderAt struct {
+	progressReadSeeker
+	at io.ReaderAt
+}
+
+func (r *progressReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.at.ReadAt(p, off)
+	r.counter.add(off, n)
+	return n, err
+}
+
 func (s *Storage) resolve(location string) (key, bucket string) {
 	bucket = s.bucket
 	key = location
@@ -153,4 +517,9 @@ func (s *Storage) resolve(location string) (key, bucket string) {
 	return key, bucket
 }
 
-var _ adapters.Storage = (*Storage)(nil)
+var (
+	_ adapters.BlobInfoStorage    = (*Storage)(nil)
+	_ adapters.ExpiringPresigner  = (*Storage)(nil)
+	_ adapters.UploadPresigner    = (*Storage)(nil)
+	_ adapters.MultipartPresigner = (*Storage)(nil)
+)
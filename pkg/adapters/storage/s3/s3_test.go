@@ -0,0 +1,182 @@
+//go:build s3
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Stub answers the S3 calls made by uploads and records what it saw.
+type s3Stub struct {
+	mu        sync.Mutex
+	puts      int
+	parts     map[string][]byte
+	checksums []string
+	inFlight  int
+	peak      int
+	completed bool
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>key</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		s.mu.Lock()
+		s.inFlight++
+		s.peak = max(s.peak, s.inFlight)
+		s.mu.Unlock()
+		// Hold the part briefly so concurrent uploads overlap.
+		time.Sleep(20 * time.Millisecond)
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		s.inFlight--
+		s.parts[query.Get("partNumber")] = body
+		s.checksums = append(s.checksums, r.Header.Get("X-Amz-Checksum-Sha256"))
+		s.mu.Unlock()
+		w.Header().Set("ETag", `"part-`+query.Get("partNumber")+`"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		io.Copy(io.Discard, r.Body)
+		s.mu.Lock()
+		s.completed = true
+		s.mu.Unlock()
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>key</Key><ETag>"done"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodPut:
+		io.Copy(io.Discard, r.Body)
+		s.mu.Lock()
+		s.puts++
+		s.checksums = append(s.checksums, r.Header.Get("X-Amz-Checksum-Sha256"))
+		s.mu.Unlock()
+		w.Header().Set("ETag", `"object"`)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func newStubStorage(t *testing.T, opts ...Option) (*Storage, *s3Stub) {
+	t.Helper()
+	stub := &s3Stub{parts: make(map[string][]byte)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	client := awss3.New(awss3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+	store, err := NewWithClientOptions(client, "bucket", "", time.Minute, opts...)
+	if err != nil {
+		t.Fatalf("NewWithClientOptions error: %v", err)
+	}
+	return store, stub
+}
+
+func TestNewWithClientOptionsValidatesUploadOptions(t *testing.T) {
+	client := awss3.New(awss3.Options{Region: "us-east-1"})
+	for name, opt := range map[string]Option{
+		"part size":   WithPartSize(1024),
+		"concurrency": WithConcurrency(-1),
+		"checksum":    WithChecksum("md5"),
+	} {
+		if _, err := NewWithClientOptions(client, "bucket", "", time.Minute, opt); err == nil {
+			t.Errorf("expected an invalid %s to be rejected", name)
+		}
+	}
+}
+
+func TestMultipartUploadUsesPartSizeConcurrencyAndChecksum(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		progress []int64
+	)
+	store, stub := newStubStorage(t,
+		WithPartSize(manager.MinUploadPartSize),
+		WithConcurrency(2),
+		WithChecksum("sha256"),
+		WithProgress(func(location string, transferred int64) {
+			mu.Lock()
+			progress = append(progress, transferred)
+			mu.Unlock()
+		}),
+	)
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), int(manager.MinUploadPartSize)*5/2/16)
+	if err := store.Put(context.Background(), "video.mp4", bytes.NewReader(content)); err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+
+	if len(stub.parts) != 3 || !stub.completed {
+		t.Fatalf("expected 3 parts and a completed upload, got %d parts", len(stub.parts))
+	}
+	if int64(len(stub.parts["1"])) != manager.MinUploadPartSize {
+		t.Fatalf("expected parts of %d bytes, got %d", manager.MinUploadPartSize, len(stub.parts["1"]))
+	}
+	if stub.peak != 2 {
+		t.Fatalf("expected 2 parts in flight, peaked at %d", stub.peak)
+	}
+	for _, sum := range stub.checksums {
+		if sum == "" {
+			t.Fatalf("expected every part to carry a SHA256 checksum")
+		}
+	}
+	// Checksums and signing read parts again; progress still ends at the source size.
+	if last := progress[len(progress)-1]; last != int64(len(content)) {
+		t.Fatalf("expected progress to end at %d, got %d", len(content), last)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] < progress[i-1] {
+			t.Fatalf("progress went backwards: %v", progress[i-1:i+1])
+		}
+	}
+}
+
+func TestSinglePartUploadWithProgressKeepsChecksum(t *testing.T) {
+	var last int64
+	store, stub := newStubStorage(t, WithChecksum("sha256"), WithProgress(func(location string, transferred int64) {
+		last = transferred
+	}))
+
+	content := strings.Repeat("thumbnail ", 100)
+	for _, reader := range []io.Reader{strings.NewReader(content), io.MultiReader(strings.NewReader(content))} {
+		if err := store.Put(context.Background(), "thumb.png", reader); err != nil {
+			t.Fatalf("Put error: %v", err)
+		}
+		if last != int64(len(content)) {
+			t.Fatalf("expected progress of %d bytes, got %d", len(content), last)
+		}
+	}
+	if stub.puts != 2 || stub.checksums[0] == "" || stub.checksums[1] == "" {
+		t.Fatalf("expected 2 checksummed puts, got %d %v", stub.puts, stub.checksums)
+	}
+}
+
+func TestProgressKeepsSeekableReaders(t *testing.T) {
+	report := func(string, int64) {}
+	if _, ok := withProgress(bytes.NewReader(nil), "a", report).(readerAtSeeker); !ok {
+		t.Fatal("expected io.ReaderAt and io.Seeker to be kept")
+	}
+	if _, ok := withProgress(io.NewSectionReader(strings.NewReader("x"), 0, 1), "a", report).(io.Seeker); !ok {
+		t.Fatal("expected io.Seeker to be kept")
+	}
+	if _, ok := withProgress(io.MultiReader(), "a", report).(io.Seeker); ok {
+		t.Fatal("expected plain readers to stay plain")
+	}
+}
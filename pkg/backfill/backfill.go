@@ -0,0 +1,206 @@
+// Package backfill reprocesses existing files after a UoW changes. It scans
+// metadata for files the UoW never processed, or processed at another version,
+// and enqueues a job for each at a bounded rate. Progress is saved after every
+// page, so an interrupted backfill resumes from its cursor.
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/adapters/metadata"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// Config describes a backfill.
+type Config struct {
+	// Name identifies the backfill's progress in the Store. It defaults to "<uow>@<version>".
+	Name string
+	// UoW is the unit of work to run.
+	UoW string
+	// Version is the UoW's current version. Files recorded at any other version are
+	// enqueued, as are files the UoW never processed; without a version only the
+	// latter are.
+	Version string
+	// Rate limits how many jobs are enqueued per second. Zero means no limit.
+	Rate float64
+	// BatchSize is the number of files scanned per page. It defaults to 100.
+	BatchSize int
+	// Template supplies fields, such as Version, Return and Hints, copied into every job.
+	Template contracts.Job
+	// Resolve builds the file of a job from its stored metadata, e.g. to fill in the
+	// blob location from the application's records. It defaults to the file's ID
+	// and attributes.
+	Resolve func(ctx context.Context, record adapters.FileRecord) (contracts.File, error)
+}
+
+// Progress is the state of a backfill.
+type Progress struct {
+	Name string `json:"name"`
+	// Cursor is the ID of the last file handled; the next run scans after it.
+	Cursor    string    `json:"cursor"`
+	Scanned   int64     `json:"scanned"`
+	Enqueued  int64     `json:"enqueued"`
+	Done      bool      `json:"done"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store persists backfill progress.
+type Store interface {
+	// Load returns the progress saved under name, or adapters.ErrNotFound.
+	Load(ctx context.Context, name string) (Progress, error)
+	// Save replaces the progress saved under its name.
+	Save(ctx context.Context, progress Progress) error
+}
+
+// Backfill enqueues the jobs of one backfill.
+type Backfill struct {
+	scanner adapters.FileScanner
+	bus     adapters.Bus
+	store   Store
+	cfg     Config
+
+	next time.Time
+}
+
+// New creates a Backfill scanning scanner and publishing jobs to bus.
+func New(scanner adapters.FileScanner, bus adapters.Bus, store Store, cfg Config) (*Backfill, error) {
+	if scanner == nil {
+		return nil, errors.New("file scanner is required")
+	}
+	if bus == nil {
+		return nil, errors.New("bus is required")
+	}
+	if store == nil {
+		return nil, errors.New("progress store is required")
+	}
+	if cfg.UoW == "" {
+		return nil, errors.New("uow is required")
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.UoW + "@" + cfg.Version
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Resolve == nil {
+		cfg.Resolve = func(ctx context.Context, record adapters.FileRecord) (contracts.File, error) {
+			return contracts.File{ID: record.ID, Attributes: record.Attributes}, nil
+		}
+	}
+	return &Backfill{scanner: scanner, bus: bus, store: store, cfg: cfg}, nil
+}
+
+// Progress returns the saved progress of the backfill.
+func (b *Backfill) Progress(ctx context.Context) (Progress, error) {
+	progress, err := b.store.Load(ctx, b.cfg.Name)
+	if errors.Is(err, adapters.ErrNotFound) {
+		return Progress{Name: b.cfg.Name}, nil
+	}
+	return progress, err
+}
+
+// Run enqueues jobs until every file has been scanned or ctx is done, resuming
+// after the saved cursor. A file may be enqueued twice if the previous run
+// stopped before saving its page; job IDs are stable, so IdemKey deduplicates
+// them. A finished backfill returns straight away.
+func (b *Backfill) Run(ctx context.Context) (Progress, error) {
+	progress, err := b.Progress(ctx)
+	if err != nil {
+		return progress, fmt.Errorf("load progress: %w", err)
+	}
+	if progress.Done {
+		return progress, nil
+	}
+	if progress.StartedAt.IsZero() {
+		progress.StartedAt = time.Now().UTC()
+	}
+
+	for {
+		records, err := b.scanner.ScanFiles(ctx, progress.Cursor, b.cfg.BatchSize)
+		if err != nil {
+			return progress, fmt.Errorf("scan files: %w", err)
+		}
+		for _, record := range records {
+			enqueued, err := b.enqueue(ctx, record)
+			if err != nil {
+				// Keep what was done so far, even when ctx was cancelled.
+				return progress, errors.Join(err, b.save(context.WithoutCancel(ctx), &progress))
+			}
+			progress.Cursor = record.ID
+			progress.Scanned++
+			if enqueued {
+				progress.Enqueued++
+			}
+		}
+		progress.Done = len(records) < b.cfg.BatchSize
+		if err := b.save(ctx, &progress); err != nil || progress.Done {
+			return progress, err
+		}
+	}
+}
+
+// enqueue publishes the job for record if the UoW has to process it.
+func (b *Backfill) enqueue(ctx context.Context, record adapters.FileRecord) (bool, error) {
+	if !b.stale(record) {
+		return false, nil
+	}
+	file, err := b.cfg.Resolve(ctx, record)
+	if err != nil {
+		return false, fmt.Errorf("resolve file %s: %w", record.ID, err)
+	}
+	if err := b.wait(ctx); err != nil {
+		return false, err
+	}
+
+	job := b.cfg.Template
+	job.JobID = fmt.Sprintf("backfill:%s:%s", b.cfg.Name, record.ID)
+	job.IdemKey = job.JobID
+	job.UoW = b.cfg.UoW
+	job.File = file
+	if err := b.bus.Publish(ctx, job); err != nil {
+		return false, fmt.Errorf("publish job %s: %w", job.JobID, err)
+	}
+	return true, nil
+}
+
+// stale reports whether the UoW never processed record, or processed it at another version.
+func (b *Backfill) stale(record adapters.FileRecord) bool {
+	version, ok := metadata.ProcessedVersion(record.Attributes, b.cfg.UoW)
+	return !ok || (b.cfg.Version != "" && version != b.cfg.Version)
+}
+
+// wait blocks until the rate limit allows another job.
+func (b *Backfill) wait(ctx context.Context) error {
+	if b.cfg.Rate <= 0 {
+		return nil
+	}
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	if delay := b.next.Sub(now); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	b.next = b.next.Add(time.Duration(float64(time.Second) / b.cfg.Rate))
+	return nil
+}
+
+func (b *Backfill) save(ctx context.Context, progress *Progress) error {
+	progress.Name = b.cfg.Name
+	progress.UpdatedAt = time.Now().UTC()
+	if err := b.store.Save(ctx, *progress); err != nil {
+		return fmt.Errorf("save progress: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters/metadata"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+type recordingBus struct {
+	failOn string
+	jobs   []contracts.Job
+}
+
+func (b *recordingBus) Publish(ctx context.Context, job contracts.Job) error {
+	if job.File.ID == b.failOn {
+		b.failOn = ""
+		return errors.New("broker unavailable")
+	}
+	b.jobs = append(b.jobs, job)
+	return nil
+}
+
+func (b *recordingBus) files() string {
+	ids := make([]string, len(b.jobs))
+	for i, job := range b.jobs {
+		ids[i] = job.File.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func seed(t *testing.T, versions map[string]string) *metadata.MemoryMetadata {
+	t.Helper()
+	m := metadata.NewMemoryMetadata()
+	for id, version := range versions {
+		result := contracts.Result{JobID: "seed", FileID: id, UoW: "ocr", UoWVersion: version, AttributesPatch: map[string]interface{}{"name": id}}
+		if version == "" {
+			result.UoW = "hash"
+		}
+		if _, err := metadata.ApplyResult(context.Background(), m, result, metadata.ApplyOptions{}); err != nil {
+			t.Fatalf("ApplyResult error: %v", err)
+		}
+	}
+	return m
+}
+
+func TestBackfillResumesFromCursor(t *testing.T) {
+	ctx := context.Background()
+	m := seed(t, map[string]string{"f1": "1", "f2": "2", "f3": "", "f4": "1", "f5": "2"})
+	store := NewMemoryStore()
+	bus := &recordingBus{failOn: "f3"}
+
+	b, err := New(m, bus, store, Config{UoW: "ocr", Version: "2", BatchSize: 2, Template: contracts.Job{Version: "1.0"}})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	progress, err := b.Run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "broker unavailable") {
+		t.Fatalf("expected the publish error, got %v", err)
+	}
+	if progress.Cursor != "f2" || progress.Scanned != 2 || progress.Enqueued != 1 || progress.Done {
+		t.Fatalf("unexpected progress after failure: %+v", progress)
+	}
+	if saved, _ := b.Progress(ctx); saved.Cursor != "f2" || saved.Name != "ocr@2" {
+		t.Fatalf("expected progress to be saved, got %+v", saved)
+	}
+
+	// A new process picks up where the previous one stopped.
+	b, _ = New(m, bus, store, Config{UoW: "ocr", Version: "2", BatchSize: 2, Template: contracts.Job{Version: "1.0"}})
+	progress, err = b.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if !progress.Done || progress.Scanned != 5 || progress.Enqueued != 3 || bus.files() != "f1,f3,f4" {
+		t.Fatalf("unexpected progress %+v with jobs %s", progress, bus.files())
+	}
+	job := bus.jobs[1]
+	if job.JobID != "backfill:ocr@2:f3" || job.IdemKey != job.JobID || job.UoW != "ocr" || job.Version != "1.0" || job.File.Attributes["name"] != "f3" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	if progress, err = b.Run(ctx); err != nil || len(bus.jobs) != 3 || !progress.Done {
+		t.Fatalf("expected a finished backfill to do nothing, got %+v, %d jobs, %v", progress, len(bus.jobs), err)
+	}
+}
+
+func TestBackfillLimitsRate(t *testing.T) {
+	m := seed(t, map[string]string{"f1": "", "f2": "", "f3": "", "f4": "1"})
+	bus := &recordingBus{}
+	b, _ := New(m, bus, NewMemoryStore(), Config{UoW: "ocr", Rate: 100})
+
+	start := time.Now()
+	progress, err := b.Run(context.Background())
+	// Without a version, only files ocr never processed are enqueued.
+	if err != nil || progress.Enqueued != 3 {
+		t.Fatalf("Run = %+v, %v", progress, err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("expected 3 jobs at 100/s to take at least 20ms, took %v", elapsed)
+	}
+}
@@ -0,0 +1,93 @@
+// Package sql implements backfill.Store on top of database/sql for SQLite and
+// Postgres, so backfills resume from their cursor after a restart.
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tendant/simple-process/internal/sqldialect"
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/backfill"
+)
+
+// Dialect selects the SQL flavour used by the store.
+type Dialect = sqldialect.Dialect
+
+// Supported dialects.
+const (
+	SQLite   = sqldialect.SQLite
+	Postgres = sqldialect.Postgres
+)
+
+// Store keeps backfill progress in the sp_backfills table.
+type Store struct {
+	db      *stdsql.DB
+	dialect Dialect
+}
+
+// New wraps an open database handle. Call Migrate to create the table.
+func New(db *stdsql.DB, dialect Dialect) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("database handle is required")
+	}
+	if err := dialect.Validate(); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, dialect: dialect}, nil
+}
+
+// Migrate creates the progress table. It is safe to call on every start.
+func (s *Store) Migrate(ctx context.Context) error {
+	stmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS sp_backfills (
+	name TEXT PRIMARY KEY,
+	progress %s NOT NULL,
+	updated_at %s NOT NULL
+)`, s.dialect.JSONType(), s.dialect.TimeType())
+	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("create backfill table: %w", err)
+	}
+	return nil
+}
+
+// Load returns the progress saved under name, or adapters.ErrNotFound.
+func (s *Store) Load(ctx context.Context, name string) (backfill.Progress, error) {
+	var raw string
+	err := s.db.QueryRowContext(ctx, s.dialect.Rebind(`SELECT progress FROM sp_backfills WHERE name = ?`), name).Scan(&raw)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return backfill.Progress{}, adapters.ErrNotFound
+	}
+	if err != nil {
+		return backfill.Progress{}, fmt.Errorf("load progress: %w", err)
+	}
+
+	var progress backfill.Progress
+	if err := json.Unmarshal([]byte(raw), &progress); err != nil {
+		return backfill.Progress{}, fmt.Errorf("decode progress: %w", err)
+	}
+	return progress, nil
+}
+
+// Save replaces the progress saved under its name.
+func (s *Store) Save(ctx context.Context, progress backfill.Progress) error {
+	if progress.Name == "" {
+		return errors.New("backfill name is required")
+	}
+	payload, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("marshal progress: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, s.dialect.Rebind(`INSERT INTO sp_backfills (name, progress, updated_at) VALUES (?, ?, ?)
+ON CONFLICT (name) DO UPDATE SET progress = excluded.progress, updated_at = excluded.updated_at`),
+		progress.Name, string(payload), progress.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("save progress: %w", err)
+	}
+	return nil
+}
+
+var _ backfill.Store = (*Store)(nil)
@@ -0,0 +1,43 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/backfill"
+	_ "modernc.org/sqlite"
+)
+
+func TestStoreSavesProgress(t *testing.T) {
+	ctx := context.Background()
+	db, err := stdsql.Open("sqlite", filepath.Join(t.TempDir(), "backfill.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := New(db, SQLite)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate error: %v", err)
+	}
+	if _, err := store.Load(ctx, "ocr@2"); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	for _, cursor := range []string{"f1", "f2"} {
+		if err := store.Save(ctx, backfill.Progress{Name: "ocr@2", Cursor: cursor, Scanned: 2}); err != nil {
+			t.Fatalf("Save error: %v", err)
+		}
+	}
+	progress, err := store.Load(ctx, "ocr@2")
+	if err != nil || progress.Cursor != "f2" || progress.Scanned != 2 {
+		t.Fatalf("Load = %+v, %v", progress, err)
+	}
+}
@@ -0,0 +1,42 @@
+package backfill
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+)
+
+// MemoryStore is an in-memory Store for tests and examples.
+type MemoryStore struct {
+	mu       sync.Mutex
+	progress map[string]Progress
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{progress: make(map[string]Progress)}
+}
+
+// Load returns the progress saved under name, or adapters.ErrNotFound.
+func (s *MemoryStore) Load(ctx context.Context, name string) (Progress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	progress, ok := s.progress[name]
+	if !ok {
+		return Progress{}, adapters.ErrNotFound
+	}
+	return progress, nil
+}
+
+// Save replaces the progress saved under its name.
+func (s *MemoryStore) Save(ctx context.Context, progress Progress) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.progress[progress.Name] = progress
+	return nil
+}
+
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,98 @@
+// Package clock abstracts time so that components waiting on it, such as the
+// scheduler, can be driven by a fake clock in tests.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits for it to pass.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel that receives the time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the system clock.
+type Real struct{}
+
+// Now returns the current time.
+func (Real) Now() time.Time { return time.Now() }
+
+// After waits for d with time.After.
+func (Real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Fake is a Clock that only moves when told to. Channels returned by After fire
+// once Advance or Set moves the time past their deadline.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFake creates a Fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the fake time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// After returns a channel that fires once the fake time reaches Now()+d.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	at := f.now.Add(d)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, fakeWaiter{at: at, ch: ch})
+	sort.Slice(f.waiters, func(i, j int) bool { return f.waiters[i].at.Before(f.waiters[j].at) })
+	return ch
+}
+
+// Advance moves the fake time forward by d.
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the fake time to t and fires every waiter whose deadline has passed.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = t
+	for len(f.waiters) > 0 && !f.waiters[0].at.After(t) {
+		f.waiters[0].ch <- t
+		f.waiters = f.waiters[1:]
+	}
+}
+
+// Waiters reports how many After channels have not fired yet, so tests can wait
+// until a component is blocked on the clock before advancing it.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.waiters)
+}
+
+var (
+	_ Clock = Real{}
+	_ Clock = (*Fake)(nil)
+)
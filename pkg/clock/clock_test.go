@@ -0,0 +1,42 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeFiresWaitersInOrder(t *testing.T) {
+	start := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+
+	late, early := c.After(time.Minute), c.After(10*time.Second)
+	select {
+	case <-c.After(0):
+	default:
+		t.Fatal("expected a zero wait to fire immediately")
+	}
+	if c.Waiters() != 2 {
+		t.Fatalf("expected 2 waiters, got %d", c.Waiters())
+	}
+
+	c.Advance(30 * time.Second)
+	select {
+	case at := <-early:
+		if !at.Equal(start.Add(30 * time.Second)) {
+			t.Fatalf("unexpected fire time %v", at)
+		}
+	default:
+		t.Fatal("expected the early waiter to fire")
+	}
+	select {
+	case <-late:
+		t.Fatal("late waiter fired too soon")
+	default:
+	}
+
+	c.Set(start.Add(time.Hour))
+	<-late
+	if c.Waiters() != 0 || !c.Now().Equal(start.Add(time.Hour)) {
+		t.Fatalf("unexpected clock state: %v, %d waiters", c.Now(), c.Waiters())
+	}
+}
@@ -15,6 +15,9 @@ type CloudEvent struct {
 	Time            time.Time       `json:"time"`
 	DataContentType string          `json:"datacontenttype"`
 	Data            json.RawMessage `json:"data"`
+	// Priority is an extension attribute mirroring Job.Priority, so brokers and
+	// routers can order events without decoding their data.
+	Priority int `json:"priority,omitempty"`
 }
 
 const (
@@ -46,10 +49,12 @@ func NewJobCloudEvent(source string, job Job) (CloudEvent, error) {
 		Time:            time.Now().UTC(),
 		DataContentType: jobDataContentType,
 		Data:            payload,
+		Priority:        job.Priority,
 	}, nil
 }
 
-// DecodeJob extracts a Job from the CloudEvent payload.
+// DecodeJob extracts a Job from the CloudEvent payload. A priority set only on the
+// envelope is copied into the job.
 func (e CloudEvent) DecodeJob() (Job, error) {
 	if e.DataContentType != jobDataContentType {
 		return Job{}, fmt.Errorf("unexpected data content type: %s", e.DataContentType)
@@ -59,5 +64,8 @@ func (e CloudEvent) DecodeJob() (Job, error) {
 	if err := json.Unmarshal(e.Data, &job); err != nil {
 		return Job{}, fmt.Errorf("decode job: %w", err)
 	}
+	if job.Priority == 0 {
+		job.Priority = e.Priority
+	}
 	return job, nil
 }
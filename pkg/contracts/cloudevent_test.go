@@ -50,3 +50,22 @@ func TestNewJobCloudEventRequiresJobID(t *testing.T) {
 		t.Fatalf("expected error when job ID missing")
 	}
 }
+
+func TestCloudEventCarriesPriorityExtension(t *testing.T) {
+	event, err := NewJobCloudEvent("src", Job{JobID: "job-1", Priority: 5})
+	if err != nil {
+		t.Fatalf("NewJobCloudEvent returned error: %v", err)
+	}
+	raw, _ := json.Marshal(event)
+	var envelope map[string]interface{}
+	if err := json.Unmarshal(raw, &envelope); err != nil || envelope["priority"] != float64(5) {
+		t.Fatalf("expected a top-level priority attribute, got %s", raw)
+	}
+
+	// A router may set the extension without touching the data.
+	payload, _ := json.Marshal(Job{JobID: "job-2"})
+	decoded, err := CloudEvent{DataContentType: "application/json", Data: payload, Priority: 3}.DecodeJob()
+	if err != nil || decoded.Priority != 3 {
+		t.Fatalf("DecodeJob = %+v, %v", decoded, err)
+	}
+}
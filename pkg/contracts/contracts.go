@@ -1,5 +1,7 @@
 package contracts
 
+import "time"
+
 // Job represents the data contract for a unit of work.
 // It contains all the information needed for a UoW to process a file.
 type Job struct {
@@ -11,6 +13,28 @@ type Job struct {
 	Return       Return            `json:"return"`
 	IdemKey      string            `json:"idem_key"`
 	Hints        map[string]string `json:"hints"`
+	// ArtifactUpload lets workers without storage credentials upload their outputs.
+	ArtifactUpload *ArtifactUpload `json:"artifact_upload,omitempty"`
+	// ChildResults carries the results of a fanned-out step's child jobs, in order,
+	// to the reducer that aggregates them.
+	ChildResults []Result `json:"child_results,omitempty"`
+	// NotBefore delays the job until the given time. It needs a bus that can hold
+	// jobs, see adapters.DelayingBus.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	// Priority orders waiting jobs; higher values run first. Zero is the default.
+	Priority int `json:"priority,omitempty"`
+}
+
+// ArtifactUpload grants write access to artifact locations under Prefix.
+// Workers POST a multipart form to URL containing Fields, a "key" field set to
+// KeyPrefix plus the artifact name, and finally the content in a "file" field.
+// The stored artifact location is Prefix plus the same name.
+type ArtifactUpload struct {
+	Prefix    string            `json:"prefix"`
+	KeyPrefix string            `json:"key_prefix"`
+	URL       string            `json:"url"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Expires   time.Time         `json:"expires"`
 }
 
 // File represents the file to be processed.
@@ -44,14 +68,48 @@ type Result struct {
 	FileID          string                 `json:"file_id"`
 	AttributesPatch map[string]interface{} `json:"attributes_patch"`
 	Artifacts       []Artifact             `json:"artifacts"`
+	// ChildJobs splits the work into jobs, e.g. one per byte or page range in Hints,
+	// that run in parallel before a reducer merges their results.
+	ChildJobs []Job `json:"child_jobs,omitempty"`
+	// UoWVersion is the version of the UoW implementation that produced the result.
+	UoWVersion string `json:"uow_version,omitempty"`
 }
 
 // Artifact represents a file or data generated by a UoW.
 // It includes metadata about the artifact and its location.
+// An artifact's identity is its file plus UoW, Kind and Key; recording an artifact
+// with an existing identity replaces the earlier record.
 type Artifact struct {
 	Kind     string `json:"kind"`
 	MIME     string `json:"mime"`
 	Bytes    int64  `json:"bytes"`
 	Location string `json:"location"`
+	// UoW names the producing unit of work; Key distinguishes several artifacts of one kind.
+	UoW string `json:"uow,omitempty"`
+	Key string `json:"key,omitempty"`
+	// Checksum is an optional content digest such as "sha256:<hex>".
+	Checksum string `json:"checksum,omitempty"`
+	// JobID and Version identify the run that produced the artifact.
+	JobID   string `json:"job_id,omitempty"`
+	Version string `json:"version,omitempty"`
+	// CreatedAt is stamped by the metadata backend when left zero.
+	CreatedAt time.Time `json:"created_at"`
 }
 
+// Provenance records which UoW run produced a value.
+type Provenance struct {
+	UoW       string    `json:"uow"`
+	JobID     string    `json:"job_id"`
+	Version   string    `json:"version,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AttributeChange is one entry in a file's attribute audit history.
+// Value holds the top-level attribute after the change; Deleted marks removals.
+type AttributeChange struct {
+	Revision   int64       `json:"revision"`
+	Key        string      `json:"key"`
+	Value      interface{} `json:"value,omitempty"`
+	Deleted    bool        `json:"deleted,omitempty"`
+	Provenance Provenance  `json:"provenance"`
+}
@@ -0,0 +1,134 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// MemoryStore is an in-memory Store for tests and examples. It cannot share a
+// transaction with anything, so it only demonstrates the relay semantics.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries []*memoryEntry
+	byID    map[string]*memoryEntry
+	waiting int
+}
+
+type memoryEntry struct {
+	Entry
+	published bool
+	parked    bool
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{byID: make(map[string]*memoryEntry)}
+}
+
+// Enqueue adds the job unless an entry with the same job ID already exists.
+func (s *MemoryStore) Enqueue(ctx context.Context, job contracts.Job) error {
+	if job.JobID == "" {
+		return errors.New("job id is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byID[job.JobID]; ok {
+		return nil
+	}
+	entry := &memoryEntry{Entry: Entry{Job: job, CreatedAt: time.Now().UTC()}}
+	s.entries = append(s.entries, entry)
+	s.byID[job.JobID] = entry
+	s.waiting++
+	return nil
+}
+
+// Pending returns up to limit unpublished entries, oldest first.
+func (s *MemoryStore) Pending(ctx context.Context, limit int) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Entry
+	for _, entry := range s.entries {
+		if len(out) == limit {
+			break
+		}
+		if !entry.published && !entry.parked {
+			out = append(out, entry.Entry)
+		}
+	}
+	return out, nil
+}
+
+// Parked returns up to limit parked entries, oldest first.
+func (s *MemoryStore) Parked(ctx context.Context, limit int) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Entry
+	for _, entry := range s.entries {
+		if len(out) == limit {
+			break
+		}
+		if entry.parked {
+			out = append(out, entry.Entry)
+		}
+	}
+	return out, nil
+}
+
+// MarkPublished records that the jobs reached the bus.
+func (s *MemoryStore) MarkPublished(ctx context.Context, jobIDs ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range jobIDs {
+		if entry, ok := s.byID[id]; ok && !entry.published {
+			if !entry.parked {
+				s.waiting--
+			}
+			entry.published = true
+		}
+	}
+	return nil
+}
+
+// MarkFailed records a failed publish attempt for the job.
+func (s *MemoryStore) MarkFailed(ctx context.Context, jobID string, cause error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.byID[jobID]; ok {
+		entry.Attempts++
+		entry.LastError = cause.Error()
+	}
+	return nil
+}
+
+// Park sets the job aside so Pending no longer returns it.
+func (s *MemoryStore) Park(ctx context.Context, jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.byID[jobID]; ok && !entry.published && !entry.parked {
+		entry.parked = true
+		s.waiting--
+	}
+	return nil
+}
+
+// Len reports how many entries are still waiting to be published, excluding
+// parked ones.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.waiting
+}
+
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,173 @@
+// Package outbox implements the transactional outbox pattern: jobs are recorded in
+// the same transaction as the business change that requires them, and a Relay
+// publishes them to an adapters.Bus afterwards. A crash between the commit and the
+// publish therefore delays the job instead of losing it.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// Entry is a job waiting in the outbox.
+type Entry struct {
+	Job       contracts.Job
+	CreatedAt time.Time
+	Attempts  int
+	LastError string
+}
+
+// Store persists outbox entries. Entries are keyed by Job.JobID: enqueueing a job
+// whose ID is already in the outbox is a no-op, which deduplicates retried writes.
+type Store interface {
+	// Pending returns up to limit unpublished entries, oldest first.
+	Pending(ctx context.Context, limit int) ([]Entry, error)
+	// MarkPublished records that the jobs reached the bus.
+	MarkPublished(ctx context.Context, jobIDs ...string) error
+	// MarkFailed records a failed publish attempt for the job.
+	MarkFailed(ctx context.Context, jobID string, cause error) error
+	// Park sets the job aside after its last allowed attempt. Parked entries are
+	// no longer pending, so they stop holding back the entries behind them.
+	Park(ctx context.Context, jobID string) error
+}
+
+// Relay moves pending outbox entries onto a bus.
+type Relay struct {
+	store       Store
+	bus         adapters.Bus
+	batch       int
+	interval    time.Duration
+	maxAttempts int
+}
+
+// RelayOption customises a Relay.
+type RelayOption func(*Relay)
+
+// WithBatchSize bounds the entries published per round; defaults to 100.
+func WithBatchSize(n int) RelayOption {
+	return func(r *Relay) { r.batch = n }
+}
+
+// WithInterval sets how often Run polls the store; defaults to one second.
+func WithInterval(d time.Duration) RelayOption {
+	return func(r *Relay) { r.interval = d }
+}
+
+// WithMaxAttempts parks an entry once n publishes of it have failed; defaults to 10.
+func WithMaxAttempts(n int) RelayOption {
+	return func(r *Relay) { r.maxAttempts = n }
+}
+
+// NewRelay creates a Relay publishing entries from store onto bus.
+func NewRelay(store Store, bus adapters.Bus, opts ...RelayOption) (*Relay, error) {
+	if store == nil {
+		return nil, errors.New("outbox store is required")
+	}
+	if bus == nil {
+		return nil, errors.New("bus is required")
+	}
+	r := &Relay{store: store, bus: bus, batch: 100, interval: time.Second, maxAttempts: 10}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.batch <= 0 {
+		return nil, errors.New("batch size must be positive")
+	}
+	if r.interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+	if r.maxAttempts <= 0 {
+		return nil, errors.New("max attempts must be positive")
+	}
+	return r, nil
+}
+
+// Run relays entries until ctx is cancelled. Publish errors are recorded on the
+// entry and retried on the next round.
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := r.RelayOnce(ctx)
+			if err != nil && ctx.Err() == nil {
+				fmt.Printf("outbox relay: %v\n", err)
+			}
+			// Keep draining while full batches go out cleanly.
+			if err != nil || n < r.batch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publishes one batch of pending entries in order and returns how many
+// were published. It stops at the first publish failure so a later entry never
+// overtakes an earlier one, unless that failure was the entry's last allowed
+// attempt: the entry is then parked and the relay moves on. Delivery is
+// at-least-once: a crash after publishing but before MarkPublished republishes
+// the entry, so consumers should dedup by Job.JobID.
+//
+// Jobs whose NotBefore is still ahead go out through PublishAt when the bus is an
+// adapters.DelayingBus. Other buses cannot hold them, so they stay in the outbox
+// until they are due while later entries go ahead.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	entries, err := r.store.Pending(ctx, r.batch)
+	if err != nil {
+		return 0, fmt.Errorf("load pending entries: %w", err)
+	}
+
+	now := time.Now()
+	published := make([]string, 0, len(entries))
+	var publishErr error
+	for _, entry := range entries {
+		job := entry.Job
+		delaying, canDelay := r.bus.(adapters.DelayingBus)
+		switch {
+		case job.NotBefore == nil || !job.NotBefore.After(now):
+			err = r.bus.Publish(ctx, job)
+		case canDelay:
+			err = delaying.PublishAt(ctx, job, *job.NotBefore)
+		default:
+			continue
+		}
+		if err == nil {
+			published = append(published, job.JobID)
+			continue
+		}
+
+		failure := fmt.Errorf("publish job %s: %w", job.JobID, err)
+		if markErr := r.store.MarkFailed(ctx, job.JobID, err); markErr != nil {
+			publishErr = errors.Join(publishErr, failure, markErr)
+			break
+		}
+		if entry.Attempts+1 < r.maxAttempts {
+			publishErr = errors.Join(publishErr, failure)
+			break
+		}
+		if parkErr := r.store.Park(ctx, job.JobID); parkErr != nil {
+			publishErr = errors.Join(publishErr, failure, parkErr)
+			break
+		}
+		publishErr = errors.Join(publishErr, fmt.Errorf("%w; parked after %d attempts", failure, entry.Attempts+1))
+	}
+
+	if len(published) > 0 {
+		if err := r.store.MarkPublished(ctx, published...); err != nil {
+			return 0, errors.Join(publishErr, fmt.Errorf("mark published: %w", err))
+		}
+	}
+	return len(published), publishErr
+}
@@ -0,0 +1,154 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+type flakyBus struct {
+	failOn    string
+	published []string
+}
+
+func (b *flakyBus) Publish(ctx context.Context, job contracts.Job) error {
+	if job.JobID == b.failOn {
+		b.failOn = ""
+		return errors.New("broker unavailable")
+	}
+	b.published = append(b.published, job.JobID)
+	return nil
+}
+
+func TestRelayPublishesInOrderAndRetries(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, id := range []string{"a", "b", "c", "a"} {
+		if err := store.Enqueue(ctx, contracts.Job{JobID: id}); err != nil {
+			t.Fatalf("Enqueue error: %v", err)
+		}
+	}
+	if store.Len() != 3 {
+		t.Fatalf("expected duplicate job id to be ignored, got %d entries", store.Len())
+	}
+
+	bus := &flakyBus{failOn: "b"}
+	relay, err := NewRelay(store, bus)
+	if err != nil {
+		t.Fatalf("NewRelay error: %v", err)
+	}
+
+	n, err := relay.RelayOnce(ctx)
+	if err == nil || n != 1 {
+		t.Fatalf("expected one publish before the failure, got %d (%v)", n, err)
+	}
+	pending, _ := store.Pending(ctx, 10)
+	if len(pending) != 2 || pending[0].Job.JobID != "b" || pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Fatalf("expected the failed entry to stay first with its error recorded, got %+v", pending)
+	}
+
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("expected the remaining entries to publish, got %d (%v)", n, err)
+	}
+	if got := bus.published; len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("unexpected publish order: %v", got)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("expected empty outbox, got %d entries", store.Len())
+	}
+}
+
+type brokenBus struct{ published []string }
+
+func (b *brokenBus) Publish(ctx context.Context, job contracts.Job) error {
+	if job.JobID == "poison" {
+		return errors.New("job too large")
+	}
+	b.published = append(b.published, job.JobID)
+	return nil
+}
+
+func TestRelayParksEntriesAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.Enqueue(ctx, contracts.Job{JobID: "poison"})
+	store.Enqueue(ctx, contracts.Job{JobID: "next"})
+
+	bus := &brokenBus{}
+	relay, err := NewRelay(store, bus, WithMaxAttempts(2))
+	if err != nil {
+		t.Fatalf("NewRelay error: %v", err)
+	}
+
+	if n, err := relay.RelayOnce(ctx); err == nil || n != 0 {
+		t.Fatalf("expected the first failure to hold the outbox, got %d (%v)", n, err)
+	}
+	// The last attempt parks the poison entry and lets the next one through.
+	n, err := relay.RelayOnce(ctx)
+	if err == nil || !strings.Contains(err.Error(), "parked after 2 attempts") || n != 1 {
+		t.Fatalf("expected the entry to be parked, got %d (%v)", n, err)
+	}
+	if len(bus.published) != 1 || bus.published[0] != "next" {
+		t.Fatalf("unexpected published jobs: %v", bus.published)
+	}
+	parked, _ := store.Parked(ctx, 10)
+	if len(parked) != 1 || parked[0].Job.JobID != "poison" || parked[0].Attempts != 2 {
+		t.Fatalf("unexpected parked entries: %+v", parked)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("expected no waiting entries, got %d", store.Len())
+	}
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("expected parked entries to be left alone, got %d (%v)", n, err)
+	}
+}
+
+type delayingBus struct {
+	flakyBus
+	at map[string]time.Time
+}
+
+func (b *delayingBus) PublishAt(ctx context.Context, job contracts.Job, at time.Time) error {
+	b.at[job.JobID] = at
+	return nil
+}
+
+func TestRelayDelaysFutureJobs(t *testing.T) {
+	ctx := context.Background()
+	later := time.Now().Add(time.Hour)
+	earlier := time.Now().Add(-time.Minute)
+
+	newStore := func() *MemoryStore {
+		store := NewMemoryStore()
+		store.Enqueue(ctx, contracts.Job{JobID: "later", NotBefore: &later})
+		store.Enqueue(ctx, contracts.Job{JobID: "due", NotBefore: &earlier})
+		store.Enqueue(ctx, contracts.Job{JobID: "now"})
+		return store
+	}
+
+	// A delaying bus holds the job itself.
+	delaying := &delayingBus{at: map[string]time.Time{}}
+	relay, _ := NewRelay(newStore(), delaying)
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 3 {
+		t.Fatalf("RelayOnce = %d, %v", n, err)
+	}
+	if !delaying.at["later"].Equal(later) || len(delaying.published) != 2 {
+		t.Fatalf("expected only the future job to go through PublishAt, got %v %v", delaying.at, delaying.published)
+	}
+
+	// Other buses cannot, so the job waits in the outbox without blocking the rest.
+	store := newStore()
+	plain := &flakyBus{}
+	relay, _ = NewRelay(store, plain)
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("RelayOnce = %d, %v", n, err)
+	}
+	pending, _ := store.Pending(ctx, 10)
+	if len(pending) != 1 || pending[0].Job.JobID != "later" || len(plain.published) != 2 {
+		t.Fatalf("expected the future job to stay pending, got %+v %v", pending, plain.published)
+	}
+}
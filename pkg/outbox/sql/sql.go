@@ -0,0 +1,181 @@
+// Package sql implements outbox.Store on top of database/sql for SQLite and
+// Postgres. Enqueue takes the caller's transaction so the job commits or rolls
+// back together with the change that produced it.
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tendant/simple-process/internal/sqldialect"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/outbox"
+)
+
+// Dialect selects the SQL flavour used by the store.
+type Dialect = sqldialect.Dialect
+
+// Supported dialects.
+const (
+	SQLite   = sqldialect.SQLite
+	Postgres = sqldialect.Postgres
+)
+
+// Store keeps outbox entries in the sp_outbox table.
+type Store struct {
+	db      *stdsql.DB
+	dialect Dialect
+}
+
+// New wraps an open database handle. Call Migrate to create the table.
+func New(db *stdsql.DB, dialect Dialect) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("database handle is required")
+	}
+	if err := dialect.Validate(); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, dialect: dialect}, nil
+}
+
+// Migrate creates the outbox table. It is safe to call on every start.
+func (s *Store) Migrate(ctx context.Context) error {
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS sp_outbox (
+	id %s,
+	job_id TEXT NOT NULL UNIQUE,
+	job TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at %s NOT NULL,
+	published_at %s,
+	parked_at %s
+)`, s.dialect.SerialType(), s.dialect.TimeType(), s.dialect.TimeType(), s.dialect.TimeType()),
+		`CREATE INDEX IF NOT EXISTS sp_outbox_pending ON sp_outbox (id) WHERE published_at IS NULL AND parked_at IS NULL`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create outbox table: %w", err)
+		}
+	}
+	return nil
+}
+
+// Enqueue records the job inside tx. A job whose ID is already in the outbox is
+// ignored, so retried requests do not publish twice.
+func (s *Store) Enqueue(ctx context.Context, tx *stdsql.Tx, job contracts.Job) error {
+	if tx == nil {
+		return errors.New("transaction is required")
+	}
+	if job.JobID == "" {
+		return errors.New("job id is required")
+	}
+
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("marshal job: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, s.dialect.Rebind(`INSERT INTO sp_outbox (job_id, job, created_at) VALUES (?, ?, ?) ON CONFLICT (job_id) DO NOTHING`),
+		job.JobID, string(payload), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("enqueue job: %w", err)
+	}
+	return nil
+}
+
+// Pending returns up to limit unpublished entries, oldest first.
+func (s *Store) Pending(ctx context.Context, limit int) ([]outbox.Entry, error) {
+	entries, err := s.entries(ctx, `published_at IS NULL AND parked_at IS NULL`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("load pending entries: %w", err)
+	}
+	return entries, nil
+}
+
+// Parked returns up to limit parked entries, oldest first.
+func (s *Store) Parked(ctx context.Context, limit int) ([]outbox.Entry, error) {
+	entries, err := s.entries(ctx, `parked_at IS NOT NULL`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("load parked entries: %w", err)
+	}
+	return entries, nil
+}
+
+func (s *Store) entries(ctx context.Context, where string, limit int) ([]outbox.Entry, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(`SELECT job, attempts, last_error, created_at FROM sp_outbox
+WHERE `+where+` ORDER BY id LIMIT ?`), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []outbox.Entry
+	for rows.Next() {
+		var (
+			raw   string
+			entry outbox.Entry
+		)
+		if err := rows.Scan(&raw, &entry.Attempts, &entry.LastError, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &entry.Job); err != nil {
+			return nil, fmt.Errorf("decode job: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// MarkPublished records that the jobs reached the bus.
+func (s *Store) MarkPublished(ctx context.Context, jobIDs ...string) error {
+	if len(jobIDs) == 0 {
+		return nil
+	}
+
+	args := []interface{}{time.Now().UTC()}
+	for _, id := range jobIDs {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(jobIDs)), ", ")
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(`UPDATE sp_outbox SET published_at = ? WHERE job_id IN (`+placeholders+`)`), args...)
+	if err != nil {
+		return fmt.Errorf("mark published: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed records a failed publish attempt for the job.
+func (s *Store) MarkFailed(ctx context.Context, jobID string, cause error) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(`UPDATE sp_outbox SET attempts = attempts + 1, last_error = ? WHERE job_id = ?`), cause.Error(), jobID)
+	if err != nil {
+		return fmt.Errorf("mark failed: %w", err)
+	}
+	return nil
+}
+
+// Park sets the job aside so Pending no longer returns it.
+func (s *Store) Park(ctx context.Context, jobID string) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(`UPDATE sp_outbox SET parked_at = ? WHERE job_id = ? AND published_at IS NULL`), time.Now().UTC(), jobID)
+	if err != nil {
+		return fmt.Errorf("park entry: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes entries published before the cutoff. Published rows are kept
+// until then so that late duplicates of a job ID are still ignored.
+func (s *Store) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.dialect.Rebind(`DELETE FROM sp_outbox WHERE published_at IS NOT NULL AND published_at < ?`), before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("purge outbox: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+var _ outbox.Store = (*Store)(nil)
@@ -0,0 +1,185 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/adapters/bus"
+	metadatasql "github.com/tendant/simple-process/pkg/adapters/metadata/sql"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/outbox"
+	_ "modernc.org/sqlite"
+)
+
+func TestEnqueueFollowsTransaction(t *testing.T) {
+	ctx := context.Background()
+	db, err := stdsql.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := New(db, SQLite)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate error: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `CREATE TABLE files (id TEXT PRIMARY KEY)`); err != nil {
+		t.Fatalf("create files table: %v", err)
+	}
+
+	createFile := func(id string, commit bool) {
+		t.Helper()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("begin: %v", err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.ExecContext(ctx, `INSERT INTO files (id) VALUES (?) ON CONFLICT DO NOTHING`, id); err != nil {
+			t.Fatalf("insert file: %v", err)
+		}
+		if err := store.Enqueue(ctx, tx, contracts.Job{JobID: "job-" + id, UoW: "hash", File: contracts.File{ID: id}}); err != nil {
+			t.Fatalf("Enqueue error: %v", err)
+		}
+		if commit {
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("commit: %v", err)
+			}
+		}
+	}
+
+	createFile("rolled-back", false)
+	createFile("f1", true)
+	createFile("f1", true)
+
+	pending, err := store.Pending(ctx, 10)
+	if err != nil {
+		t.Fatalf("Pending error: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Job.File.ID != "f1" {
+		t.Fatalf("expected only the committed job, got %+v", pending)
+	}
+
+	memBus := bus.NewMemoryBus(10)
+	relay, err := outbox.NewRelay(store, memBus)
+	if err != nil {
+		t.Fatalf("NewRelay error: %v", err)
+	}
+	if n, err := relay.RelayOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("RelayOnce: %d %v", n, err)
+	}
+	subCtx, stop := context.WithCancel(ctx)
+	memBus.Subscribe(subCtx, bus.DefaultTopic, "test", func(_ context.Context, msg adapters.Message) error {
+		if msg.Job().JobID != "job-f1" {
+			t.Errorf("unexpected job: %+v", msg.Job())
+		}
+		stop()
+		return nil
+	})
+
+	// A retried request after publishing must not enqueue the job again.
+	createFile("f1", true)
+	if pending, _ := store.Pending(ctx, 10); len(pending) != 0 {
+		t.Fatalf("expected no pending entries, got %+v", pending)
+	}
+
+	purged, err := store.Purge(ctx, time.Now().Add(time.Minute))
+	if err != nil || purged != 1 {
+		t.Fatalf("Purge: %d %v", purged, err)
+	}
+}
+
+func TestEnqueueRollsBackWithMetadata(t *testing.T) {
+	ctx := context.Background()
+	db, err := stdsql.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, _ := New(db, SQLite)
+	meta, _ := metadatasql.New(db, metadatasql.SQLite)
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate error: %v", err)
+	}
+	if err := meta.Migrate(ctx); err != nil {
+		t.Fatalf("metadata Migrate error: %v", err)
+	}
+
+	upload := func(id string, commit bool) {
+		t.Helper()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("begin: %v", err)
+		}
+		defer tx.Rollback()
+		if err := meta.UpdateFileAttributesTx(ctx, tx, id, map[string]interface{}{"status": "uploaded"}); err != nil {
+			t.Fatalf("UpdateFileAttributesTx error: %v", err)
+		}
+		if err := store.Enqueue(ctx, tx, contracts.Job{JobID: "job-" + id, UoW: "hash", File: contracts.File{ID: id}}); err != nil {
+			t.Fatalf("Enqueue error: %v", err)
+		}
+		if commit {
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("commit: %v", err)
+			}
+		}
+	}
+
+	upload("rolled-back", false)
+	upload("f1", true)
+
+	if _, err := meta.GetFileAttributes(ctx, "rolled-back"); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("expected rolled back attributes to be gone, got %v", err)
+	}
+	if attrs, err := meta.GetFileAttributes(ctx, "f1"); err != nil || attrs["status"] != "uploaded" {
+		t.Fatalf("GetFileAttributes = %v, %v", attrs, err)
+	}
+	pending, _ := store.Pending(ctx, 10)
+	if len(pending) != 1 || pending[0].Job.File.ID != "f1" {
+		t.Fatalf("expected only the committed job, got %+v", pending)
+	}
+}
+
+func TestParkedEntriesLeavePending(t *testing.T) {
+	ctx := context.Background()
+	db, err := stdsql.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, _ := New(db, SQLite)
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate error: %v", err)
+	}
+	for _, id := range []string{"poison", "next"} {
+		tx, _ := db.BeginTx(ctx, nil)
+		if err := store.Enqueue(ctx, tx, contracts.Job{JobID: id}); err != nil {
+			t.Fatalf("Enqueue error: %v", err)
+		}
+		tx.Commit()
+	}
+
+	if err := store.MarkFailed(ctx, "poison", errors.New("job too large")); err != nil {
+		t.Fatalf("MarkFailed error: %v", err)
+	}
+	if err := store.Park(ctx, "poison"); err != nil {
+		t.Fatalf("Park error: %v", err)
+	}
+	pending, _ := store.Pending(ctx, 10)
+	if len(pending) != 1 || pending[0].Job.JobID != "next" {
+		t.Fatalf("expected the parked entry to leave pending, got %+v", pending)
+	}
+	parked, err := store.Parked(ctx, 10)
+	if err != nil || len(parked) != 1 || parked[0].Job.JobID != "poison" || parked[0].Attempts != 1 || parked[0].LastError != "job too large" {
+		t.Fatalf("Parked = %+v, %v", parked, err)
+	}
+}
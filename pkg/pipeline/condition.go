@@ -0,0 +1,492 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Condition is a parsed step condition. The language is deliberately small:
+//
+//	mime startsWith "image/" && file.size < 50MB
+//	steps.ocr.status == "succeeded" or lang in ["en", "de"]
+//
+// Operands are string, number, true, false and null literals, lists in square
+// brackets, and dotted paths resolved by the caller. Numbers may carry a binary
+// size unit (KB, MB, GB, TB). Comparisons are ==, !=, <, <=, >, >=, startsWith,
+// endsWith, contains and in; they combine with &&/and, ||/or, !/not and
+// parentheses. A bare operand is true unless it is missing, null or false.
+// Ordering or string operators applied to a missing value are false.
+type Condition struct {
+	src   string
+	root  node
+	paths [][]string
+}
+
+// ParseCondition compiles src.
+func ParseCondition(src string) (*Condition, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+	}
+	return &Condition{src: src, root: root, paths: p.paths}, nil
+}
+
+// String returns the source of the condition.
+func (c *Condition) String() string {
+	return c.src
+}
+
+// Eval evaluates the condition, resolving paths with lookup. lookup returns nil
+// for paths that do not exist.
+func (c *Condition) Eval(lookup func(path []string) interface{}) (bool, error) {
+	v, err := c.root.eval(lookup)
+	if err != nil {
+		return false, fmt.Errorf("condition %q: %w", c.src, err)
+	}
+	return truthy(v), nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+var sizeUnits = map[string]float64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != src[i] {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			text, err := strconv.Unquote(src[i : j+1])
+			if c == '\'' {
+				// Single-quoted strings only support escaping the quote itself.
+				text, err = strings.ReplaceAll(src[i+1:j], `\'`, `'`), nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d: %w", i, err)
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: i})
+			i = j + 1
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			num, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at offset %d", src[i:j], i)
+			}
+			k := j
+			for k < len(src) && unicode.IsLetter(rune(src[k])) {
+				k++
+			}
+			if k > j {
+				unit, ok := sizeUnits[src[j:k]]
+				if !ok {
+					return nil, fmt.Errorf("unknown unit %q at offset %d", src[j:k], j)
+				}
+				num *= unit
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[i:k], num: num, pos: i})
+			i = k
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || strings.ContainsRune("_-.", rune(src[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, text: "end of condition", pos: len(src)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	paths  [][]string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the given operators or keywords.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.next()
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	for err == nil {
+		if _, ok := p.accept("||", "or"); !ok {
+			return left, nil
+		}
+		var right node
+		if right, err = p.and(); err == nil {
+			left = logicNode{or: true, left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.not()
+	for err == nil {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return left, nil
+		}
+		var right node
+		if right, err = p.not(); err == nil {
+			left = logicNode{left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *parser) not() (node, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x: x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "startsWith", "endsWith", "contains", "in")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) operand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return literalNode{v: t.text}, nil
+	case tokNumber:
+		return literalNode{v: t.num}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literalNode{v: true}, nil
+		case "false":
+			return literalNode{v: false}, nil
+		case "null":
+			return literalNode{}, nil
+		case "and", "or", "not", "in", "startsWith", "endsWith", "contains":
+			return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+		}
+		path := strings.Split(t.text, ".")
+		for _, part := range path {
+			if part == "" {
+				return nil, fmt.Errorf("invalid path %q at offset %d", t.text, t.pos)
+			}
+		}
+		p.paths = append(p.paths, path)
+		return pathNode{path: path}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, fmt.Errorf("expected ) at offset %d", p.peek().pos)
+			}
+			return x, nil
+		case "[":
+			var items listNode
+			if _, ok := p.accept("]"); ok {
+				return items, nil
+			}
+			for {
+				item, err := p.operand()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+				if _, ok := p.accept("]"); ok {
+					return items, nil
+				}
+				if _, ok := p.accept(","); !ok {
+					return nil, fmt.Errorf("expected , or ] at offset %d", p.peek().pos)
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
+
+type node interface {
+	eval(lookup func([]string) interface{}) (interface{}, error)
+}
+
+type literalNode struct{ v interface{} }
+
+func (n literalNode) eval(func([]string) interface{}) (interface{}, error) {
+	return n.v, nil
+}
+
+type pathNode struct{ path []string }
+
+func (n pathNode) eval(lookup func([]string) interface{}) (interface{}, error) {
+	return normalize(lookup(n.path)), nil
+}
+
+type listNode []node
+
+func (n listNode) eval(lookup func([]string) interface{}) (interface{}, error) {
+	out := make([]interface{}, len(n))
+	for i, item := range n {
+		v, err := item.eval(lookup)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+type notNode struct{ x node }
+
+func (n notNode) eval(lookup func([]string) interface{}) (interface{}, error) {
+	v, err := n.x.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+type logicNode struct {
+	or          bool
+	left, right node
+}
+
+func (n logicNode) eval(lookup func([]string) interface{}) (interface{}, error) {
+	l, err := n.left.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(l) == n.or {
+		return n.or, nil
+	}
+	r, err := n.right.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(r), nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n compareNode) eval(lookup func([]string) interface{}) (interface{}, error) {
+	l, err := n.left.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(l, r), nil
+	case "!=":
+		return !reflect.DeepEqual(l, r), nil
+	case "in":
+		list, ok := r.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("in expects a list, got %T", r)
+		}
+		return containsValue(list, l), nil
+	}
+	if l == nil || r == nil {
+		return false, nil
+	}
+
+	switch n.op {
+	case "contains":
+		if list, ok := l.([]interface{}); ok {
+			return containsValue(list, r), nil
+		}
+		ls, rs, err := strs(n.op, l, r)
+		return err == nil && strings.Contains(ls, rs), err
+	case "startsWith":
+		ls, rs, err := strs(n.op, l, r)
+		return err == nil && strings.HasPrefix(ls, rs), err
+	case "endsWith":
+		ls, rs, err := strs(n.op, l, r)
+		return err == nil && strings.HasSuffix(ls, rs), err
+	}
+
+	var cmp int
+	switch lv := l.(type) {
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare number with %T", r)
+		}
+		cmp = compareFloats(lv, rv)
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare string with %T", r)
+		}
+		cmp = strings.Compare(lv, rv)
+	default:
+		return nil, fmt.Errorf("cannot order %T", l)
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func strs(op string, l, r interface{}) (string, string, error) {
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if !lok || !rok {
+		return "", "", fmt.Errorf("%s expects strings, got %T and %T", op, l, r)
+	}
+	return ls, rs, nil
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	return true
+}
+
+// normalize converts a resolved value to its JSON form, so Go ints compare equal
+// to the float64 numbers of the language and of attributes read back from storage.
+func normalize(v interface{}) interface{} {
+	switch v.(type) {
+	case nil, bool, string, float64:
+		return v
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
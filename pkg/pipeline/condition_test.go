@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConditionEval(t *testing.T) {
+	attrs := map[string]interface{}{
+		"mime":         "image/png",
+		"size":         int64(10 << 20),
+		"lang":         "de",
+		"tags":         []string{"scan", "invoice"},
+		"exif":         map[string]interface{}{"camera": "X100"},
+		"draft":        false,
+		"title":        `say "hi"`,
+		"quote":        "it's",
+		"content-type": "text/plain",
+	}
+	lookup := func(path []string) interface{} { return walk(attrs, path) }
+
+	cases := map[string]bool{
+		`mime startsWith "image/"`:                    true,
+		`mime endsWith 'pdf'`:                         false,
+		`size < 50MB && size >= 1MB`:                  true,
+		`size > 1.5GB`:                                false,
+		`lang in ["en", "de"]`:                        true,
+		`tags contains "invoice"`:                     true,
+		`exif.camera == "X100"`:                       true,
+		`!draft and not missing`:                      true,
+		`missing < 10 || missing startsWith "x"`:      false,
+		`missing == null`:                             true,
+		`(mime == "application/pdf" or lang == "de")`: true,
+		`draft`: false,
+		`exif`:  true,
+		// Escaped quotes inside string literals.
+		`title == "say \"hi\""`: true,
+		`quote == 'it\'s'`:      true,
+		// not binds looser than comparisons, and tighter than and, which binds tighter than or.
+		`not lang == "en"`:                       true,
+		`lang == "de" or lang == "en" and draft`: true,
+		`not draft and lang == "en" or exif`:     true,
+		`!draft && lang == "en" || missing`:      false,
+		// Identifiers may contain dashes.
+		`content-type == "text/plain"`: true,
+		// Ordering a number against a missing path is false either way round.
+		`missing >= 0`:      false,
+		`0 < missing`:       false,
+		`not (missing > 1)`: true,
+	}
+	for src, want := range cases {
+		c, err := ParseCondition(src)
+		if err != nil {
+			t.Errorf("ParseCondition(%q) error: %v", src, err)
+			continue
+		}
+		got, err := c.Eval(lookup)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %v, got %v (%v)", src, want, got, err)
+		}
+	}
+
+	for src, want := range map[string]string{
+		`mime < 5`:     "cannot compare string",
+		`lang in "de"`: "in expects a list",
+		`lang in exif`: "in expects a list",
+	} {
+		c, err := ParseCondition(src)
+		if err != nil {
+			t.Errorf("ParseCondition(%q) error: %v", src, err)
+			continue
+		}
+		if _, err := c.Eval(lookup); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	cases := map[string]string{
+		`mime ==`:             "unexpected",
+		`size < 5PB`:          `unknown unit "PB"`,
+		`"open`:               "unterminated string",
+		`(a == 1`:             "expected )",
+		`a == 1 b`:            `unexpected "b"`,
+		`lang in ["en" "de"]`: "expected , or ]",
+	}
+	for src, want := range cases {
+		_, err := ParseCondition(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
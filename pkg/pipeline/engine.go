@@ -0,0 +1,1021 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/adapters/metadata"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/uow"
+)
+
+// StepStatus is the progress of one step for one file.
+type StepStatus string
+
+const (
+	// StepPending steps wait for their dependencies.
+	StepPending StepStatus = "pending"
+	// StepRunning steps have had their job published.
+	StepRunning StepStatus = "running"
+	// StepSucceeded steps have reported a result.
+	StepSucceeded StepStatus = "succeeded"
+	// StepFailed steps reported a failure.
+	StepFailed StepStatus = "failed"
+	// StepSkipped steps had a false condition. They count as done for their dependents.
+	StepSkipped StepStatus = "skipped"
+)
+
+// RunStatus is the overall progress of a pipeline for one file.
+type RunStatus string
+
+const (
+	// RunRunning pipelines still have steps to run.
+	RunRunning RunStatus = "running"
+	// RunSucceeded pipelines completed or skipped every step.
+	RunSucceeded RunStatus = "succeeded"
+	// RunFailed pipelines stopped after a step failed.
+	RunFailed RunStatus = "failed"
+)
+
+// CompensationStatus is the outcome of undoing a job after its run failed.
+type CompensationStatus string
+
+const (
+	// CompensationRunning compensations have been started.
+	CompensationRunning CompensationStatus = "running"
+	// CompensationSucceeded compensations reverted the job's effects.
+	CompensationSucceeded CompensationStatus = "compensated"
+	// CompensationFailed compensations returned an error.
+	CompensationFailed CompensationStatus = "failed"
+)
+
+// Compensation records the compensation of a succeeded job.
+type Compensation struct {
+	Status CompensationStatus `json:"status"`
+	Error  string             `json:"error,omitempty"`
+}
+
+// StepState tracks one step of a Run.
+type StepState struct {
+	Status StepStatus `json:"status"`
+	JobID  string     `json:"job_id,omitempty"`
+	Error  string     `json:"error,omitempty"`
+	// Job is the step's own job as last dispatched, so compensation sees what the
+	// UoW processed rather than a job rebuilt from later attributes.
+	Job *contracts.Job `json:"job,omitempty"`
+	// Result is the result of the step's own job.
+	Result *contracts.Result `json:"result,omitempty"`
+	// Compensation is set once the step's own job is compensated.
+	Compensation *Compensation `json:"compensation,omitempty"`
+	// Attributes is the attribute patch the step's results reported.
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	// Children are the jobs the step's result fanned out to, in order.
+	Children []ChildState `json:"children,omitempty"`
+	// Reduce is the job aggregating the children's results once they all succeeded.
+	Reduce *ChildState `json:"reduce,omitempty"`
+}
+
+// ChildState tracks a child or reducer job of a fanned-out step.
+type ChildState struct {
+	Job    contracts.Job     `json:"job"`
+	Status StepStatus        `json:"status"`
+	Result *contracts.Result `json:"result,omitempty"`
+	// Compensation is set once the job is compensated.
+	Compensation *Compensation `json:"compensation,omitempty"`
+}
+
+// Run is the progress of a pipeline for one file. File.Attributes accumulates the
+// attribute patches of completed steps and is passed to the jobs of later steps.
+type Run struct {
+	Pipeline    string               `json:"pipeline"`
+	File        contracts.File       `json:"file"`
+	Status      RunStatus            `json:"status"`
+	Steps       map[string]StepState `json:"steps"`
+	StartedAt   time.Time            `json:"started_at"`
+	CompletedAt time.Time            `json:"completed_at"`
+	// Revision counts the changes made to the run; checkpoints keep the highest.
+	Revision int64 `json:"revision"`
+}
+
+// Done reports whether the run has finished, successfully or not.
+func (r Run) Done() bool {
+	return r.Status != RunRunning
+}
+
+func (r Run) clone() Run {
+	steps := make(map[string]StepState, len(r.Steps))
+	for k, v := range r.Steps {
+		v.Compensation = cloneCompensation(v.Compensation)
+		v.Children = append([]ChildState(nil), v.Children...)
+		for i := range v.Children {
+			v.Children[i].Compensation = cloneCompensation(v.Children[i].Compensation)
+		}
+		if v.Reduce != nil {
+			reduce := *v.Reduce
+			reduce.Compensation = cloneCompensation(reduce.Compensation)
+			v.Reduce = &reduce
+		}
+		steps[k] = v
+	}
+	r.Steps = steps
+	return r
+}
+
+func cloneCompensation(c *Compensation) *Compensation {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	return &clone
+}
+
+// ErrRunning is returned when starting a pipeline for a file whose run has not finished.
+var ErrRunning = errors.New("pipeline already running for file")
+
+// Engine drives a pipeline: it publishes the jobs of steps whose dependencies
+// are done and tracks the run of every file. Workers report back through
+// HandleResult and HandleFailure after persisting the result themselves, e.g.
+// with metadata.ApplyResult. Sync steps run inside the engine instead.
+//
+// A result with ChildJobs fans its step out: the engine dispatches every child job
+// like the step's own job and, once all children succeeded, runs the step's
+// Reduce UoW with their results in Job.ChildResults. The step succeeds with the
+// reducer's result, or with the children's merged attribute patches when it has
+// no reducer.
+//
+// When a run fails permanently, the engine undoes it saga-style: every succeeded
+// job whose UoW in WithRegistry implements uow.Compensator is compensated, in
+// reverse order so that dependents are undone before the steps they depend on.
+// Each outcome is recorded on the job's StepState or ChildState. Results that
+// arrive for a failed run are compensated as they come in.
+//
+// Step conditions resolve paths against the run: "file.id", "file.name",
+// "file.tenant_id", "file.owner_id" and "file.size" read the file itself;
+// "steps.<step>.status" and "steps.<step>.attributes.<key>" read an upstream step;
+// "attributes.<key>", or any other path, reads the accumulated file attributes,
+// descending into nested objects.
+//
+// With WithStore, the engine checkpoints every run before dispatching its jobs and
+// records every result under its job's IdemKey. Resume picks
+// up the unfinished runs after a restart. A job whose result is already recorded
+// is not dispatched again: its recorded result is applied instead, so restarting
+// a finished pipeline for a file only runs the steps that have no result yet. The
+// IdemKey is the job ID, suffixed with "@<version>" when the registered UoW is
+// uow.Versioned, so a new version of a UoW processes files again.
+type Engine struct {
+	pipeline *Pipeline
+	bus      adapters.Bus
+	topics   map[string]adapters.Bus
+	template contracts.Job
+	registry *uow.Registry
+	meta     adapters.Metadata
+	store    Store
+
+	mu   sync.Mutex
+	runs map[string]*Run
+}
+
+// topicPublisher is implemented by buses that route to a named topic, such as bus.MemoryBus.
+type topicPublisher interface {
+	PublishTo(ctx context.Context, topic string, job contracts.Job) error
+}
+
+// EngineOption customises an Engine.
+type EngineOption func(*Engine)
+
+// WithJobTemplate sets the fields, such as Version and Return, copied into every
+// published job. JobID, UoW, File and IdemKey are always set by the engine.
+func WithJobTemplate(job contracts.Job) EngineOption {
+	return func(e *Engine) { e.template = job }
+}
+
+// WithTopicBus publishes the jobs of steps with the given Topic to bus. Steps whose
+// topic has no bus of its own go to the default bus, which must then support
+// PublishTo like bus.MemoryBus.
+func WithTopicBus(topic string, bus adapters.Bus) EngineOption {
+	return func(e *Engine) { e.topics[topic] = bus }
+}
+
+// WithRegistry provides the UoWs that sync steps run with.
+func WithRegistry(registry *uow.Registry) EngineOption {
+	return func(e *Engine) { e.registry = registry }
+}
+
+// WithMetadata persists the results of sync steps with metadata.ApplyResult before
+// the engine moves on. Async results are persisted by the workers that produce them.
+func WithMetadata(m adapters.Metadata) EngineOption {
+	return func(e *Engine) { e.meta = m }
+}
+
+// WithStore checkpoints runs and results to store, so Resume can continue them
+// after a restart.
+func WithStore(store Store) EngineOption {
+	return func(e *Engine) { e.store = store }
+}
+
+// NewEngine creates an Engine publishing the pipeline's jobs to bus.
+func NewEngine(p *Pipeline, bus adapters.Bus, opts ...EngineOption) (*Engine, error) {
+	if p == nil {
+		return nil, errors.New("pipeline is required")
+	}
+	if bus == nil {
+		return nil, errors.New("bus is required")
+	}
+	e := &Engine{pipeline: p, bus: bus, topics: make(map[string]adapters.Bus), runs: make(map[string]*Run)}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	for _, s := range p.steps {
+		if s.Runner == RunSync {
+			if e.registry == nil {
+				return nil, fmt.Errorf("step %q runs sync, which requires WithRegistry", s.Name)
+			}
+			for _, name := range []string{s.UoW, s.Reduce} {
+				if _, ok := e.registry.Lookup(name); name != "" && !ok {
+					return nil, fmt.Errorf("step %q: unknown uow %q", s.Name, name)
+				}
+			}
+			continue
+		}
+		if s.Topic == "" {
+			continue
+		}
+		if _, ok := e.topics[s.Topic]; !ok {
+			if _, ok := bus.(topicPublisher); !ok {
+				return nil, fmt.Errorf("step %q: no bus for topic %q", s.Name, s.Topic)
+			}
+		}
+	}
+	return e, nil
+}
+
+// Start begins a run for file and publishes the jobs of steps without
+// dependencies. A finished run for the same file is replaced.
+func (e *Engine) Start(ctx context.Context, file contracts.File) (Run, error) {
+	if file.ID == "" {
+		return Run{}, errors.New("file id is required")
+	}
+
+	e.mu.Lock()
+	_, known := e.runs[file.ID]
+	e.mu.Unlock()
+	var revision int64
+	if !known && e.store != nil {
+		stored, err := e.store.LoadRun(ctx, e.pipeline.name, file.ID)
+		if err != nil && !errors.Is(err, adapters.ErrNotFound) {
+			return Run{}, fmt.Errorf("load run for file %s: %w", file.ID, err)
+		}
+		if err == nil && !stored.Done() {
+			// Runs checkpointed by an earlier engine are continued by Resume.
+			return Run{}, ErrRunning
+		}
+		revision = stored.Revision
+	}
+
+	e.mu.Lock()
+	if r, ok := e.runs[file.ID]; ok {
+		if !r.Done() {
+			e.mu.Unlock()
+			return Run{}, ErrRunning
+		}
+		revision = r.Revision
+	}
+	run := &Run{
+		Pipeline:  e.pipeline.name,
+		File:      file,
+		Status:    RunRunning,
+		Steps:     make(map[string]StepState, len(e.pipeline.steps)),
+		StartedAt: time.Now().UTC(),
+		// The new run must outrank the checkpoint of the one it replaces.
+		Revision: revision,
+	}
+	for _, s := range e.pipeline.steps {
+		run.Steps[s.Name] = StepState{Status: StepPending, JobID: e.jobID(file.ID, s.Name)}
+	}
+	e.runs[file.ID] = run
+	e.mu.Unlock()
+
+	return e.advance(ctx, file.ID)
+}
+
+// Resume continues the store's unfinished runs of the pipeline after a restart.
+// Completed steps are kept. Jobs that were dispatched are dispatched again, unless
+// their result was recorded, which is then applied instead. Runs the engine
+// already tracks are left alone. Call Resume before results reach the engine, as
+// results for runs it does not track are rejected.
+func (e *Engine) Resume(ctx context.Context) ([]Run, error) {
+	if e.store == nil {
+		return nil, errors.New("resume requires WithStore")
+	}
+	stored, err := e.store.IncompleteRuns(ctx, e.pipeline.name)
+	if err != nil {
+		return nil, fmt.Errorf("load incomplete runs: %w", err)
+	}
+
+	var (
+		runs []Run
+		errs []error
+	)
+	for _, r := range stored {
+		run := r.clone()
+		e.mu.Lock()
+		if _, ok := e.runs[run.File.ID]; ok {
+			e.mu.Unlock()
+			continue
+		}
+		for _, s := range e.pipeline.steps {
+			state, ok := run.Steps[s.Name]
+			if !ok {
+				// The step was added to the pipeline after the checkpoint.
+				run.Steps[s.Name] = StepState{Status: StepPending, JobID: e.jobID(run.File.ID, s.Name)}
+				continue
+			}
+			e.revertLocked(&run, jobRef{step: s.Name, child: mainJob})
+			if state.Reduce != nil {
+				e.revertLocked(&run, jobRef{step: s.Name, child: reduceJob})
+			}
+			for i := range state.Children {
+				e.revertLocked(&run, jobRef{step: s.Name, child: i})
+			}
+		}
+		e.runs[run.File.ID] = &run
+		e.mu.Unlock()
+
+		resumed, err := e.advance(ctx, run.File.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resume run for file %s: %w", run.File.ID, err))
+		}
+		runs = append(runs, resumed)
+	}
+	return runs, errors.Join(errs...)
+}
+
+// HandleResult records the result of a step's job, merges its attribute patch into
+// the run and dispatches the jobs that became ready: the children the result fans
+// out to, a reducer, or downstream steps. Results for unknown jobs are rejected
+// with adapters.ErrNotFound; repeated results are ignored, but still dispatch
+// ready jobs whose earlier publish failed.
+func (e *Engine) HandleResult(ctx context.Context, result contracts.Result) (Run, error) {
+	e.mu.Lock()
+	run, ref, err := e.lookupLocked(result.FileID, result.JobID)
+	var idemKey string
+	if err == nil {
+		idemKey = e.idemKeyLocked(run, ref)
+	}
+	e.mu.Unlock()
+	if err != nil {
+		return Run{}, err
+	}
+	if e.store != nil {
+		if err := e.store.SaveResult(ctx, idemKey, result); err != nil {
+			return Run{}, fmt.Errorf("record result of job %s: %w", result.JobID, err)
+		}
+	}
+
+	e.mu.Lock()
+	run, ref, err = e.lookupLocked(result.FileID, result.JobID)
+	if err != nil {
+		e.mu.Unlock()
+		return Run{}, err
+	}
+	state := run.Steps[ref.step]
+	if state.Status == StepRunning || state.Status == StepPending {
+		s, _ := e.pipeline.Step(ref.step)
+		switch ref.child {
+		case mainJob:
+			if state.Children != nil {
+				break
+			}
+			state.Result = &result
+			e.mergeLocked(run, &state, result.AttributesPatch)
+			if len(result.ChildJobs) == 0 {
+				state.Status = StepSucceeded
+				break
+			}
+			state.Children = make([]ChildState, len(result.ChildJobs))
+			for i, child := range result.ChildJobs {
+				state.Children[i] = ChildState{Job: e.childJob(run, s, i, child), Status: StepPending}
+			}
+		case reduceJob:
+			if state.Reduce.Status == StepSucceeded {
+				break
+			}
+			state.Reduce.Status, state.Reduce.Result = StepSucceeded, &result
+			e.mergeLocked(run, &state, result.AttributesPatch)
+			state.Status = StepSucceeded
+		default:
+			child := &state.Children[ref.child]
+			if child.Status == StepSucceeded {
+				break
+			}
+			child.Status, child.Result = StepSucceeded, &result
+			e.fanInLocked(run, s, &state)
+		}
+		run.Steps[ref.step] = state
+		e.finishLocked(run)
+	}
+	// Repeated results checkpoint too, in case the first one failed to.
+	snapshot := e.touchLocked(run)
+	e.mu.Unlock()
+
+	if err := e.checkpoint(ctx, snapshot); err != nil {
+		return snapshot, err
+	}
+	return e.advance(ctx, result.FileID)
+}
+
+// fanInLocked completes a fanned-out step once every child succeeded, either by
+// preparing its reducer job or by merging the children's patches.
+func (e *Engine) fanInLocked(run *Run, s Step, state *StepState) {
+	results := make([]contracts.Result, len(state.Children))
+	for i, child := range state.Children {
+		if child.Status != StepSucceeded {
+			return
+		}
+		results[i] = *child.Result
+	}
+
+	if s.Reduce == "" {
+		for _, r := range results {
+			e.mergeLocked(run, state, r.AttributesPatch)
+		}
+		state.Status = StepSucceeded
+		return
+	}
+	job := e.job(run, s)
+	job.JobID = state.JobID + "#reduce"
+	job.UoW = s.Reduce
+	job.IdemKey = e.idemKey(job.JobID, job.UoW)
+	job.ChildResults = results
+	state.Reduce = &ChildState{Job: job, Status: StepPending}
+}
+
+func (e *Engine) mergeLocked(run *Run, state *StepState, patch map[string]interface{}) {
+	if len(patch) == 0 {
+		return
+	}
+	state.Attributes = metadata.MergePatch(state.Attributes, patch)
+	run.File.Attributes = metadata.MergePatch(run.File.Attributes, patch)
+}
+
+// HandleFailure records that a step's job, or one of its child or reducer jobs,
+// failed permanently. The run fails and no further jobs are dispatched; jobs
+// already published are left to finish.
+func (e *Engine) HandleFailure(ctx context.Context, fileID, jobID string, cause error) (Run, error) {
+	e.mu.Lock()
+	run, ref, err := e.lookupLocked(fileID, jobID)
+	if err != nil {
+		e.mu.Unlock()
+		return Run{}, err
+	}
+	state := run.Steps[ref.step]
+	if state.Status != StepSucceeded {
+		state.Status = StepFailed
+		if cause != nil {
+			state.Error = cause.Error()
+		}
+		switch ref.child {
+		case mainJob:
+		case reduceJob:
+			state.Reduce.Status = StepFailed
+		default:
+			state.Children[ref.child].Status = StepFailed
+		}
+		run.Steps[ref.step] = state
+		e.finishLocked(run)
+	}
+	snapshot := e.touchLocked(run)
+	e.mu.Unlock()
+
+	if err := e.checkpoint(ctx, snapshot); err != nil {
+		return snapshot, err
+	}
+	return e.compensate(ctx, run)
+}
+
+// compensation is a succeeded job to undo.
+type compensation struct {
+	job    contracts.Job
+	result contracts.Result
+	undo   uow.Compensator
+	state  *Compensation
+}
+
+// compensate undoes the succeeded jobs of a failed run that have not been
+// compensated yet, walking the steps backwards: a step's reducer first, then its
+// children in reverse, then its own job. Compensation errors are recorded, not
+// returned, as repeating the failure would not compensate the job again.
+func (e *Engine) compensate(ctx context.Context, run *Run) (Run, error) {
+	e.mu.Lock()
+	if run.Status != RunFailed || e.registry == nil {
+		defer e.mu.Unlock()
+		return run.clone(), nil
+	}
+	var pending []compensation
+	add := func(job *contracts.Job, result *contracts.Result, state **Compensation) {
+		if job == nil || result == nil || *state != nil {
+			return
+		}
+		u, _ := e.registry.Lookup(job.UoW)
+		undo, ok := u.(uow.Compensator)
+		if !ok {
+			return
+		}
+		*state = &Compensation{Status: CompensationRunning}
+		pending = append(pending, compensation{job: *job, result: *result, undo: undo, state: *state})
+	}
+	for i := len(e.pipeline.steps) - 1; i >= 0; i-- {
+		s := e.pipeline.steps[i]
+		state := run.Steps[s.Name]
+		if state.Reduce != nil {
+			add(&state.Reduce.Job, state.Reduce.Result, &state.Reduce.Compensation)
+		}
+		for j := len(state.Children) - 1; j >= 0; j-- {
+			add(&state.Children[j].Job, state.Children[j].Result, &state.Children[j].Compensation)
+		}
+		add(state.Job, state.Result, &state.Compensation)
+		run.Steps[s.Name] = state
+	}
+	if len(pending) == 0 {
+		defer e.mu.Unlock()
+		return run.clone(), nil
+	}
+	snapshot := e.touchLocked(run)
+	e.mu.Unlock()
+
+	if err := e.checkpoint(ctx, snapshot); err != nil {
+		return snapshot, err
+	}
+	for _, c := range pending {
+		err := c.undo.Compensate(ctx, c.job, c.result)
+		e.mu.Lock()
+		if err != nil {
+			*c.state = Compensation{Status: CompensationFailed, Error: err.Error()}
+		} else {
+			*c.state = Compensation{Status: CompensationSucceeded}
+		}
+		e.mu.Unlock()
+	}
+
+	e.mu.Lock()
+	snapshot = e.touchLocked(run)
+	e.mu.Unlock()
+	return snapshot, e.checkpoint(ctx, snapshot)
+}
+
+// touchLocked records a change to run and returns a snapshot to checkpoint.
+func (e *Engine) touchLocked(run *Run) Run {
+	run.Revision++
+	return run.clone()
+}
+
+// checkpoint saves run to the store, if the engine has one.
+func (e *Engine) checkpoint(ctx context.Context, run Run) error {
+	if e.store == nil {
+		return nil
+	}
+	if err := e.store.SaveRun(ctx, run); err != nil {
+		return fmt.Errorf("checkpoint run for file %s: %w", run.File.ID, err)
+	}
+	return nil
+}
+
+// recorded returns the result the store holds for job, if any.
+func (e *Engine) recorded(ctx context.Context, job contracts.Job) (contracts.Result, bool, error) {
+	if e.store == nil {
+		return contracts.Result{}, false, nil
+	}
+	result, err := e.store.LoadResult(ctx, job.IdemKey)
+	if errors.Is(err, adapters.ErrNotFound) {
+		return contracts.Result{}, false, nil
+	}
+	if err != nil {
+		return contracts.Result{}, false, fmt.Errorf("load result of job %s: %w", job.JobID, err)
+	}
+	return result, true, nil
+}
+
+// Status returns the run for fileID, or adapters.ErrNotFound.
+func (e *Engine) Status(fileID string) (Run, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	run, ok := e.runs[fileID]
+	if !ok {
+		return Run{}, adapters.ErrNotFound
+	}
+	return run.clone(), nil
+}
+
+// dispatch is a job advance hands to the bus or runs in-process.
+type dispatch struct {
+	step Step
+	job  contracts.Job
+	ref  jobRef
+}
+
+// advance dispatches every pending step whose dependencies are done, skipping
+// those whose condition is false, and the pending child and reducer jobs of
+// running steps. Steps are visited in dependency order, so a skip is seen by its
+// dependents in the same pass. Jobs are dispatched without holding the lock, so
+// a bus that delivers synchronously may report results back in the meantime.
+// The run is checkpointed before anything is dispatched, and jobs with a recorded
+// result have it applied instead of being dispatched.
+func (e *Engine) advance(ctx context.Context, fileID string) (Run, error) {
+	e.mu.Lock()
+	run := e.runs[fileID]
+	var (
+		ready   []dispatch
+		changed bool
+	)
+	for _, s := range e.pipeline.steps {
+		if run.Done() {
+			break
+		}
+		state := run.Steps[s.Name]
+		switch {
+		case state.Status == StepPending && e.readyLocked(run, s):
+			changed = true
+			state.Status = StepRunning
+			if c, ok := e.pipeline.conditions[s.Name]; ok {
+				match, err := c.Eval(e.lookup(run))
+				switch {
+				case err != nil:
+					state.Status, state.Error = StepFailed, err.Error()
+				case !match:
+					state.Status = StepSkipped
+				}
+			}
+			if state.Status == StepRunning {
+				job := e.job(run, s)
+				state.Job = &job
+				run.Steps[s.Name] = state
+				ready = append(ready, dispatch{step: s, job: job, ref: jobRef{step: s.Name, child: mainJob}})
+			} else {
+				run.Steps[s.Name] = state
+				e.finishLocked(run)
+			}
+		case state.Status == StepRunning:
+			for i := range state.Children {
+				if state.Children[i].Status == StepPending {
+					changed = true
+					state.Children[i].Status = StepRunning
+					ready = append(ready, dispatch{step: s, job: state.Children[i].Job, ref: jobRef{step: s.Name, child: i}})
+				}
+			}
+			if state.Reduce != nil && state.Reduce.Status == StepPending {
+				changed = true
+				state.Reduce.Status = StepRunning
+				ready = append(ready, dispatch{step: s, job: state.Reduce.Job, ref: jobRef{step: s.Name, child: reduceJob}})
+			}
+		}
+	}
+	var snapshot Run
+	if changed {
+		snapshot = e.touchLocked(run)
+	}
+	e.mu.Unlock()
+
+	if changed {
+		if err := e.checkpoint(ctx, snapshot); err != nil {
+			// Nothing was dispatched, so the next advance retries every job.
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			for _, d := range ready {
+				e.revertLocked(run, d.ref)
+			}
+			return run.clone(), err
+		}
+	}
+
+	var errs []error
+	for _, d := range ready {
+		result, ok, err := e.recorded(ctx, d.job)
+		if err != nil {
+			errs = append(errs, err)
+			e.mu.Lock()
+			e.revertLocked(run, d.ref)
+			e.mu.Unlock()
+			continue
+		}
+		if ok {
+			if _, err := e.HandleResult(ctx, result); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if d.step.Runner == RunSync {
+			if err := e.runSync(ctx, d.step, d.job); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := e.publish(ctx, d.step, d.job); err != nil {
+			errs = append(errs, fmt.Errorf("publish job %s: %w", d.job.JobID, err))
+			e.mu.Lock()
+			e.revertLocked(run, d.ref)
+			e.mu.Unlock()
+		}
+	}
+
+	e.mu.Lock()
+	failed := run.Status == RunFailed
+	snapshot = run.clone()
+	e.mu.Unlock()
+	if failed {
+		compensated, err := e.compensate(ctx, run)
+		return compensated, errors.Join(append(errs, err)...)
+	}
+	return snapshot, errors.Join(errs...)
+}
+
+// revertLocked returns a dispatched job to pending, so the next advance dispatches it again.
+func (e *Engine) revertLocked(run *Run, ref jobRef) {
+	state := run.Steps[ref.step]
+	switch ref.child {
+	case mainJob:
+		if state.Status == StepRunning && state.Children == nil {
+			state.Status = StepPending
+		}
+	case reduceJob:
+		if state.Reduce.Status == StepRunning {
+			state.Reduce.Status = StepPending
+		}
+	default:
+		if state.Children[ref.child].Status == StepRunning {
+			state.Children[ref.child].Status = StepPending
+		}
+	}
+	run.Steps[ref.step] = state
+}
+
+func (e *Engine) publish(ctx context.Context, s Step, job contracts.Job) error {
+	if s.Topic == "" {
+		return e.bus.Publish(ctx, job)
+	}
+	if bus, ok := e.topics[s.Topic]; ok {
+		return bus.Publish(ctx, job)
+	}
+	return e.bus.(topicPublisher).PublishTo(ctx, s.Topic, job)
+}
+
+// runSync processes a sync step in-process, retrying it as its policy allows, and
+// reports the outcome as a worker would.
+func (e *Engine) runSync(ctx context.Context, s Step, job contracts.Job) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		var result contracts.Result
+		if result, err = e.process(ctx, s, job); err == nil {
+			_, err = e.HandleResult(ctx, result)
+			return err
+		}
+		if attempt >= s.Retry.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+		timer := time.NewTimer(s.Retry.Backoff)
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	_, failErr := e.HandleFailure(ctx, job.File.ID, job.JobID, err)
+	return failErr
+}
+
+func (e *Engine) process(ctx context.Context, s Step, job contracts.Job) (contracts.Result, error) {
+	// Child jobs may name UoWs other than the step's, so they are only resolved here.
+	u, ok := e.registry.Lookup(job.UoW)
+	if !ok {
+		return contracts.Result{}, fmt.Errorf("unknown uow %q", job.UoW)
+	}
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	result, err := u.Process(ctx, job)
+	if err != nil {
+		return contracts.Result{}, err
+	}
+	if result == nil {
+		return contracts.Result{}, errors.New("uow returned no result")
+	}
+	r := *result
+	r.JobID, r.FileID = job.JobID, job.File.ID
+	if r.UoW == "" {
+		r.UoW = job.UoW
+	}
+	if r.UoWVersion == "" {
+		r.UoWVersion = uow.VersionOf(u)
+	}
+	if e.meta != nil {
+		if _, err := metadata.ApplyResult(ctx, e.meta, r, metadata.ApplyOptions{}); err != nil {
+			return contracts.Result{}, fmt.Errorf("apply result: %w", err)
+		}
+	}
+	return r, nil
+}
+
+func (e *Engine) readyLocked(run *Run, s Step) bool {
+	for _, dep := range s.DependsOn {
+		if status := run.Steps[dep].Status; status != StepSucceeded && status != StepSkipped {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup resolves condition paths against run; see Engine.
+func (e *Engine) lookup(run *Run) func([]string) interface{} {
+	return func(path []string) interface{} {
+		switch path[0] {
+		case "file":
+			if len(path) != 2 {
+				return nil
+			}
+			switch path[1] {
+			case "id":
+				return run.File.ID
+			case "name":
+				return run.File.Name
+			case "tenant_id":
+				return run.File.TenantID
+			case "owner_id":
+				return run.File.OwnerID
+			case "size":
+				return run.File.Blob.Size
+			}
+			return nil
+		case "steps":
+			if len(path) < 3 {
+				return nil
+			}
+			state := run.Steps[path[1]]
+			if path[2] == "status" && len(path) == 3 {
+				return string(state.Status)
+			}
+			if path[2] == "attributes" {
+				return walk(state.Attributes, path[3:])
+			}
+			return nil
+		case "attributes":
+			return walk(run.File.Attributes, path[1:])
+		}
+		return walk(run.File.Attributes, path)
+	}
+}
+
+// walk descends into nested attribute objects along path.
+func walk(attrs map[string]interface{}, path []string) interface{} {
+	var v interface{} = attrs
+	for _, key := range path {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	return v
+}
+
+// finishLocked completes the run once a step failed or every step succeeded.
+func (e *Engine) finishLocked(run *Run) {
+	if run.Done() {
+		return
+	}
+	status := RunSucceeded
+	for _, state := range run.Steps {
+		if state.Status == StepFailed {
+			status = RunFailed
+			break
+		}
+		if state.Status != StepSucceeded && state.Status != StepSkipped {
+			status = RunRunning
+		}
+	}
+	if status != RunRunning {
+		run.Status = status
+		run.CompletedAt = time.Now().UTC()
+	}
+}
+
+const (
+	mainJob   = -1
+	reduceJob = -2
+)
+
+// jobRef locates a job within a run: a step's own job, its reducer job, or the
+// child job at index child.
+type jobRef struct {
+	step  string
+	child int
+}
+
+func (e *Engine) lookupLocked(fileID, jobID string) (*Run, jobRef, error) {
+	run, ok := e.runs[fileID]
+	if !ok {
+		return nil, jobRef{}, fmt.Errorf("run for file %s: %w", fileID, adapters.ErrNotFound)
+	}
+	for name, state := range run.Steps {
+		if state.JobID == jobID {
+			return run, jobRef{step: name, child: mainJob}, nil
+		}
+		if state.Reduce != nil && state.Reduce.Job.JobID == jobID {
+			return run, jobRef{step: name, child: reduceJob}, nil
+		}
+		for i, child := range state.Children {
+			if child.Job.JobID == jobID {
+				return run, jobRef{step: name, child: i}, nil
+			}
+		}
+	}
+	return nil, jobRef{}, fmt.Errorf("job %s in run for file %s: %w", jobID, fileID, adapters.ErrNotFound)
+}
+
+func (e *Engine) job(run *Run, s Step) contracts.Job {
+	job := e.template
+	job.JobID = run.Steps[s.Name].JobID
+	job.UoW = s.UoW
+	job.IdemKey = e.idemKey(job.JobID, job.UoW)
+	job.File = run.File
+
+	hints := make(map[string]string, len(e.template.Hints)+len(s.Hints))
+	for k, v := range e.template.Hints {
+		hints[k] = v
+	}
+	for k, v := range s.Hints {
+		hints[k] = v
+	}
+	if len(hints) > 0 {
+		job.Hints = hints
+	}
+	return job
+}
+
+// childJob builds the i-th child job of s from the one its splitter returned. The
+// child keeps the run's file so its result finds the run, but may override the
+// blob, e.g. to point at a pre-cut chunk. UoW defaults to the step's.
+func (e *Engine) childJob(run *Run, s Step, i int, child contracts.Job) contracts.Job {
+	job := e.job(run, s)
+	job.JobID = fmt.Sprintf("%s#%d", run.Steps[s.Name].JobID, i+1)
+	if child.UoW != "" {
+		job.UoW = child.UoW
+	}
+	job.IdemKey = e.idemKey(job.JobID, job.UoW)
+	if child.File.Blob.Location != "" {
+		job.File.Blob = child.File.Blob
+	}
+	if child.PresignedGet != "" {
+		job.PresignedGet = child.PresignedGet
+	}
+	if len(child.Hints) > 0 {
+		hints := make(map[string]string, len(job.Hints)+len(child.Hints))
+		for k, v := range job.Hints {
+			hints[k] = v
+		}
+		for k, v := range child.Hints {
+			hints[k] = v
+		}
+		job.Hints = hints
+	}
+	return job
+}
+
+// idemKey derives a job's IdemKey from its ID and the version its UoW declares.
+func (e *Engine) idemKey(jobID, name string) string {
+	if e.registry == nil {
+		return jobID
+	}
+	if u, ok := e.registry.Lookup(name); ok {
+		if version := uow.VersionOf(u); version != "" {
+			return jobID + "@" + version
+		}
+	}
+	return jobID
+}
+
+// idemKeyLocked returns the IdemKey of the job ref points at.
+func (e *Engine) idemKeyLocked(run *Run, ref jobRef) string {
+	state := run.Steps[ref.step]
+	switch ref.child {
+	case mainJob:
+		s, _ := e.pipeline.Step(ref.step)
+		return e.idemKey(state.JobID, s.UoW)
+	case reduceJob:
+		return state.Reduce.Job.IdemKey
+	default:
+		return state.Children[ref.child].Job.IdemKey
+	}
+}
+
+// jobID derives a stable job ID, so a step's job is recognisable across redeliveries.
+func (e *Engine) jobID(fileID, step string) string {
+	return fmt.Sprintf("%s:%s:%s", e.pipeline.name, fileID, step)
+}
@@ -0,0 +1,221 @@
+// Package pipeline chains units of work into a DAG. A Pipeline declares which UoW
+// runs after which, and an Engine publishes each step's job once the steps it
+// depends on have produced their results.
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Runner kinds for Step.Runner.
+const (
+	// RunAsync publishes the step's job to the bus for external workers.
+	RunAsync = "async"
+	// RunSync processes the step's job inside the engine with a registered UoW.
+	RunSync = "sync"
+)
+
+// Step is a node of a pipeline.
+type Step struct {
+	// Name identifies the step within its pipeline; defaults to UoW.
+	Name string `yaml:"name"`
+	// UoW is the unit of work the step's job is addressed to.
+	UoW string `yaml:"uow"`
+	// DependsOn lists the steps that must succeed, or be skipped, before this one runs.
+	DependsOn []string `yaml:"depends_on"`
+	// Hints are copied into the step's jobs.
+	Hints map[string]string `yaml:"hints"`
+	// Condition, when set, is evaluated once the dependencies are done; the step is
+	// skipped if it is false. See Condition for the language and Engine for the paths.
+	Condition string `yaml:"condition"`
+	// Runner is RunAsync (the default) or RunSync.
+	Runner string `yaml:"runner"`
+	// Topic selects the bus the job is published to; see WithTopicBus.
+	Topic string `yaml:"topic"`
+	// Retry bounds how often a failing job is attempted. Sync steps only: async
+	// jobs are retried by the bus and its workers.
+	Retry RetryPolicy `yaml:"retry"`
+	// Timeout bounds a single attempt. Sync steps only, like Retry.
+	Timeout time.Duration `yaml:"timeout"`
+	// Reduce names the UoW that aggregates the results of the child jobs the step's
+	// result fans out to. It runs with the same runner, topic, retry and timeout.
+	Reduce string `yaml:"reduce"`
+}
+
+// RetryPolicy describes how a failing sync step is retried by the engine.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt; zero means a single attempt.
+	MaxAttempts int `yaml:"max_attempts"`
+	// Backoff is the pause between attempts.
+	Backoff time.Duration `yaml:"backoff"`
+}
+
+// Pipeline is a validated DAG of steps.
+type Pipeline struct {
+	name       string
+	steps      []Step
+	index      map[string]int
+	conditions map[string]*Condition
+}
+
+// New validates the steps and returns a pipeline. It rejects duplicate step
+// names, dependencies on unknown steps, cycles and invalid conditions.
+func New(name string, steps ...Step) (*Pipeline, error) {
+	if name == "" {
+		return nil, errors.New("pipeline name is required")
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("pipeline %s: at least one step is required", name)
+	}
+
+	byName := make(map[string]Step, len(steps))
+	names := make([]string, 0, len(steps))
+	for _, s := range steps {
+		if s.UoW == "" {
+			return nil, fmt.Errorf("pipeline %s: step %q: uow is required", name, s.Name)
+		}
+		if s.Name == "" {
+			s.Name = s.UoW
+		}
+		if s.Runner == "" {
+			s.Runner = RunAsync
+		}
+		if s.Runner != RunAsync && s.Runner != RunSync {
+			return nil, fmt.Errorf("pipeline %s: step %q: runner must be %q or %q, got %q", name, s.Name, RunAsync, RunSync, s.Runner)
+		}
+		if s.Retry.MaxAttempts < 0 || s.Retry.Backoff < 0 || s.Timeout < 0 {
+			return nil, fmt.Errorf("pipeline %s: step %q: retry and timeout must not be negative", name, s.Name)
+		}
+		// The engine cannot enforce either for jobs it hands to the bus, so they are
+		// refused rather than silently ignored.
+		if s.Runner == RunAsync && (s.Retry != (RetryPolicy{}) || s.Timeout != 0) {
+			return nil, fmt.Errorf("pipeline %s: step %q: retry and timeout apply to sync steps only; configure retries on the bus or pass hints to async workers", name, s.Name)
+		}
+		if _, dup := byName[s.Name]; dup {
+			return nil, fmt.Errorf("pipeline %s: duplicate step %q", name, s.Name)
+		}
+		byName[s.Name] = s
+		names = append(names, s.Name)
+	}
+	for _, n := range names {
+		for _, dep := range byName[n].DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("pipeline %s: step %q depends on unknown step %q", name, n, dep)
+			}
+		}
+	}
+
+	order, err := sortSteps(names, byName)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline %s: %w", name, err)
+	}
+	p := &Pipeline{name: name, index: make(map[string]int, len(order)), conditions: make(map[string]*Condition)}
+	for i, n := range order {
+		p.steps = append(p.steps, byName[n])
+		p.index[n] = i
+	}
+	if err := p.compileConditions(); err != nil {
+		return nil, fmt.Errorf("pipeline %s: %w", name, err)
+	}
+	return p, nil
+}
+
+// compileConditions parses every condition and checks that the steps it reads are
+// upstream of it, so their outcome is known when it is evaluated.
+func (p *Pipeline) compileConditions() error {
+	upstream := make(map[string]map[string]bool, len(p.steps))
+	for _, s := range p.steps {
+		up := make(map[string]bool)
+		for _, dep := range s.DependsOn {
+			up[dep] = true
+			for a := range upstream[dep] {
+				up[a] = true
+			}
+		}
+		upstream[s.Name] = up
+
+		if s.Condition == "" {
+			continue
+		}
+		c, err := ParseCondition(s.Condition)
+		if err != nil {
+			return fmt.Errorf("step %q: condition: %w", s.Name, err)
+		}
+		for _, path := range c.paths {
+			if path[0] == "steps" && len(path) > 1 && !up[path[1]] {
+				return fmt.Errorf("step %q: condition reads step %q, which it does not depend on", s.Name, path[1])
+			}
+		}
+		p.conditions[s.Name] = c
+	}
+	return nil
+}
+
+// Name returns the pipeline name.
+func (p *Pipeline) Name() string {
+	return p.name
+}
+
+// Steps returns the steps in dependency order: every step follows the steps it depends on.
+func (p *Pipeline) Steps() []Step {
+	return append([]Step(nil), p.steps...)
+}
+
+// Step returns the named step.
+func (p *Pipeline) Step(name string) (Step, bool) {
+	i, ok := p.index[name]
+	if !ok {
+		return Step{}, false
+	}
+	return p.steps[i], true
+}
+
+// sortSteps orders steps topologically, keeping declaration order where the
+// dependencies allow. A cycle is reported with the steps that form it.
+func sortSteps(names []string, steps map[string]Step) ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(names))
+	order := make([]string, 0, len(names))
+	var path []string
+
+	var visit func(string) error
+	visit = func(n string) error {
+		switch state[n] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for path[start] != n {
+				start++
+			}
+			cycle := append(append([]string(nil), path[start:]...), n)
+			return fmt.Errorf("cycle between steps %s", strings.Join(cycle, " -> "))
+		}
+
+		state[n] = visiting
+		path = append(path, n)
+		for _, dep := range steps[n].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = visited
+		order = append(order, n)
+		return nil
+	}
+
+	for _, n := range names {
+		if err := visit(n); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
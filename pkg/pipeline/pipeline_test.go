@@ -0,0 +1,476 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/uow"
+)
+
+type recordingBus struct {
+	failOn string
+	jobs   []contracts.Job
+}
+
+func (b *recordingBus) Publish(ctx context.Context, job contracts.Job) error {
+	if job.UoW == b.failOn {
+		b.failOn = ""
+		return errors.New("broker unavailable")
+	}
+	b.jobs = append(b.jobs, job)
+	return nil
+}
+
+// take returns and forgets the jobs published so far.
+func (b *recordingBus) take() map[string]contracts.Job {
+	jobs := make(map[string]contracts.Job, len(b.jobs))
+	for _, job := range b.jobs {
+		jobs[job.UoW] = job
+	}
+	b.jobs = nil
+	return jobs
+}
+
+func TestNewRejectsInvalidPipelines(t *testing.T) {
+	cases := map[string]struct {
+		steps []Step
+		want  string
+	}{
+		"duplicate": {[]Step{{UoW: "hash"}, {UoW: "hash"}}, `duplicate step "hash"`},
+		"unknown":   {[]Step{{UoW: "ocr", DependsOn: []string{"mime"}}}, `depends on unknown step "mime"`},
+		"cycle": {[]Step{
+			{UoW: "hash"},
+			{UoW: "a", DependsOn: []string{"hash", "c"}},
+			{UoW: "b", DependsOn: []string{"a"}},
+			{UoW: "c", DependsOn: []string{"b"}},
+		}, "cycle between steps a -> c -> b -> a"},
+	}
+	for name, tc := range cases {
+		_, err := New("files", tc.steps...)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected error containing %q, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestEngineRunsDAG(t *testing.T) {
+	ctx := context.Background()
+	p, err := New("files",
+		Step{Name: "thumb", UoW: "thumbnail", DependsOn: []string{"mime"}, Hints: map[string]string{"size": "256"}},
+		Step{UoW: "ocr", DependsOn: []string{"mime"}},
+		Step{UoW: "mime", DependsOn: []string{"hash"}},
+		Step{UoW: "hash"},
+	)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	if steps := p.Steps(); steps[0].Name != "hash" || steps[1].Name != "mime" {
+		t.Fatalf("expected dependencies first, got %+v", steps)
+	}
+
+	bus := &recordingBus{failOn: "ocr"}
+	engine, err := NewEngine(p, bus, WithJobTemplate(contracts.Job{Version: "1.0"}))
+	if err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+
+	file := contracts.File{ID: "f1", Attributes: map[string]interface{}{"name": "scan.png"}}
+	if _, err := engine.Start(ctx, file); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	if _, err := engine.Start(ctx, file); !errors.Is(err, ErrRunning) {
+		t.Fatalf("expected ErrRunning, got %v", err)
+	}
+
+	hash := bus.take()["hash"]
+	if hash.JobID != "files:f1:hash" || hash.Version != "1.0" {
+		t.Fatalf("unexpected root job: %+v", hash)
+	}
+	if _, err := engine.HandleResult(ctx, contracts.Result{JobID: hash.JobID, FileID: "f1", AttributesPatch: map[string]interface{}{"sha256": "abc"}}); err != nil {
+		t.Fatalf("HandleResult error: %v", err)
+	}
+
+	mime := bus.take()["mime"]
+	if mime.File.Attributes["sha256"] != "abc" || mime.File.Attributes["name"] != "scan.png" {
+		t.Fatalf("expected attributes to be forwarded, got %v", mime.File.Attributes)
+	}
+
+	// ocr fails to publish, so it stays pending while thumb runs.
+	run, err := engine.HandleResult(ctx, contracts.Result{JobID: mime.JobID, FileID: "f1", AttributesPatch: map[string]interface{}{"mime": "image/png"}})
+	if err == nil {
+		t.Fatalf("expected publish error")
+	}
+	if run.Steps["ocr"].Status != StepPending || run.Steps["thumb"].Status != StepRunning {
+		t.Fatalf("unexpected step states: %+v", run.Steps)
+	}
+	thumb := bus.take()["thumbnail"]
+	if thumb.Hints["size"] != "256" || thumb.File.Attributes["mime"] != "image/png" {
+		t.Fatalf("unexpected thumbnail job: %+v", thumb)
+	}
+
+	// A redelivered result publishes the step that failed to go out.
+	if _, err := engine.HandleResult(ctx, contracts.Result{JobID: mime.JobID, FileID: "f1"}); err != nil {
+		t.Fatalf("HandleResult error: %v", err)
+	}
+	ocr := bus.take()["ocr"]
+	if ocr.JobID != "files:f1:ocr" {
+		t.Fatalf("expected ocr job, got %+v", ocr)
+	}
+
+	for _, job := range []contracts.Job{thumb, ocr} {
+		run, err = engine.HandleResult(ctx, contracts.Result{JobID: job.JobID, FileID: "f1"})
+		if err != nil {
+			t.Fatalf("HandleResult error: %v", err)
+		}
+	}
+	if run.Status != RunSucceeded || run.CompletedAt.IsZero() {
+		t.Fatalf("expected run to succeed, got %+v", run)
+	}
+	if _, err := engine.HandleResult(ctx, contracts.Result{JobID: "other", FileID: "f1"}); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unknown job, got %v", err)
+	}
+}
+
+func TestEngineStopsOnFailure(t *testing.T) {
+	ctx := context.Background()
+	p, err := New("files", Step{UoW: "hash"}, Step{UoW: "mime", DependsOn: []string{"hash"}})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	bus := &recordingBus{}
+	engine, _ := NewEngine(p, bus)
+
+	if _, err := engine.Start(ctx, contracts.File{ID: "f1"}); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	run, err := engine.HandleFailure(ctx, "f1", "files:f1:hash", errors.New("corrupt blob"))
+	if err != nil {
+		t.Fatalf("HandleFailure error: %v", err)
+	}
+	if run.Status != RunFailed || run.Steps["hash"].Error != "corrupt blob" || run.Steps["mime"].Status != StepPending {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+	if len(bus.jobs) != 1 {
+		t.Fatalf("expected no jobs after the failure, got %d", len(bus.jobs))
+	}
+
+	// A finished run can be started again.
+	if _, err := engine.Start(ctx, contracts.File{ID: "f1"}); err != nil {
+		t.Fatalf("restart error: %v", err)
+	}
+}
+
+func TestEngineSkipsStepsWithFalseConditions(t *testing.T) {
+	ctx := context.Background()
+	p, err := New("files",
+		Step{UoW: "mime"},
+		Step{UoW: "thumbnail", DependsOn: []string{"mime"}, Condition: `mime startsWith "image/" && file.size < 50MB`},
+		Step{UoW: "ocr", DependsOn: []string{"mime"}, Condition: `steps.mime.attributes.mime == "application/pdf"`},
+		Step{UoW: "index", DependsOn: []string{"thumbnail", "ocr"}},
+	)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	bus := &recordingBus{}
+	engine, _ := NewEngine(p, bus)
+
+	if _, err := engine.Start(ctx, contracts.File{ID: "f1", Blob: contracts.Blob{Size: 1 << 20}}); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	mime := bus.take()["mime"]
+	run, err := engine.HandleResult(ctx, contracts.Result{JobID: mime.JobID, FileID: "f1", AttributesPatch: map[string]interface{}{"mime": "image/png"}})
+	if err != nil {
+		t.Fatalf("HandleResult error: %v", err)
+	}
+	if run.Steps["ocr"].Status != StepSkipped || run.Steps["thumbnail"].Status != StepRunning {
+		t.Fatalf("unexpected step states: %+v", run.Steps)
+	}
+
+	// A skipped dependency counts as done.
+	run, _ = engine.HandleResult(ctx, contracts.Result{JobID: bus.take()["thumbnail"].JobID, FileID: "f1"})
+	if run.Steps["index"].Status != StepRunning {
+		t.Fatalf("expected index to run, got %+v", run.Steps)
+	}
+	run, _ = engine.HandleResult(ctx, contracts.Result{JobID: bus.take()["index"].JobID, FileID: "f1"})
+	if run.Status != RunSucceeded {
+		t.Fatalf("expected run to succeed, got %+v", run)
+	}
+}
+
+func TestNewRejectsConditionsOnUnrelatedSteps(t *testing.T) {
+	_, err := New("files",
+		Step{UoW: "mime"},
+		Step{UoW: "ocr", Condition: `steps.mime.status == "succeeded"`},
+	)
+	if err == nil || !strings.Contains(err.Error(), `reads step "mime", which it does not depend on`) {
+		t.Fatalf("expected dependency error, got %v", err)
+	}
+	if _, err := New("files", Step{UoW: "ocr", Condition: `mime ==`}); err == nil {
+		t.Fatalf("expected syntax error")
+	}
+}
+
+func TestEngineFansOutAndReduces(t *testing.T) {
+	ctx := context.Background()
+	p, err := New("video",
+		Step{Name: "transcode", UoW: "split", Reduce: "merge"},
+		Step{UoW: "publish", DependsOn: []string{"transcode"}},
+	)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	bus := &recordingBus{failOn: "encode"}
+	engine, _ := NewEngine(p, bus)
+	if _, err := engine.Start(ctx, contracts.File{ID: "f1"}); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+
+	split := bus.take()["split"]
+	children := []contracts.Job{
+		{UoW: "encode", Hints: map[string]string{"range": "0-99"}},
+		{UoW: "encode", Hints: map[string]string{"range": "100-199"}},
+	}
+	// The first child fails to publish and goes out again with the next result.
+	run, err := engine.HandleResult(ctx, contracts.Result{JobID: split.JobID, FileID: "f1", ChildJobs: children})
+	if err == nil || run.Steps["transcode"].Status != StepRunning || len(run.Steps["transcode"].Children) != 2 {
+		t.Fatalf("unexpected fan-out: %+v (%v)", run.Steps["transcode"], err)
+	}
+	second := bus.take()["encode"]
+	if second.JobID != "video:f1:transcode#2" || second.Hints["range"] != "100-199" {
+		t.Fatalf("unexpected child job: %+v", second)
+	}
+	if _, err := engine.HandleResult(ctx, contracts.Result{JobID: second.JobID, FileID: "f1", AttributesPatch: map[string]interface{}{"part": 2}}); err != nil {
+		t.Fatalf("HandleResult error: %v", err)
+	}
+	first := bus.take()["encode"]
+	if first.JobID != "video:f1:transcode#1" {
+		t.Fatalf("expected the first child to be retried, got %+v", first)
+	}
+
+	run, _ = engine.HandleResult(ctx, contracts.Result{JobID: first.JobID, FileID: "f1", AttributesPatch: map[string]interface{}{"part": 1}})
+	if run.Steps["transcode"].Reduce == nil || run.Steps["publish"].Status != StepPending {
+		t.Fatalf("expected the reducer to run before publish, got %+v", run.Steps)
+	}
+	merge := bus.take()["merge"]
+	if merge.JobID != "video:f1:transcode#reduce" || len(merge.ChildResults) != 2 || merge.ChildResults[0].AttributesPatch["part"] != 1 {
+		t.Fatalf("expected child results in order, got %+v", merge)
+	}
+
+	run, _ = engine.HandleResult(ctx, contracts.Result{JobID: merge.JobID, FileID: "f1", AttributesPatch: map[string]interface{}{"duration": 90}})
+	if run.Steps["transcode"].Status != StepSucceeded || run.File.Attributes["duration"] != 90 || run.Steps["publish"].Status != StepRunning {
+		t.Fatalf("unexpected run after reduce: %+v", run)
+	}
+}
+
+func TestEngineMergesChildrenWithoutReducer(t *testing.T) {
+	registry := uow.NewRegistry()
+	registry.Register("pages", uowFunc(func(ctx context.Context, job contracts.Job) (*contracts.Result, error) {
+		if page := job.Hints["page"]; page != "" {
+			return &contracts.Result{AttributesPatch: map[string]interface{}{"page_" + page: "ok"}}, nil
+		}
+		return &contracts.Result{ChildJobs: []contracts.Job{{Hints: map[string]string{"page": "1"}}, {Hints: map[string]string{"page": "2"}}}}, nil
+	}))
+	p, _ := New("pdf", Step{UoW: "pages", Runner: RunSync})
+	engine, err := NewEngine(p, &recordingBus{}, WithRegistry(registry))
+	if err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+
+	run, err := engine.Start(context.Background(), contracts.File{ID: "f1"})
+	if err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	if run.Status != RunSucceeded || run.File.Attributes["page_1"] != "ok" || run.File.Attributes["page_2"] != "ok" {
+		t.Fatalf("expected merged child results, got %+v", run)
+	}
+}
+
+func TestEngineResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	p, _ := New("files", Step{UoW: "hash"}, Step{UoW: "mime", DependsOn: []string{"hash"}}, Step{UoW: "ocr", DependsOn: []string{"mime"}})
+	store := NewMemoryStore()
+
+	engine, _ := NewEngine(p, &recordingBus{}, WithStore(store))
+	started, err := engine.Start(ctx, contracts.File{ID: "f1"})
+	if err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	if _, err := engine.HandleResult(ctx, contracts.Result{JobID: "files:f1:hash", FileID: "f1", AttributesPatch: map[string]interface{}{"sha256": "abc"}}); err != nil {
+		t.Fatalf("HandleResult error: %v", err)
+	}
+	// Stale checkpoints do not overwrite newer ones.
+	if err := store.SaveRun(ctx, started); err != nil {
+		t.Fatalf("SaveRun error: %v", err)
+	}
+	// The engine crashes after the mime result was recorded but before it was applied.
+	if err := store.SaveResult(ctx, "files:f1:mime", contracts.Result{JobID: "files:f1:mime", FileID: "f1", AttributesPatch: map[string]interface{}{"mime": "application/pdf"}}); err != nil {
+		t.Fatalf("SaveResult error: %v", err)
+	}
+
+	bus := &recordingBus{}
+	engine, _ = NewEngine(p, bus, WithStore(store))
+	if _, err := engine.HandleResult(ctx, contracts.Result{JobID: "files:f1:mime", FileID: "f1"}); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound before Resume, got %v", err)
+	}
+	if _, err := engine.Start(ctx, contracts.File{ID: "f1"}); !errors.Is(err, ErrRunning) {
+		t.Fatalf("expected ErrRunning for a checkpointed run, got %v", err)
+	}
+	runs, err := engine.Resume(ctx)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("Resume = %d runs, %v", len(runs), err)
+	}
+	run := runs[0]
+	if run.Steps["hash"].Status != StepSucceeded || run.Steps["mime"].Status != StepSucceeded || run.File.Attributes["mime"] != "application/pdf" {
+		t.Fatalf("expected hash and mime to be complete, got %+v", run)
+	}
+	if jobs := bus.take(); len(jobs) != 1 || jobs["ocr"].JobID != "files:f1:ocr" {
+		t.Fatalf("expected only ocr to be published, got %v", jobs)
+	}
+	if _, err := engine.HandleResult(ctx, contracts.Result{JobID: "files:f1:ocr", FileID: "f1"}); err != nil {
+		t.Fatalf("HandleResult error: %v", err)
+	}
+	if incomplete, _ := store.IncompleteRuns(ctx, "files"); len(incomplete) != 0 {
+		t.Fatalf("expected no incomplete runs, got %+v", incomplete)
+	}
+
+	// Starting the finished pipeline again reuses every recorded result.
+	bus = &recordingBus{}
+	engine, _ = NewEngine(p, bus, WithStore(store))
+	run, err = engine.Start(ctx, contracts.File{ID: "f1"})
+	if err != nil || run.Status != RunSucceeded || len(bus.jobs) != 0 {
+		t.Fatalf("expected the rerun to complete from recorded results, got %+v, %d jobs, %v", run, len(bus.jobs), err)
+	}
+	if stored, _ := store.LoadRun(ctx, "files", "f1"); stored.Revision != run.Revision || stored.File.Attributes["sha256"] != "abc" {
+		t.Fatalf("expected the latest checkpoint, got %+v", stored)
+	}
+}
+
+type compensatingUoW struct {
+	uowFunc
+	undo func(job contracts.Job, result contracts.Result) error
+}
+
+func (u compensatingUoW) Compensate(ctx context.Context, job contracts.Job, result contracts.Result) error {
+	return u.undo(job, result)
+}
+
+func TestEngineCompensatesFailedRunsInReverse(t *testing.T) {
+	ctx := context.Background()
+	var (
+		undone     []string
+		undoneJobs = map[string]contracts.Job{}
+	)
+	registry := uow.NewRegistry()
+	for _, name := range []string{"hash", "thumbnail", "ocr"} {
+		name := name
+		registry.Register(name, compensatingUoW{
+			uowFunc: func(context.Context, contracts.Job) (*contracts.Result, error) {
+				return &contracts.Result{AttributesPatch: map[string]interface{}{name: "done"}}, nil
+			},
+			undo: func(job contracts.Job, result contracts.Result) error {
+				undone = append(undone, job.UoW)
+				undoneJobs[job.UoW] = job
+				if result.AttributesPatch[job.UoW] != "done" {
+					return errors.New("unexpected result")
+				}
+				if job.UoW == "hash" {
+					return errors.New("blob already deleted")
+				}
+				return nil
+			},
+		})
+	}
+	p, _ := New("files",
+		Step{UoW: "hash", Runner: RunSync},
+		Step{UoW: "mime", DependsOn: []string{"hash"}},
+		Step{UoW: "thumbnail", DependsOn: []string{"mime"}},
+		Step{UoW: "ocr", DependsOn: []string{"mime"}},
+		Step{UoW: "index", DependsOn: []string{"thumbnail"}},
+	)
+	engine, err := NewEngine(p, &recordingBus{}, WithRegistry(registry), WithStore(NewMemoryStore()))
+	if err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+
+	if _, err := engine.Start(ctx, contracts.File{ID: "f1"}); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	for _, step := range []string{"mime", "thumbnail"} {
+		if _, err := engine.HandleResult(ctx, contracts.Result{JobID: "files:f1:" + step, FileID: "f1", AttributesPatch: map[string]interface{}{step: "done"}}); err != nil {
+			t.Fatalf("HandleResult error: %v", err)
+		}
+	}
+	run, err := engine.HandleFailure(ctx, "f1", "files:f1:index", errors.New("index unavailable"))
+	if err != nil {
+		t.Fatalf("HandleFailure error: %v", err)
+	}
+	// mime has no compensator; hash's compensation fails and is recorded.
+	if strings.Join(undone, ",") != "thumbnail,hash" {
+		t.Fatalf("expected compensation in reverse order, got %v", undone)
+	}
+	if c := run.Steps["thumbnail"].Compensation; c == nil || c.Status != CompensationSucceeded {
+		t.Fatalf("expected thumbnail to be compensated, got %+v", c)
+	}
+	if c := run.Steps["hash"].Compensation; c == nil || c.Status != CompensationFailed || c.Error != "blob already deleted" {
+		t.Fatalf("expected the hash compensation to fail, got %+v", c)
+	}
+	// Compensation gets the job as dispatched, before thumbnail's own result was merged.
+	if attrs := undoneJobs["thumbnail"].File.Attributes; attrs["mime"] != "done" || attrs["thumbnail"] != nil {
+		t.Fatalf("expected the dispatched thumbnail job, got attributes %v", attrs)
+	}
+	if run.Steps["mime"].Compensation != nil {
+		t.Fatalf("expected mime not to be compensated, got %+v", run.Steps["mime"].Compensation)
+	}
+
+	// A result arriving after the failure is compensated on its own; repeated failures change nothing.
+	undone = nil
+	run, err = engine.HandleResult(ctx, contracts.Result{JobID: "files:f1:ocr", FileID: "f1", AttributesPatch: map[string]interface{}{"ocr": "done"}})
+	if err != nil || strings.Join(undone, ",") != "ocr" || run.Steps["ocr"].Compensation.Status != CompensationSucceeded {
+		t.Fatalf("expected the late ocr result to be compensated, got %v, %+v, %v", undone, run.Steps["ocr"], err)
+	}
+	if _, err := engine.HandleFailure(ctx, "f1", "files:f1:index", errors.New("index unavailable")); err != nil || len(undone) != 1 {
+		t.Fatalf("expected no further compensation, got %v, %v", undone, err)
+	}
+}
+
+type versionedUoW struct {
+	uowFunc
+	version string
+}
+
+func (u versionedUoW) Version() string { return u.version }
+
+func TestEngineRerunsStepsForNewUoWVersions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	p, _ := New("files", Step{UoW: "ocr", Runner: RunSync})
+	var jobs []contracts.Job
+	start := func(version string) Run {
+		t.Helper()
+		registry := uow.NewRegistry()
+		registry.Register("ocr", versionedUoW{version: version, uowFunc: func(ctx context.Context, job contracts.Job) (*contracts.Result, error) {
+			jobs = append(jobs, job)
+			return &contracts.Result{}, nil
+		}})
+		engine, _ := NewEngine(p, &recordingBus{}, WithRegistry(registry), WithStore(store))
+		run, err := engine.Start(ctx, contracts.File{ID: "f1"})
+		if err != nil || run.Status != RunSucceeded {
+			t.Fatalf("Start = %+v, %v", run, err)
+		}
+		return run
+	}
+
+	start("1")
+	start("1")
+	run := start("2")
+	if len(jobs) != 2 || jobs[0].IdemKey != "files:f1:ocr@1" || jobs[1].IdemKey != "files:f1:ocr@2" {
+		t.Fatalf("expected one job per version, got %+v", jobs)
+	}
+	if run.Steps["ocr"].Result.UoWVersion != "2" {
+		t.Fatalf("expected the result to record version 2, got %+v", run.Steps["ocr"].Result)
+	}
+}
@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tendant/simple-process/pkg/uow"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the declarative form of a pipeline. It is written in YAML, or in JSON,
+// which the loader accepts as a subset of YAML:
+//
+//	name: files
+//	steps:
+//	  - uow: hash
+//	  - uow: thumbnail
+//	    depends_on: [hash]
+//	    condition: mime startsWith "image/"
+//	    runner: sync
+//	    timeout: 2m
+//	    retry: {max_attempts: 3, backoff: 10s}
+//	  - uow: announce
+//	    depends_on: [thumbnail]
+//	    topic: media
+//	    hints: {channel: "#uploads"}
+//
+// Durations are strings such as "30s" or "2m". A bare number is rejected rather
+// than read as nanoseconds.
+type Spec struct {
+	Name  string `yaml:"name"`
+	Steps []Step `yaml:"steps"`
+}
+
+// LoadSpec decodes a spec from r. Unknown fields are rejected, so typos surface
+// with their line number instead of being ignored.
+func LoadSpec(r io.Reader) (*Spec, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read pipeline spec: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("decode pipeline spec: %w", err)
+	}
+	if err := checkDurations(&root); err != nil {
+		return nil, fmt.Errorf("decode pipeline spec: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var spec Spec
+	if err := dec.Decode(&spec); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("decode pipeline spec: empty document")
+		}
+		return nil, fmt.Errorf("decode pipeline spec: %w", err)
+	}
+	return &spec, nil
+}
+
+// checkDurations rejects numeric step timeouts and retry backoffs, which the YAML
+// decoder would otherwise read as nanoseconds.
+func checkDurations(root *yaml.Node) error {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil
+	}
+	steps := mappingValue(root.Content[0], "steps")
+	if steps == nil || steps.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for _, step := range steps.Content {
+		durations := []*yaml.Node{mappingValue(step, "timeout"), mappingValue(mappingValue(step, "retry"), "backoff")}
+		for i, field := range []string{"timeout", "backoff"} {
+			if n := durations[i]; n != nil && n.Kind == yaml.ScalarNode && (n.Tag == "!!int" || n.Tag == "!!float") {
+				return fmt.Errorf("line %d: %s %s has no unit; write a duration such as \"%ss\"", n.Line, field, n.Value, n.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value stored under key in a mapping node, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// LoadSpecFile decodes the spec stored at path.
+func LoadSpecFile(path string) (*Spec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	spec, err := LoadSpec(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// Build validates the spec and returns its pipeline. When registry is not nil,
+// every step's UoW and reducer must be registered; all unknown names are reported at once.
+func (s *Spec) Build(registry *uow.Registry) (*Pipeline, error) {
+	if registry != nil {
+		var errs []error
+		for _, step := range s.Steps {
+			name := step.Name
+			if name == "" {
+				name = step.UoW
+			}
+			for _, u := range []string{step.UoW, step.Reduce} {
+				if _, ok := registry.Lookup(u); u != "" && !ok {
+					errs = append(errs, fmt.Errorf("step %q: unknown uow %q (registered: %s)", name, u, strings.Join(registry.Names(), ", ")))
+				}
+			}
+		}
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("pipeline %s: %w", s.Name, errors.Join(errs...))
+		}
+	}
+	return New(s.Name, s.Steps...)
+}
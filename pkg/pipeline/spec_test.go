@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters/metadata"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/uow"
+)
+
+type uowFunc func(ctx context.Context, job contracts.Job) (*contracts.Result, error)
+
+func (f uowFunc) Process(ctx context.Context, job contracts.Job) (*contracts.Result, error) {
+	return f(ctx, job)
+}
+
+type topicBus struct {
+	recordingBus
+	topics []string
+}
+
+func (b *topicBus) PublishTo(ctx context.Context, topic string, job contracts.Job) error {
+	b.topics = append(b.topics, topic)
+	return b.Publish(ctx, job)
+}
+
+const specYAML = `
+name: files
+steps:
+  - uow: mime
+    runner: sync
+    timeout: 2m
+    retry: {max_attempts: 2, backoff: 10ms}
+  - name: thumb
+    uow: thumbnail
+    depends_on: [mime]
+    condition: mime startsWith "image/"
+    topic: media
+    hints: {size: "256", timeout: 30}
+`
+
+func testRegistry(t *testing.T, names ...string) *uow.Registry {
+	t.Helper()
+	registry := uow.NewRegistry()
+	for _, name := range names {
+		err := registry.Register(name, uowFunc(func(context.Context, contracts.Job) (*contracts.Result, error) {
+			return &contracts.Result{}, nil
+		}))
+		if err != nil {
+			t.Fatalf("Register error: %v", err)
+		}
+	}
+	return registry
+}
+
+func TestSpecBuildsRunnablePipeline(t *testing.T) {
+	spec, err := LoadSpec(strings.NewReader(specYAML))
+	if err != nil {
+		t.Fatalf("LoadSpec error: %v", err)
+	}
+	p, err := spec.Build(testRegistry(t, "thumbnail"))
+	if err == nil || !strings.Contains(err.Error(), `unknown uow "mime" (registered: thumbnail)`) {
+		t.Fatalf("expected unknown uow error, got %v", err)
+	}
+
+	// The sync mime step fails once and succeeds on its second attempt.
+	registry := testRegistry(t, "thumbnail")
+	calls := 0
+	registry.Register("mime", uowFunc(func(ctx context.Context, job contracts.Job) (*contracts.Result, error) {
+		if calls++; calls == 1 {
+			return nil, errors.New("transient")
+		}
+		return &contracts.Result{AttributesPatch: map[string]interface{}{"mime": "image/png"}}, nil
+	}))
+	if p, err = spec.Build(registry); err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+
+	bus := &topicBus{}
+	meta := metadata.NewMemoryMetadata()
+	engine, err := NewEngine(p, bus, WithRegistry(registry), WithMetadata(meta))
+	if err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+	run, err := engine.Start(context.Background(), contracts.File{ID: "f1"})
+	if err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	if run.Steps["mime"].Status != StepSucceeded || run.Steps["thumb"].Status != StepRunning || calls != 2 {
+		t.Fatalf("unexpected run after %d calls: %+v", calls, run.Steps)
+	}
+	if attrs, _ := meta.GetFileAttributes(context.Background(), "f1"); attrs["mime"] != "image/png" {
+		t.Fatalf("expected sync result to be persisted, got %v", attrs)
+	}
+
+	thumb := bus.take()["thumbnail"]
+	// Hints are free-form, so a bare number there is just a string.
+	if want := map[string]string{"size": "256", "timeout": "30"}; !reflect.DeepEqual(thumb.Hints, want) {
+		t.Fatalf("expected hints %v, got %v", want, thumb.Hints)
+	}
+	if len(bus.topics) != 1 || bus.topics[0] != "media" {
+		t.Fatalf("expected publish to the media topic, got %v", bus.topics)
+	}
+}
+
+func TestSpecErrors(t *testing.T) {
+	cases := map[string]string{
+		"name: files\nsteps:\n  - uow: hash\n    dependson: [x]\n":                                "field dependson not found",
+		"name: files\nsteps:\n  - uow: a\n    depends_on: [b]\n  - uow: b\n    depends_on: [a]\n": "cycle between steps a -> b -> a",
+		"name: files\nsteps:\n  - uow: a\n    runner: lambda\n":                                   `runner must be "async" or "sync"`,
+		`{"name": "files", "steps": [{"uow": "a", "timeout": "soon"}]}`:                           "decode pipeline spec",
+		"name: files\nsteps:\n  - uow: a\n    runner: sync\n    timeout: 30\n":                    `line 5: timeout 30 has no unit; write a duration such as "30s"`,
+		"name: files\nsteps:\n  - uow: a\n    runner: sync\n    retry: {backoff: 1.5}\n":          "line 5: backoff 1.5 has no unit",
+		"name: files\nsteps:\n  - uow: a\n    retry: {max_attempts: 3}\n":                         "retry and timeout apply to sync steps only",
+		"name: files\nsteps:\n  - uow: a\n    timeout: 1m\n":                                      "retry and timeout apply to sync steps only",
+		"": "empty document",
+	}
+	for src, want := range cases {
+		spec, err := LoadSpec(strings.NewReader(src))
+		if err == nil {
+			_, err = spec.Build(nil)
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error containing %q, got %v", src, want, err)
+		}
+	}
+
+	spec, err := LoadSpec(strings.NewReader(`{"name": "files", "steps": [{"uow": "a", "topic": "slow"}, {"uow": "b", "runner": "sync", "timeout": "90s"}]}`))
+	if err != nil {
+		t.Fatalf("LoadSpec JSON error: %v", err)
+	}
+	if spec.Steps[1].Timeout != 90*time.Second {
+		t.Fatalf("unexpected timeout: %v", spec.Steps[1].Timeout)
+	}
+	p, _ := spec.Build(nil)
+	registry := testRegistry(t, "b")
+	if _, err := NewEngine(p, &recordingBus{}, WithRegistry(registry)); err == nil || !strings.Contains(err.Error(), `no bus for topic "slow"`) {
+		t.Fatalf("expected missing topic bus error, got %v", err)
+	}
+	if _, err := NewEngine(p, &recordingBus{}, WithRegistry(registry), WithTopicBus("slow", &recordingBus{})); err != nil {
+		t.Fatalf("NewEngine error: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+// Package sql implements pipeline.Store on top of database/sql for SQLite and
+// Postgres, so pipeline runs survive a restart of the engine.
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tendant/simple-process/internal/sqldialect"
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/pipeline"
+)
+
+// Dialect selects the SQL flavour used by the store.
+type Dialect = sqldialect.Dialect
+
+// Supported dialects.
+const (
+	SQLite   = sqldialect.SQLite
+	Postgres = sqldialect.Postgres
+)
+
+// Store keeps run checkpoints in sp_pipeline_runs and job results in sp_pipeline_results.
+type Store struct {
+	db      *stdsql.DB
+	dialect Dialect
+}
+
+// New wraps an open database handle. Call Migrate to create the tables.
+func New(db *stdsql.DB, dialect Dialect) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("database handle is required")
+	}
+	if err := dialect.Validate(); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, dialect: dialect}, nil
+}
+
+// Migrate creates the checkpoint tables. It is safe to call on every start.
+func (s *Store) Migrate(ctx context.Context) error {
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS sp_pipeline_runs (
+	pipeline TEXT NOT NULL,
+	file_id TEXT NOT NULL,
+	revision BIGINT NOT NULL,
+	status TEXT NOT NULL,
+	run %s NOT NULL,
+	updated_at %s NOT NULL,
+	PRIMARY KEY (pipeline, file_id)
+)`, s.dialect.JSONType(), s.dialect.TimeType()),
+		`CREATE INDEX IF NOT EXISTS sp_pipeline_runs_status ON sp_pipeline_runs (pipeline, status)`,
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS sp_pipeline_results (
+	idem_key TEXT PRIMARY KEY,
+	result %s NOT NULL,
+	created_at %s NOT NULL
+)`, s.dialect.JSONType(), s.dialect.TimeType()),
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create pipeline tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// SaveRun replaces the run's checkpoint unless the stored one has a higher revision.
+func (s *Store) SaveRun(ctx context.Context, run pipeline.Run) error {
+	payload, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("marshal run: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, s.dialect.Rebind(`INSERT INTO sp_pipeline_runs (pipeline, file_id, revision, status, run, updated_at)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (pipeline, file_id) DO UPDATE SET revision = excluded.revision, status = excluded.status, run = excluded.run, updated_at = excluded.updated_at
+WHERE sp_pipeline_runs.revision <= excluded.revision`),
+		run.Pipeline, run.File.ID, run.Revision, string(run.Status), string(payload), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("save run: %w", err)
+	}
+	return nil
+}
+
+// LoadRun returns the checkpoint for fileID, or adapters.ErrNotFound.
+func (s *Store) LoadRun(ctx context.Context, pipelineName, fileID string) (pipeline.Run, error) {
+	var raw string
+	err := s.db.QueryRowContext(ctx, s.dialect.Rebind(`SELECT run FROM sp_pipeline_runs WHERE pipeline = ? AND file_id = ?`),
+		pipelineName, fileID).Scan(&raw)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return pipeline.Run{}, adapters.ErrNotFound
+	}
+	if err != nil {
+		return pipeline.Run{}, fmt.Errorf("load run: %w", err)
+	}
+
+	var run pipeline.Run
+	if err := json.Unmarshal([]byte(raw), &run); err != nil {
+		return pipeline.Run{}, fmt.Errorf("decode run: %w", err)
+	}
+	return run, nil
+}
+
+// IncompleteRuns returns the unfinished runs of the pipeline, ordered by file ID.
+func (s *Store) IncompleteRuns(ctx context.Context, pipelineName string) ([]pipeline.Run, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(`SELECT run FROM sp_pipeline_runs
+WHERE pipeline = ? AND status = ? ORDER BY file_id`), pipelineName, string(pipeline.RunRunning))
+	if err != nil {
+		return nil, fmt.Errorf("load incomplete runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []pipeline.Run
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var run pipeline.Run
+		if err := json.Unmarshal([]byte(raw), &run); err != nil {
+			return nil, fmt.Errorf("decode run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// SaveResult records the result unless one is already recorded for idemKey.
+func (s *Store) SaveResult(ctx context.Context, idemKey string, result contracts.Result) error {
+	if idemKey == "" {
+		return errors.New("idempotency key is required")
+	}
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, s.dialect.Rebind(`INSERT INTO sp_pipeline_results (idem_key, result, created_at) VALUES (?, ?, ?) ON CONFLICT (idem_key) DO NOTHING`),
+		idemKey, string(payload), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("save result: %w", err)
+	}
+	return nil
+}
+
+// LoadResult returns the result recorded for idemKey, or adapters.ErrNotFound.
+func (s *Store) LoadResult(ctx context.Context, idemKey string) (contracts.Result, error) {
+	var raw string
+	err := s.db.QueryRowContext(ctx, s.dialect.Rebind(`SELECT result FROM sp_pipeline_results WHERE idem_key = ?`), idemKey).Scan(&raw)
+	if errors.Is(err, stdsql.ErrNoRows) {
+		return contracts.Result{}, adapters.ErrNotFound
+	}
+	if err != nil {
+		return contracts.Result{}, fmt.Errorf("load result: %w", err)
+	}
+
+	var result contracts.Result
+	if err := json.Unmarshal([]byte(raw), &result); err != nil {
+		return contracts.Result{}, fmt.Errorf("decode result: %w", err)
+	}
+	return result, nil
+}
+
+var _ pipeline.Store = (*Store)(nil)
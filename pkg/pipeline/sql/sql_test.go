@@ -0,0 +1,110 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/adapters/bus"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/pipeline"
+	_ "modernc.org/sqlite"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := stdsql.Open("sqlite", filepath.Join(t.TempDir(), "pipeline.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := New(db, SQLite)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Migrate(context.Background()); err != nil {
+			t.Fatalf("Migrate error: %v", err)
+		}
+	}
+	return store
+}
+
+func TestStoreKeepsNewestCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	run := pipeline.Run{Pipeline: "files", File: contracts.File{ID: "f1"}, Status: pipeline.RunRunning, Revision: 2,
+		Steps: map[string]pipeline.StepState{"hash": {Status: pipeline.StepSucceeded, JobID: "files:f1:hash"}}}
+	if err := store.SaveRun(ctx, run); err != nil {
+		t.Fatalf("SaveRun error: %v", err)
+	}
+	stale := run
+	stale.Revision = 1
+	stale.Steps = map[string]pipeline.StepState{"hash": {Status: pipeline.StepRunning}}
+	if err := store.SaveRun(ctx, stale); err != nil {
+		t.Fatalf("SaveRun error: %v", err)
+	}
+	done := pipeline.Run{Pipeline: "files", File: contracts.File{ID: "f2"}, Status: pipeline.RunSucceeded, Revision: 1}
+	if err := store.SaveRun(ctx, done); err != nil {
+		t.Fatalf("SaveRun error: %v", err)
+	}
+
+	loaded, err := store.LoadRun(ctx, "files", "f1")
+	if err != nil || loaded.Revision != 2 || loaded.Steps["hash"].Status != pipeline.StepSucceeded {
+		t.Fatalf("LoadRun = %+v, %v", loaded, err)
+	}
+	if _, err := store.LoadRun(ctx, "other", "f1"); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	runs, err := store.IncompleteRuns(ctx, "files")
+	if err != nil || len(runs) != 1 || runs[0].File.ID != "f1" {
+		t.Fatalf("IncompleteRuns = %+v, %v", runs, err)
+	}
+}
+
+func TestStoreKeepsFirstResult(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	if _, err := store.LoadResult(ctx, "files:f1:hash"); !errors.Is(err, adapters.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	for _, sha := range []string{"abc", "def"} {
+		err := store.SaveResult(ctx, "files:f1:hash", contracts.Result{JobID: "files:f1:hash", FileID: "f1", AttributesPatch: map[string]interface{}{"sha256": sha}})
+		if err != nil {
+			t.Fatalf("SaveResult error: %v", err)
+		}
+	}
+	result, err := store.LoadResult(ctx, "files:f1:hash")
+	if err != nil || result.AttributesPatch["sha256"] != "abc" {
+		t.Fatalf("LoadResult = %+v, %v", result, err)
+	}
+}
+
+func TestEngineResumesFromSQLStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	p, _ := pipeline.New("files", pipeline.Step{UoW: "hash"}, pipeline.Step{UoW: "mime", DependsOn: []string{"hash"}})
+
+	engine, _ := pipeline.NewEngine(p, bus.NewMemoryBus(4), pipeline.WithStore(store))
+	if _, err := engine.Start(ctx, contracts.File{ID: "f1"}); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	if _, err := engine.HandleResult(ctx, contracts.Result{JobID: "files:f1:hash", FileID: "f1"}); err != nil {
+		t.Fatalf("HandleResult error: %v", err)
+	}
+
+	restarted, _ := pipeline.NewEngine(p, bus.NewMemoryBus(4), pipeline.WithStore(store))
+	runs, err := restarted.Resume(ctx)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("Resume = %+v, %v", runs, err)
+	}
+	if runs[0].Steps["hash"].Status != pipeline.StepSucceeded || runs[0].Steps["mime"].Status != pipeline.StepRunning {
+		t.Fatalf("expected to resume at mime, got %+v", runs[0].Steps)
+	}
+}
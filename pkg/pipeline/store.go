@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// Store checkpoints runs and the results of their jobs, so that an engine
+// restarted after a crash can resume where the previous one stopped.
+type Store interface {
+	// SaveRun replaces the checkpoint of the run unless the stored one has a
+	// higher Revision, so checkpoints written concurrently never go back in time.
+	SaveRun(ctx context.Context, run Run) error
+	// LoadRun returns the checkpoint for fileID, or adapters.ErrNotFound.
+	LoadRun(ctx context.Context, pipeline, fileID string) (Run, error)
+	// IncompleteRuns returns the checkpoints of the pipeline's runs that have not finished.
+	IncompleteRuns(ctx context.Context, pipeline string) ([]Run, error)
+	// SaveResult records the result of the job with the given IdemKey. The first
+	// result recorded for a key is kept.
+	SaveResult(ctx context.Context, idemKey string, result contracts.Result) error
+	// LoadResult returns the result recorded for idemKey, or adapters.ErrNotFound.
+	LoadResult(ctx context.Context, idemKey string) (contracts.Result, error)
+}
+
+// MemoryStore is an in-memory Store for tests and examples. It keeps the JSON
+// encoding of what it is given, like a durable store would.
+type MemoryStore struct {
+	mu      sync.Mutex
+	runs    map[string]memoryRun
+	results map[string][]byte
+}
+
+type memoryRun struct {
+	pipeline string
+	revision int64
+	done     bool
+	data     []byte
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{runs: make(map[string]memoryRun), results: make(map[string][]byte)}
+}
+
+// SaveRun replaces the run's checkpoint unless the stored one is newer.
+func (s *MemoryStore) SaveRun(ctx context.Context, run Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := run.Pipeline + "\x00" + run.File.ID
+	if stored, ok := s.runs[key]; ok && stored.revision > run.Revision {
+		return nil
+	}
+	s.runs[key] = memoryRun{pipeline: run.Pipeline, revision: run.Revision, done: run.Done(), data: data}
+	return nil
+}
+
+// LoadRun returns the checkpoint for fileID, or adapters.ErrNotFound.
+func (s *MemoryStore) LoadRun(ctx context.Context, pipeline, fileID string) (Run, error) {
+	s.mu.Lock()
+	stored, ok := s.runs[pipeline+"\x00"+fileID]
+	s.mu.Unlock()
+
+	if !ok {
+		return Run{}, adapters.ErrNotFound
+	}
+	var run Run
+	err := json.Unmarshal(stored.data, &run)
+	return run, err
+}
+
+// IncompleteRuns returns the unfinished runs of the pipeline, ordered by file ID.
+func (s *MemoryStore) IncompleteRuns(ctx context.Context, pipeline string) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var runs []Run
+	for _, stored := range s.runs {
+		if stored.pipeline != pipeline || stored.done {
+			continue
+		}
+		var run Run
+		if err := json.Unmarshal(stored.data, &run); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].File.ID < runs[j].File.ID })
+	return runs, nil
+}
+
+// SaveResult records the result unless one is already recorded for idemKey.
+func (s *MemoryStore) SaveResult(ctx context.Context, idemKey string, result contracts.Result) error {
+	if idemKey == "" {
+		return errors.New("idempotency key is required")
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.results[idemKey]; !ok {
+		s.results[idemKey] = data
+	}
+	return nil
+}
+
+// LoadResult returns the result recorded for idemKey, or adapters.ErrNotFound.
+func (s *MemoryStore) LoadResult(ctx context.Context, idemKey string) (contracts.Result, error) {
+	s.mu.Lock()
+	data, ok := s.results[idemKey]
+	s.mu.Unlock()
+
+	if !ok {
+		return contracts.Result{}, adapters.ErrNotFound
+	}
+	var result contracts.Result
+	err := json.Unmarshal(data, &result)
+	return result, err
+}
+
+var _ Store = (*MemoryStore)(nil)
@@ -2,6 +2,8 @@ package runner
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/tendant/simple-process/pkg/adapters"
 	"github.com/tendant/simple-process/pkg/contracts"
@@ -22,29 +24,140 @@ func NewSyncRunner() *SyncRunner {
 	return &SyncRunner{}
 }
 
-// Run executes the UoW's Process method directly.
-func (r *SyncRunner) Run(ctx context.Context, uow uow.UoW, job contracts.Job) (*contracts.Result, error) {
-	return uow.Process(ctx, job)
+// Run executes the UoW's Process method directly. Results of a uow.Versioned UoW
+// are stamped with its version unless they carry one.
+func (r *SyncRunner) Run(ctx context.Context, u uow.UoW, job contracts.Job) (*contracts.Result, error) {
+	result, err := u.Process(ctx, job)
+	if result != nil && result.UoWVersion == "" {
+		result.UoWVersion = uow.VersionOf(u)
+	}
+	return result, err
 }
 
 // AsyncRunner sends a UoW job to a message bus for asynchronous processing.
 // It's suitable for long-running or resource-intensive UoWs.
 type AsyncRunner struct {
 	Bus adapters.Bus
+
+	// Storage, when set, presigns File.Blob.Location into Job.PresignedGet before publishing.
+	Storage adapters.Storage
+	// ExpectedLatency is how long jobs usually wait and run; presigned URLs stay valid for twice as long.
+	ExpectedLatency time.Duration
+	// ArtifactPrefix, when set and Storage supports it, fills Job.ArtifactUpload for the returned prefix.
+	ArtifactPrefix func(job contracts.Job) string
+}
+
+// AsyncOption customises an AsyncRunner.
+type AsyncOption func(*AsyncRunner)
+
+// WithPresign makes the runner presign the job's blob so remote workers can read it without
+// storage credentials. A job hint "expected_latency" (e.g. "30m") overrides expectedLatency.
+func WithPresign(storage adapters.Storage, expectedLatency time.Duration) AsyncOption {
+	return func(r *AsyncRunner) {
+		r.Storage = storage
+		r.ExpectedLatency = expectedLatency
+	}
+}
+
+// WithArtifactUpload grants workers presigned write access to the prefix returned for each job.
+// It requires WithPresign with a Storage implementing adapters.UploadPresigner.
+func WithArtifactUpload(prefix func(job contracts.Job) string) AsyncOption {
+	return func(r *AsyncRunner) { r.ArtifactPrefix = prefix }
 }
 
 // NewAsyncRunner creates a new AsyncRunner.
-func NewAsyncRunner(bus adapters.Bus) *AsyncRunner {
-	return &AsyncRunner{Bus: bus}
+func NewAsyncRunner(bus adapters.Bus, opts ...AsyncOption) *AsyncRunner {
+	r := &AsyncRunner{Bus: bus}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // Run publishes the job to the configured message bus.
 // It does not wait for the UoW to complete and returns nil result and error.
+// A job with a future NotBefore is sent with PublishAt, so the bus must implement
+// adapters.DelayingBus, as scheduler.Scheduler does; on other buses Run fails with
+// adapters.ErrUnsupported. Presigned URLs of a delayed job also cover its delay.
 func (r *AsyncRunner) Run(ctx context.Context, uow uow.UoW, job contracts.Job) (*contracts.Result, error) {
-	err := r.Bus.Publish(ctx, job)
+	now := time.Now()
+	var delayer adapters.DelayingBus
+	if job.NotBefore != nil && job.NotBefore.After(now) {
+		var ok bool
+		if delayer, ok = r.Bus.(adapters.DelayingBus); !ok {
+			return nil, fmt.Errorf("delay job until %s: %w", job.NotBefore.Format(time.RFC3339), adapters.ErrUnsupported)
+		}
+	}
+
+	job, err := r.presign(ctx, job, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if delayer != nil {
+		err = delayer.PublishAt(ctx, job, *job.NotBefore)
+	} else {
+		err = r.Bus.Publish(ctx, job)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return nil, nil
 }
 
+const minPresignExpiry = 5 * time.Minute
+
+func (r *AsyncRunner) presign(ctx context.Context, job contracts.Job, now time.Time) (contracts.Job, error) {
+	if r.Storage == nil {
+		return job, nil
+	}
+
+	expiry := r.presignExpiry(job, now)
+	if job.PresignedGet == "" && job.File.Blob.Location != "" {
+		var (
+			url string
+			err error
+		)
+		if presigner, ok := r.Storage.(adapters.ExpiringPresigner); ok {
+			url, err = presigner.PresignGetWithExpiry(ctx, job.File.Blob.Location, expiry)
+		} else {
+			url, err = r.Storage.PresignGet(ctx, job.File.Blob.Location)
+		}
+		if err != nil {
+			return job, fmt.Errorf("presign %s: %w", job.File.Blob.Location, err)
+		}
+		job.PresignedGet = url
+	}
+
+	if r.ArtifactPrefix != nil && job.ArtifactUpload == nil {
+		presigner, ok := r.Storage.(adapters.UploadPresigner)
+		if !ok {
+			return job, fmt.Errorf("artifact upload: %w", adapters.ErrUnsupported)
+		}
+		upload, err := presigner.PresignUpload(ctx, r.ArtifactPrefix(job))
+		if err != nil {
+			return job, fmt.Errorf("presign artifact upload: %w", err)
+		}
+		job.ArtifactUpload = &upload
+	}
+	return job, nil
+}
+
+// presignExpiry is twice the expected latency, at least minPresignExpiry, counted
+// from when the job is released rather than from now.
+func (r *AsyncRunner) presignExpiry(job contracts.Job, now time.Time) time.Duration {
+	latency := r.ExpectedLatency
+	if hint, ok := job.Hints["expected_latency"]; ok {
+		if d, err := time.ParseDuration(hint); err == nil {
+			latency = d
+		}
+	}
+	expiry := 2 * latency
+	if expiry < minPresignExpiry {
+		expiry = minPresignExpiry
+	}
+	if job.NotBefore != nil && job.NotBefore.After(now) {
+		expiry += job.NotBefore.Sub(now)
+	}
+	return expiry
+}
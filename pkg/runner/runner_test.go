@@ -0,0 +1,132 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	busadapter "github.com/tendant/simple-process/pkg/adapters/bus"
+	"github.com/tendant/simple-process/pkg/adapters/storage"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/uows/go/hash"
+)
+
+func TestAsyncRunnerPresignsJobsForRemoteWorkers(t *testing.T) {
+	ctx := context.Background()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fs, err := storage.NewFSStorage(storage.FSConfig{Root: t.TempDir(), BaseURL: server.URL, Secret: []byte("secret")})
+	if err != nil {
+		t.Fatalf("NewFSStorage error: %v", err)
+	}
+	mux.Handle("/", fs.Handler())
+
+	if err := fs.Put(ctx, "uploads/doc.txt", strings.NewReader("hello async world")); err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+
+	bus := busadapter.NewMemoryBus(1)
+	runner := NewAsyncRunner(bus,
+		WithPresign(fs, 10*time.Minute),
+		WithArtifactUpload(func(job contracts.Job) string { return "artifacts/" }),
+	)
+
+	job := contracts.Job{
+		JobID: "job-1",
+		UoW:   "hash",
+		File:  contracts.File{ID: "file-1", Blob: contracts.Blob{Location: "uploads/doc.txt"}},
+	}
+	if _, err := runner.Run(ctx, nil, job); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+
+	var published contracts.Job
+	subCtx, stop := context.WithCancel(ctx)
+	bus.Subscribe(subCtx, busadapter.DefaultTopic, "test", func(_ context.Context, msg adapters.Message) error {
+		published = msg.Job()
+		stop()
+		return nil
+	})
+	if !strings.HasPrefix(published.PresignedGet, server.URL+"/uploads/doc.txt?") {
+		t.Fatalf("expected presigned URL, got %q", published.PresignedGet)
+	}
+	if published.ArtifactUpload == nil || published.ArtifactUpload.Prefix != "artifacts/" {
+		t.Fatalf("expected artifact upload grant, got %#v", published.ArtifactUpload)
+	}
+
+	// A worker without any storage adapter can now process the job end to end.
+	result, err := NewSyncRunner().Run(ctx, &hash.HashUoW{}, published)
+	if err != nil {
+		t.Fatalf("hash error: %v", err)
+	}
+	const expected = "23d3590d64af323ca8ddbfd54ee96263f8d7fd42fc0db36617cdccd5d1b1482e"
+	if result.AttributesPatch["sha256"] != expected {
+		t.Fatalf("unexpected hash: %v", result.AttributesPatch["sha256"])
+	}
+	if _, err := fs.Stat(ctx, result.Artifacts[0].Location); err != nil {
+		t.Fatalf("artifact not uploaded: %v", err)
+	}
+}
+
+func TestAsyncRunnerRejectsDelaysTheBusCannotHonour(t *testing.T) {
+	bus := busadapter.NewMemoryBus(1)
+	later := time.Now().Add(time.Hour)
+	_, err := NewAsyncRunner(bus).Run(context.Background(), nil, contracts.Job{JobID: "j1", NotBefore: &later})
+	if !errors.Is(err, adapters.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+
+	earlier := time.Now().Add(-time.Minute)
+	if _, err := NewAsyncRunner(bus).Run(context.Background(), nil, contracts.Job{JobID: "j2", NotBefore: &earlier}); err != nil {
+		t.Fatalf("expected a due job to be published, got %v", err)
+	}
+}
+
+type delayingBus struct {
+	published []string
+	at        time.Time
+}
+
+func (b *delayingBus) Publish(ctx context.Context, job contracts.Job) error {
+	b.published = append(b.published, job.JobID)
+	return nil
+}
+
+func (b *delayingBus) PublishAt(ctx context.Context, job contracts.Job, at time.Time) error {
+	b.at = at
+	return nil
+}
+
+func TestAsyncRunnerPublishesDelayedJobsAt(t *testing.T) {
+	bus := &delayingBus{}
+	store := &expiryStorage{}
+	later := time.Now().Add(time.Hour)
+	job := contracts.Job{JobID: "j1", NotBefore: &later, File: contracts.File{Blob: contracts.Blob{Location: "uploads/doc.txt"}}}
+	if _, err := NewAsyncRunner(bus, WithPresign(store, 10*time.Minute)).Run(context.Background(), nil, job); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if !bus.at.Equal(later) || len(bus.published) != 0 {
+		t.Fatalf("expected PublishAt(%v), got at %v and publishes %v", later, bus.at, bus.published)
+	}
+	// The URL must still be valid when the job is released an hour from now.
+	if store.ttl < time.Hour+20*time.Minute-time.Second || store.ttl > time.Hour+20*time.Minute {
+		t.Fatalf("expected the presign to cover the delay, got %v", store.ttl)
+	}
+}
+
+type expiryStorage struct {
+	adapters.Storage
+	ttl time.Duration
+}
+
+func (s *expiryStorage) PresignGetWithExpiry(ctx context.Context, location string, ttl time.Duration) (string, error) {
+	s.ttl = ttl
+	return "https://storage.example/" + location, nil
+}
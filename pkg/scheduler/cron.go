@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes the occurrences of a recurring job.
+type Schedule interface {
+	// Next returns the first occurrence strictly after t.
+	Next(t time.Time) time.Time
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a five-field cron expression: minute, hour, day of month,
+// month and day of week. Fields accept "*", numbers, ranges ("1-5"), steps
+// ("*/15", "10-40/10") and lists ("1,15"); months and weekdays also accept names
+// such as "jan" and "mon", and Sunday is 0 or 7. As in classic cron, a day matches
+// when either day field does if both are restricted. The descriptors @yearly,
+// @monthly, @weekly, @daily, @hourly and "@every <duration>" are supported too.
+// Occurrences are computed in the location of the time passed to Next.
+func ParseCron(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("cron %q: @every needs a duration of at least 1s", spec)
+		}
+		return every(d), nil
+	}
+	if expanded, ok := descriptors[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	var (
+		c   cron
+		err error
+	)
+	parsers := []struct {
+		dst      *uint64
+		min, max int
+		names    []string
+	}{
+		{&c.minute, 0, 59, nil},
+		{&c.hour, 0, 23, nil},
+		{&c.dom, 1, 31, nil},
+		{&c.month, 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+		{&c.dow, 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+	}
+	for i, p := range parsers {
+		if *p.dst, err = parseField(fields[i], p.min, p.max, p.names); err != nil {
+			return nil, fmt.Errorf("cron %q: %w", spec, err)
+		}
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.anyDOM = fields[2] == "*"
+	c.anyDOW = fields[4] == "*"
+	return c, nil
+}
+
+// parseField turns one cron field into a bitset of the values it matches.
+func parseField(field string, min, max int, names []string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = parseValue(bounds[0], min, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = parseValue(bounds[1], min, names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, offset int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(s, name) {
+			return i + offset, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// cron is a parsed five-field expression; each field is a bitset of matching values.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	anyDOM, anyDOW                bool
+}
+
+// Next walks forward from t, skipping whole months, days and hours that cannot
+// match, and gives up after five years for expressions such as "0 0 30 2 *".
+func (c cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDOM || c.anyDOW {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// every fires at multiples of its duration since the zero time, so occurrences
+// are the same whenever the schedule is evaluated.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(e)).Add(time.Duration(e))
+}
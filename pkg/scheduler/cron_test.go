@@ -0,0 +1,41 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronNextOccurrence(t *testing.T) {
+	// Wednesday 2024-01-31 10:07 UTC.
+	from := time.Date(2024, 1, 31, 10, 7, 30, 0, time.UTC)
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 15, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 2, 1, 2, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * mon-fri", time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: the 15th or any Friday, whichever comes first.
+		{"0 0 15 * fri", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		{"5,10-12 10 * * *", time.Date(2024, 1, 31, 10, 10, 0, 0, time.UTC)},
+		{"@every 1h", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		schedule, err := ParseCron(tc.spec)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) error: %v", tc.spec, err)
+		}
+		if got := schedule.Next(from); !got.Equal(tc.want) {
+			t.Errorf("ParseCron(%q).Next = %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "@every 10ms", "@reboot"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Package scheduler publishes jobs at a later time. Delayed jobs, those with a
+// future Job.NotBefore, are held in a durable Store and published to the
+// underlying bus once due, and cron templates enqueue a job at every occurrence of
+// their schedule. A Scheduler is itself an adapters.Bus, so an AsyncRunner on top
+// of it can delay jobs.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/clock"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// Scheduler holds delayed jobs and publishes them to a bus when due.
+type Scheduler struct {
+	bus      adapters.Bus
+	store    Store
+	clock    clock.Clock
+	batch    int
+	interval time.Duration
+	wake     chan struct{}
+
+	mu    sync.Mutex
+	crons map[string]*cronEntry
+}
+
+type cronEntry struct {
+	schedule Schedule
+	template contracts.Job
+	// held is the occurrence currently waiting in the store.
+	held time.Time
+}
+
+// Option customises a Scheduler.
+type Option func(*Scheduler)
+
+// WithClock replaces the system clock, typically with a clock.Fake in tests.
+func WithClock(c clock.Clock) Option {
+	return func(s *Scheduler) { s.clock = c }
+}
+
+// WithBatchSize bounds the jobs published per round; defaults to 100.
+func WithBatchSize(n int) Option {
+	return func(s *Scheduler) { s.batch = n }
+}
+
+// WithInterval sets how often Run polls the store when no job is due sooner;
+// defaults to one second. Polling picks up jobs added by other processes.
+func WithInterval(d time.Duration) Option {
+	return func(s *Scheduler) { s.interval = d }
+}
+
+// New creates a Scheduler holding delayed jobs in store and publishing them onto bus.
+func New(bus adapters.Bus, store Store, opts ...Option) (*Scheduler, error) {
+	if bus == nil {
+		return nil, errors.New("bus is required")
+	}
+	if store == nil {
+		return nil, errors.New("scheduler store is required")
+	}
+	s := &Scheduler{
+		bus:      bus,
+		store:    store,
+		clock:    clock.Real{},
+		batch:    100,
+		interval: time.Second,
+		wake:     make(chan struct{}, 1),
+		crons:    make(map[string]*cronEntry),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.clock == nil {
+		return nil, errors.New("clock is required")
+	}
+	if s.batch <= 0 {
+		return nil, errors.New("batch size must be positive")
+	}
+	if s.interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+	return s, nil
+}
+
+// Publish sends the job to the bus straight away unless its NotBefore is in the
+// future, in which case the job is held until then.
+func (s *Scheduler) Publish(ctx context.Context, job contracts.Job) error {
+	if job.NotBefore == nil || !job.NotBefore.After(s.clock.Now()) {
+		return s.bus.Publish(ctx, job)
+	}
+	return s.PublishAt(ctx, job, *job.NotBefore)
+}
+
+// PublishAt holds the job until at, recorded as its NotBefore, or publishes it
+// straight away if at has passed.
+func (s *Scheduler) PublishAt(ctx context.Context, job contracts.Job, at time.Time) error {
+	job.NotBefore = &at
+	if !at.After(s.clock.Now()) {
+		return s.bus.Publish(ctx, job)
+	}
+	if job.JobID == "" {
+		return errors.New("job id is required")
+	}
+	if err := s.store.Add(ctx, job); err != nil {
+		return fmt.Errorf("hold job %s: %w", job.JobID, err)
+	}
+	s.notify()
+	return nil
+}
+
+// AddCron enqueues a copy of template at every occurrence of spec, see ParseCron.
+// Each occurrence gets the JobID and IdemKey "<name>@<time>", with the time in
+// RFC 3339 UTC, and its NotBefore set to the occurrence. Only the next occurrence
+// is held in the store, so after a restart the scheduler publishes the one that
+// fell due while it was down, once, and skips any others it missed. Cron
+// definitions live in memory, so add them again on every start. Adding a cron
+// under an existing name replaces it: future occurrences held for that name,
+// including those a previous process held, are dropped.
+func (s *Scheduler) AddCron(ctx context.Context, name, spec string, template contracts.Job) error {
+	if name == "" {
+		return errors.New("cron name is required")
+	}
+	if template.UoW == "" {
+		return errors.New("uow is required")
+	}
+	schedule, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	if err := s.removeOccurrences(ctx, name, now); err != nil {
+		return fmt.Errorf("replace cron %s: %w", name, err)
+	}
+	delete(s.crons, name)
+	entry := &cronEntry{schedule: schedule, template: template}
+	if err := s.hold(ctx, name, entry, now); err != nil {
+		return err
+	}
+	s.crons[name] = entry
+	s.notify()
+	return nil
+}
+
+// RemoveCron stops the named cron and drops every occurrence held for it, due or
+// not. Removing an unknown cron only clears occurrences a previous process held.
+func (s *Scheduler) RemoveCron(ctx context.Context, name string) error {
+	if name == "" {
+		return errors.New("cron name is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.removeOccurrences(ctx, name, time.Time{}); err != nil {
+		return fmt.Errorf("remove cron %s: %w", name, err)
+	}
+	delete(s.crons, name)
+	return nil
+}
+
+// removeOccurrences drops the occurrences of the named cron held for after the
+// given time.
+func (s *Scheduler) removeOccurrences(ctx context.Context, name string, after time.Time) error {
+	jobs, err := s.store.List(ctx, name+"@")
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, job := range jobs {
+		// Only "<name>@<time>" is an occurrence; "<name>@x@<time>" belongs to another cron.
+		at, err := time.Parse(time.RFC3339, job.JobID[len(name)+1:])
+		if err != nil || job.JobID != occurrenceID(name, at) || !at.After(after) {
+			continue
+		}
+		ids = append(ids, job.JobID)
+	}
+	return s.store.Remove(ctx, ids...)
+}
+
+// Run publishes due jobs until ctx is cancelled. Publish errors are logged and the
+// jobs retried on the next round.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		for {
+			n, err := s.Tick(ctx)
+			if err != nil && ctx.Err() == nil {
+				fmt.Printf("scheduler: %v\n", err)
+			}
+			// Keep draining while full batches go out cleanly.
+			if err != nil || n < s.batch {
+				break
+			}
+		}
+
+		wait := s.interval
+		if next, ok, err := s.store.Next(ctx); err != nil && ctx.Err() == nil {
+			fmt.Printf("scheduler: %v\n", err)
+		} else if ok {
+			wait = min(wait, next.Sub(s.clock.Now()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.clock.After(wait):
+		case <-s.wake:
+		}
+	}
+}
+
+// Tick publishes one batch of due jobs, earliest first, and returns how many were
+// published. Like outbox.Relay it stops at the first publish failure and leaves
+// the rest held. Delivery is at-least-once: a crash after publishing but before
+// removing the job publishes it again, so consumers should dedup by Job.JobID.
+// Tick then holds the next occurrence of every cron whose occurrence came due.
+func (s *Scheduler) Tick(ctx context.Context) (int, error) {
+	now := s.clock.Now()
+	jobs, err := s.store.Due(ctx, now, s.batch)
+	if err != nil {
+		return 0, fmt.Errorf("load due jobs: %w", err)
+	}
+
+	published := make([]string, 0, len(jobs))
+	var publishErr error
+	for _, job := range jobs {
+		if err := s.bus.Publish(ctx, job); err != nil {
+			publishErr = fmt.Errorf("publish job %s: %w", job.JobID, err)
+			break
+		}
+		published = append(published, job.JobID)
+	}
+	if len(published) > 0 {
+		if err := s.store.Remove(ctx, published...); err != nil {
+			return 0, errors.Join(publishErr, fmt.Errorf("remove published jobs: %w", err))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, entry := range s.crons {
+		if entry.held.After(now) {
+			continue
+		}
+		if err := s.hold(ctx, name, entry, now); err != nil {
+			publishErr = errors.Join(publishErr, err)
+		}
+	}
+	return len(published), publishErr
+}
+
+// hold adds the first occurrence of the cron after now to the store.
+func (s *Scheduler) hold(ctx context.Context, name string, entry *cronEntry, now time.Time) error {
+	at := entry.schedule.Next(now)
+	if at.IsZero() {
+		return fmt.Errorf("cron %s has no further occurrences", name)
+	}
+	at = at.UTC()
+
+	job := entry.template
+	job.JobID = occurrenceID(name, at)
+	job.IdemKey = job.JobID
+	job.NotBefore = &at
+	if err := s.store.Add(ctx, job); err != nil {
+		return fmt.Errorf("hold cron %s: %w", name, err)
+	}
+	entry.held = at
+	return nil
+}
+
+// occurrenceID names the job of the cron occurrence at.
+func occurrenceID(name string, at time.Time) string {
+	return name + "@" + at.Format(time.RFC3339)
+}
+
+// notify wakes Run so it recomputes how long to wait.
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+var _ adapters.DelayingBus = (*Scheduler)(nil)
@@ -0,0 +1,231 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/clock"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/runner"
+)
+
+type recordingBus struct {
+	mu        sync.Mutex
+	failOn    string
+	published []string
+}
+
+func (b *recordingBus) Publish(ctx context.Context, job contracts.Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if job.JobID == b.failOn {
+		b.failOn = ""
+		return errors.New("broker unavailable")
+	}
+	b.published = append(b.published, job.JobID)
+	return nil
+}
+
+func (b *recordingBus) jobs() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]string(nil), b.published...)
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSchedulerHoldsDelayedJobsUntilDue(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	bus := &recordingBus{failOn: "b"}
+	s, err := New(bus, NewMemoryStore(), WithClock(fake))
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	// The runner accepts delays because the scheduler honours them.
+	async := runner.NewAsyncRunner(s)
+	later := func(d time.Duration) *time.Time { at := fake.Now().Add(d); return &at }
+	for _, job := range []contracts.Job{
+		{JobID: "now", UoW: "scan"},
+		{JobID: "b", UoW: "scan", NotBefore: later(10 * time.Minute)},
+		{JobID: "a", UoW: "scan", NotBefore: later(5 * time.Minute)},
+		{JobID: "c", UoW: "scan", NotBefore: later(time.Hour)},
+	} {
+		if _, err := async.Run(ctx, nil, job); err != nil {
+			t.Fatalf("Run(%s) error: %v", job.JobID, err)
+		}
+	}
+	if got := bus.jobs(); !equal(got, []string{"now"}) {
+		t.Fatalf("expected only the undelayed job, got %v", got)
+	}
+
+	fake.Advance(10 * time.Minute)
+	if n, err := s.Tick(ctx); n != 1 || err == nil {
+		t.Fatalf("Tick = %d, %v; expected to stop at the failing job", n, err)
+	}
+	if n, err := s.Tick(ctx); n != 1 || err != nil {
+		t.Fatalf("Tick = %d, %v", n, err)
+	}
+	if got := bus.jobs(); !equal(got, []string{"now", "a", "b"}) {
+		t.Fatalf("expected due jobs in order, got %v", got)
+	}
+	if next, ok, _ := s.store.Next(ctx); !ok || !next.Equal(*later(50 * time.Minute)) {
+		t.Fatalf("expected c to stay held, next = %v, %v", next, ok)
+	}
+}
+
+func TestSchedulerRunsCronAndCatchesUpAfterRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	bus := &recordingBus{}
+
+	s, _ := New(bus, store, WithClock(fake), WithInterval(time.Hour))
+	if err := s.AddCron(ctx, "rescan", "@daily", contracts.Job{UoW: "scan"}); err != nil {
+		t.Fatalf("AddCron error: %v", err)
+	}
+	if err := s.AddCron(ctx, "broken", "@daily", contracts.Job{}); err == nil {
+		t.Fatal("expected an error for a template without a UoW")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	waitFor(t, func() bool { return fake.Waiters() > 0 })
+	fake.Advance(30 * time.Minute)
+	waitFor(t, func() bool { return len(bus.jobs()) == 1 })
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if got := bus.jobs(); got[0] != "rescan@2024-01-02T00:00:00Z" {
+		t.Fatalf("unexpected occurrence %v", got)
+	}
+
+	// The process stops here and comes back two and a half days later: the
+	// occurrence held in the store is published once, then the schedule resumes.
+	fake.Advance(60*time.Hour + 30*time.Minute)
+	restarted, _ := New(bus, store, WithClock(fake))
+	if err := restarted.AddCron(context.Background(), "rescan", "@daily", contracts.Job{UoW: "scan"}); err != nil {
+		t.Fatalf("AddCron error: %v", err)
+	}
+	if n, err := restarted.Tick(context.Background()); n != 1 || err != nil {
+		t.Fatalf("Tick = %d, %v", n, err)
+	}
+	if got := bus.jobs(); !equal(got, []string{"rescan@2024-01-02T00:00:00Z", "rescan@2024-01-03T00:00:00Z"}) {
+		t.Fatalf("expected one catch-up occurrence, got %v", got)
+	}
+	if next, ok, _ := store.Next(context.Background()); !ok || !next.Equal(time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the next occurrence to be held, got %v, %v", next, ok)
+	}
+}
+
+func TestSchedulerPublishAtAndCronReplacement(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	bus := &recordingBus{}
+	s, _ := New(bus, store, WithClock(fake))
+
+	if err := s.PublishAt(ctx, contracts.Job{JobID: "past", UoW: "scan"}, fake.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("PublishAt error: %v", err)
+	}
+	if err := s.PublishAt(ctx, contracts.Job{JobID: "held", UoW: "scan"}, fake.Now().Add(90*time.Minute)); err != nil {
+		t.Fatalf("PublishAt error: %v", err)
+	}
+	if got := bus.jobs(); !equal(got, []string{"past"}) {
+		t.Fatalf("expected only the past job to go out, got %v", got)
+	}
+
+	// Replacing the cron drops its 06:00 occurrence before holding the hourly one.
+	if err := s.AddCron(ctx, "rescan", "0 6 * * *", contracts.Job{UoW: "scan"}); err != nil {
+		t.Fatalf("AddCron error: %v", err)
+	}
+	if err := s.AddCron(ctx, "rescan", "@hourly", contracts.Job{UoW: "scan"}); err != nil {
+		t.Fatalf("AddCron error: %v", err)
+	}
+	fake.Advance(7 * time.Hour)
+	if _, err := s.Tick(ctx); err != nil {
+		t.Fatalf("Tick error: %v", err)
+	}
+	if got := bus.jobs(); !equal(got, []string{"past", "rescan@2024-01-02T00:00:00Z", "held"}) {
+		t.Fatalf("expected the hourly occurrence and the held job, got %v", got)
+	}
+}
+
+func TestSchedulerReplacesAndRemovesCronsAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	bus := &recordingBus{}
+
+	first, _ := New(bus, store, WithClock(fake))
+	if err := first.AddCron(ctx, "rescan", "0 6 * * *", contracts.Job{UoW: "scan"}); err != nil {
+		t.Fatalf("AddCron error: %v", err)
+	}
+	// Jobs that only look like occurrences are not the cron's to drop.
+	lookalike := fake.Now().Add(time.Hour)
+	store.Add(ctx, contracts.Job{JobID: "rescan@later", UoW: "scan", NotBefore: &lookalike})
+
+	// A new process with a changed spec drops the 06:00 occurrence it never knew about.
+	fake.Advance(time.Minute)
+	second, _ := New(bus, store, WithClock(fake))
+	if err := second.AddCron(ctx, "rescan", "@hourly", contracts.Job{UoW: "scan"}); err != nil {
+		t.Fatalf("AddCron error: %v", err)
+	}
+	jobs, _ := store.List(ctx, "rescan@")
+	if len(jobs) != 2 || jobs[0].JobID != "rescan@2024-01-02T00:00:00Z" || jobs[1].JobID != "rescan@later" {
+		t.Fatalf("unexpected held jobs: %+v", jobs)
+	}
+
+	// An occurrence that fell due while the scheduler was down still goes out once.
+	fake.Advance(time.Hour)
+	third, _ := New(bus, store, WithClock(fake))
+	if err := third.AddCron(ctx, "rescan", "@hourly", contracts.Job{UoW: "scan"}); err != nil {
+		t.Fatalf("AddCron error: %v", err)
+	}
+	if _, err := third.Tick(ctx); err != nil {
+		t.Fatalf("Tick error: %v", err)
+	}
+	if got := bus.jobs(); !equal(got, []string{"rescan@2024-01-02T00:00:00Z", "rescan@later"}) {
+		t.Fatalf("expected the missed occurrence and the lookalike, got %v", got)
+	}
+
+	if err := third.RemoveCron(ctx, "rescan"); err != nil {
+		t.Fatalf("RemoveCron error: %v", err)
+	}
+	if jobs, _ := store.List(ctx, "rescan@"); len(jobs) != 0 {
+		t.Fatalf("expected no held occurrences, got %+v", jobs)
+	}
+	fake.Advance(24 * time.Hour)
+	if n, err := third.Tick(ctx); err != nil || n != 0 {
+		t.Fatalf("expected a removed cron to stay quiet, got %d (%v)", n, err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the scheduler")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,159 @@
+// Package sql implements scheduler.Store on top of database/sql for SQLite and
+// Postgres, so delayed jobs and pending cron occurrences survive a restart.
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tendant/simple-process/internal/sqldialect"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/scheduler"
+)
+
+// Dialect selects the SQL flavour used by the store.
+type Dialect = sqldialect.Dialect
+
+// Supported dialects.
+const (
+	SQLite   = sqldialect.SQLite
+	Postgres = sqldialect.Postgres
+)
+
+// Store keeps delayed jobs in the sp_scheduled_jobs table. NotBefore is stored as
+// Unix nanoseconds so that both dialects order and compare it the same way.
+type Store struct {
+	db      *stdsql.DB
+	dialect Dialect
+}
+
+// New wraps an open database handle. Call Migrate to create the table.
+func New(db *stdsql.DB, dialect Dialect) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("database handle is required")
+	}
+	if err := dialect.Validate(); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, dialect: dialect}, nil
+}
+
+// Migrate creates the scheduled jobs table. It is safe to call on every start.
+func (s *Store) Migrate(ctx context.Context) error {
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS sp_scheduled_jobs (
+	job_id TEXT PRIMARY KEY,
+	not_before BIGINT NOT NULL,
+	job %s NOT NULL,
+	created_at %s NOT NULL
+)`, s.dialect.JSONType(), s.dialect.TimeType()),
+		`CREATE INDEX IF NOT EXISTS sp_scheduled_jobs_not_before ON sp_scheduled_jobs (not_before)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create scheduled jobs table: %w", err)
+		}
+	}
+	return nil
+}
+
+// Add holds a job with a NotBefore time, replacing any job with the same ID.
+func (s *Store) Add(ctx context.Context, job contracts.Job) error {
+	if job.JobID == "" {
+		return errors.New("job id is required")
+	}
+	if job.NotBefore == nil {
+		return errors.New("not before is required")
+	}
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("marshal job: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, s.dialect.Rebind(`INSERT INTO sp_scheduled_jobs (job_id, not_before, job, created_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (job_id) DO UPDATE SET not_before = excluded.not_before, job = excluded.job`),
+		job.JobID, job.NotBefore.UnixNano(), string(payload), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("hold job: %w", err)
+	}
+	return nil
+}
+
+// Due returns up to limit jobs whose NotBefore is not after now, earliest first.
+func (s *Store) Due(ctx context.Context, now time.Time, limit int) ([]contracts.Job, error) {
+	jobs, err := s.query(ctx, `WHERE not_before <= ? ORDER BY not_before, job_id LIMIT ?`, now.UnixNano(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("query due jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// List returns the jobs whose JobID starts with prefix, earliest first. The prefix
+// is compared with substr rather than LIKE, so it needs no escaping.
+func (s *Store) List(ctx context.Context, prefix string) ([]contracts.Job, error) {
+	jobs, err := s.query(ctx, `WHERE substr(job_id, 1, ?) = ? ORDER BY not_before, job_id`, utf8.RuneCountInString(prefix), prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (s *Store) query(ctx context.Context, clauses string, args ...interface{}) ([]contracts.Job, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(`SELECT job FROM sp_scheduled_jobs `+clauses), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []contracts.Job
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var job contracts.Job
+		if err := json.Unmarshal([]byte(raw), &job); err != nil {
+			return nil, fmt.Errorf("decode job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// Remove drops the jobs.
+func (s *Store) Remove(ctx context.Context, jobIDs ...string) error {
+	if len(jobIDs) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(jobIDs))
+	for _, id := range jobIDs {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(jobIDs)), ", ")
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(`DELETE FROM sp_scheduled_jobs WHERE job_id IN (`+placeholders+`)`), args...)
+	if err != nil {
+		return fmt.Errorf("remove jobs: %w", err)
+	}
+	return nil
+}
+
+// Next returns the earliest NotBefore held.
+func (s *Store) Next(ctx context.Context) (time.Time, bool, error) {
+	var next stdsql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT MIN(not_before) FROM sp_scheduled_jobs`).Scan(&next); err != nil {
+		return time.Time{}, false, fmt.Errorf("query next job: %w", err)
+	}
+	if !next.Valid {
+		return time.Time{}, false, nil
+	}
+	return time.Unix(0, next.Int64).UTC(), true, nil
+}
+
+var _ scheduler.Store = (*Store)(nil)
@@ -0,0 +1,102 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/contracts"
+	_ "modernc.org/sqlite"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := stdsql.Open("sqlite", filepath.Join(t.TempDir(), "scheduler.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := New(db, SQLite)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Migrate(context.Background()); err != nil {
+			t.Fatalf("Migrate error: %v", err)
+		}
+	}
+	return store
+}
+
+func TestStoreReturnsDueJobsInOrder(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time { t := base.Add(d); return &t }
+
+	if _, ok, err := store.Next(ctx); err != nil || ok {
+		t.Fatalf("Next on empty store = %v, %v", ok, err)
+	}
+	for _, job := range []contracts.Job{
+		{JobID: "late", UoW: "scan", NotBefore: at(time.Hour)},
+		{JobID: "b", UoW: "scan", NotBefore: at(2 * time.Minute)},
+		{JobID: "a", UoW: "scan", NotBefore: at(5 * time.Minute)},
+		{JobID: "a", UoW: "scan", NotBefore: at(time.Minute)},
+	} {
+		if err := store.Add(ctx, job); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+	if err := store.Add(ctx, contracts.Job{JobID: "now", UoW: "scan"}); err == nil {
+		t.Fatal("expected an error for a job without NotBefore")
+	}
+
+	next, ok, err := store.Next(ctx)
+	if err != nil || !ok || !next.Equal(base.Add(time.Minute)) {
+		t.Fatalf("Next = %v, %v, %v", next, ok, err)
+	}
+	due, err := store.Due(ctx, base.Add(10*time.Minute), 10)
+	if err != nil || len(due) != 2 || due[0].JobID != "a" || due[1].JobID != "b" {
+		t.Fatalf("Due = %+v, %v", due, err)
+	}
+	if !due[0].NotBefore.Equal(base.Add(time.Minute)) {
+		t.Fatalf("expected the replaced job, got %+v", due[0])
+	}
+
+	if err := store.Remove(ctx, "a", "b"); err != nil {
+		t.Fatalf("Remove error: %v", err)
+	}
+	if due, err := store.Due(ctx, base.Add(2*time.Hour), 10); err != nil || len(due) != 1 || due[0].JobID != "late" {
+		t.Fatalf("Due after Remove = %+v, %v", due, err)
+	}
+}
+
+func TestStoreListsJobsByPrefix(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time { t := base.Add(d); return &t }
+
+	for _, job := range []contracts.Job{
+		{JobID: "100%_off@2", UoW: "scan", NotBefore: at(2 * time.Hour)},
+		{JobID: "100%_off@1", UoW: "scan", NotBefore: at(time.Hour)},
+		{JobID: "100xyoff@1", UoW: "scan", NotBefore: at(time.Minute)},
+		{JobID: "ünïcode@1", UoW: "scan", NotBefore: at(time.Minute)},
+	} {
+		if err := store.Add(ctx, job); err != nil {
+			t.Fatalf("Add error: %v", err)
+		}
+	}
+
+	// LIKE wildcards in the prefix match literally.
+	jobs, err := store.List(ctx, "100%_off@")
+	if err != nil || len(jobs) != 2 || jobs[0].JobID != "100%_off@1" || jobs[1].JobID != "100%_off@2" {
+		t.Fatalf("List = %+v, %v", jobs, err)
+	}
+	if jobs, err := store.List(ctx, "ünïcode@"); err != nil || len(jobs) != 1 {
+		t.Fatalf("List = %+v, %v", jobs, err)
+	}
+}
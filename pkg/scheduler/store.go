@@ -0,0 +1,123 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// Store persists delayed jobs until they are due. Jobs are keyed by Job.JobID:
+// adding a job whose ID is already held replaces it.
+type Store interface {
+	// Add holds a job with a NotBefore time.
+	Add(ctx context.Context, job contracts.Job) error
+	// Due returns up to limit jobs whose NotBefore is not after now, earliest first.
+	Due(ctx context.Context, now time.Time, limit int) ([]contracts.Job, error)
+	// Remove drops the jobs, typically after they were published.
+	Remove(ctx context.Context, jobIDs ...string) error
+	// Next returns the earliest NotBefore held, and false when the store is empty.
+	Next(ctx context.Context) (time.Time, bool, error)
+	// List returns the jobs whose JobID starts with prefix, earliest first.
+	List(ctx context.Context, prefix string) ([]contracts.Job, error)
+}
+
+// MemoryStore is an in-memory Store for tests and examples.
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]contracts.Job
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]contracts.Job)}
+}
+
+// Add holds a job with a NotBefore time.
+func (s *MemoryStore) Add(ctx context.Context, job contracts.Job) error {
+	if job.JobID == "" {
+		return errors.New("job id is required")
+	}
+	if job.NotBefore == nil {
+		return errors.New("not before is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.JobID] = job
+	return nil
+}
+
+// Due returns up to limit jobs whose NotBefore is not after now, earliest first.
+func (s *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]contracts.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []contracts.Job
+	for _, job := range s.jobs {
+		if !job.NotBefore.After(now) {
+			due = append(due, job)
+		}
+	}
+	sortJobs(due)
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Remove drops the jobs.
+func (s *MemoryStore) Remove(ctx context.Context, jobIDs ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range jobIDs {
+		delete(s.jobs, id)
+	}
+	return nil
+}
+
+// Next returns the earliest NotBefore held.
+func (s *MemoryStore) Next(ctx context.Context) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, job := range s.jobs {
+		if next.IsZero() || job.NotBefore.Before(next) {
+			next = *job.NotBefore
+		}
+	}
+	return next, !next.IsZero(), nil
+}
+
+// List returns the jobs whose JobID starts with prefix, earliest first.
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]contracts.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []contracts.Job
+	for id, job := range s.jobs {
+		if strings.HasPrefix(id, prefix) {
+			jobs = append(jobs, job)
+		}
+	}
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+// sortJobs orders jobs by NotBefore, then JobID.
+func sortJobs(jobs []contracts.Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].NotBefore.Equal(*jobs[j].NotBefore) {
+			return jobs[i].NotBefore.Before(*jobs[j].NotBefore)
+		}
+		return jobs[i].JobID < jobs[j].JobID
+	})
+}
+
+var _ Store = (*MemoryStore)(nil)
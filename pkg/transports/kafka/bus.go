@@ -0,0 +1,167 @@
+//go:build kafka
+
+// Package kafka carries jobs over Kafka topics as binary-mode CloudEvents: the
+// envelope attributes travel as ce_* headers and the message value is the job JSON.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// CloudEvents Kafka protocol binding header names.
+const (
+	headerSpecVersion = "ce_specversion"
+	headerType        = "ce_type"
+	headerSource      = "ce_source"
+	headerID          = "ce_id"
+	headerTime        = "ce_time"
+	headerPriority    = "ce_priority"
+	headerContentType = "content-type"
+)
+
+// PartitionKey derives the message key for a job. Jobs with the same key land on
+// the same partition and are therefore consumed in publish order.
+type PartitionKey func(contracts.Job) string
+
+// ByFile keys messages by File.ID so all jobs for one file stay ordered.
+func ByFile(job contracts.Job) string {
+	return job.File.ID
+}
+
+// ByTenant keys messages by File.TenantID, falling back to File.ID for untenanted files.
+func ByTenant(job contracts.Job) string {
+	if job.File.TenantID != "" {
+		return job.File.TenantID
+	}
+	return job.File.ID
+}
+
+// Bus publishes Jobs to a Kafka topic so remote workers can execute them.
+type Bus struct {
+	writer *kafkago.Writer
+	source string
+	key    PartitionKey
+}
+
+// BusOption customises a Bus.
+type BusOption func(*Bus)
+
+// WithPartitionKey overrides how messages are keyed; the default is ByFile.
+func WithPartitionKey(key PartitionKey) BusOption {
+	return func(b *Bus) { b.key = key }
+}
+
+// NewBus creates a Bus writing to topic on the given brokers. Call Close when done.
+func NewBus(brokers []string, topic, source string, opts ...BusOption) (*Bus, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("at least one broker is required")
+	}
+	if topic == "" {
+		return nil, errors.New("topic is required")
+	}
+	if source == "" {
+		source = "simple-process/kafka"
+	}
+
+	b := &Bus{source: source, key: ByFile}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.key == nil {
+		return nil, errors.New("partition key is required")
+	}
+
+	b.writer = &kafkago.Writer{
+		Addr:  kafkago.TCP(brokers...),
+		Topic: topic,
+		// Murmur2 matches the Java client's default partitioner, so mixed producers agree.
+		Balancer:     &kafkago.Murmur2Balancer{},
+		RequiredAcks: kafkago.RequireAll,
+	}
+	return b, nil
+}
+
+// Publish wraps the job in a CloudEvent and writes it synchronously.
+func (b *Bus) Publish(ctx context.Context, job contracts.Job) error {
+	event, err := contracts.NewJobCloudEvent(b.source, job)
+	if err != nil {
+		return err
+	}
+
+	msg := encodeMessage(event)
+	msg.Key = []byte(b.key(job))
+	if err := b.writer.WriteMessages(ctx, msg); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+	return nil
+}
+
+// Topic exposes the Kafka topic used for publishing jobs.
+func (b *Bus) Topic() string {
+	return b.writer.Topic
+}
+
+// Close flushes pending writes and releases the writer's connections.
+func (b *Bus) Close() error {
+	return b.writer.Close()
+}
+
+func encodeMessage(event contracts.CloudEvent) kafkago.Message {
+	msg := kafkago.Message{
+		Value: event.Data,
+		Headers: []kafkago.Header{
+			{Key: headerSpecVersion, Value: []byte(event.SpecVersion)},
+			{Key: headerType, Value: []byte(event.Type)},
+			{Key: headerSource, Value: []byte(event.Source)},
+			{Key: headerID, Value: []byte(event.ID)},
+			{Key: headerTime, Value: []byte(event.Time.Format(time.RFC3339Nano))},
+			{Key: headerContentType, Value: []byte(event.DataContentType)},
+		},
+	}
+	// Extension attributes are only sent when set, like their omitempty JSON form.
+	if event.Priority != 0 {
+		msg.Headers = append(msg.Headers, kafkago.Header{Key: headerPriority, Value: []byte(strconv.Itoa(event.Priority))})
+	}
+	return msg
+}
+
+func decodeMessage(msg kafkago.Message) (contracts.CloudEvent, error) {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	if headers[headerSpecVersion] == "" {
+		return contracts.CloudEvent{}, errors.New("missing ce_specversion header")
+	}
+
+	event := contracts.CloudEvent{
+		SpecVersion:     headers[headerSpecVersion],
+		Type:            headers[headerType],
+		Source:          headers[headerSource],
+		ID:              headers[headerID],
+		DataContentType: headers[headerContentType],
+		Data:            msg.Value,
+	}
+	if raw := headers[headerTime]; raw != "" {
+		t, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return contracts.CloudEvent{}, fmt.Errorf("parse ce_time: %w", err)
+		}
+		event.Time = t
+	}
+	if raw := headers[headerPriority]; raw != "" {
+		priority, err := strconv.Atoi(raw)
+		if err != nil {
+			return contracts.CloudEvent{}, fmt.Errorf("parse ce_priority: %w", err)
+		}
+		event.Priority = priority
+	}
+	return event, nil
+}
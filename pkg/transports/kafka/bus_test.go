@@ -0,0 +1,96 @@
+//go:build kafka
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+func TestBinaryModeRoundTrip(t *testing.T) {
+	job := contracts.Job{JobID: "j1", UoW: "hash", File: contracts.File{ID: "f1", TenantID: "t1"}}
+	event, err := contracts.NewJobCloudEvent("simple-process/test", job)
+	if err != nil {
+		t.Fatalf("NewJobCloudEvent error: %v", err)
+	}
+
+	msg := encodeMessage(event)
+	if string(msg.Value) != string(event.Data) {
+		t.Fatalf("expected the message value to be the bare job JSON, got %s", msg.Value)
+	}
+
+	decoded, err := decodeMessage(msg)
+	if err != nil {
+		t.Fatalf("decodeMessage error: %v", err)
+	}
+	if decoded.ID != "j1" || decoded.Source != "simple-process/test" || !decoded.Time.Equal(event.Time) {
+		t.Fatalf("unexpected event: %+v", decoded)
+	}
+	got, err := decoded.DecodeJob()
+	if err != nil || got.File.ID != "f1" {
+		t.Fatalf("unexpected job: %+v (%v)", got, err)
+	}
+
+	msg.Headers = nil
+	if _, err := decodeMessage(msg); err == nil {
+		t.Fatalf("expected an error for a message without CloudEvents headers")
+	}
+}
+
+func TestPriorityHeaderRoundTrip(t *testing.T) {
+	event, err := contracts.NewJobCloudEvent("simple-process/test", contracts.Job{JobID: "j1", UoW: "hash", Priority: 7})
+	if err != nil {
+		t.Fatalf("NewJobCloudEvent error: %v", err)
+	}
+
+	msg := encodeMessage(event)
+	var header string
+	for _, h := range msg.Headers {
+		if h.Key == "ce_priority" {
+			header = string(h.Value)
+		}
+	}
+	if header != "7" {
+		t.Fatalf("expected a ce_priority header of 7, got %q", header)
+	}
+	decoded, err := decodeMessage(msg)
+	if err != nil || decoded.Priority != 7 {
+		t.Fatalf("unexpected priority: %d (%v)", decoded.Priority, err)
+	}
+
+	// A priority carried only by the header still reaches the job.
+	msg.Value = []byte(`{"job_id":"j1","uow":"hash"}`)
+	decoded, _ = decodeMessage(msg)
+	if job, err := decoded.DecodeJob(); err != nil || job.Priority != 7 {
+		t.Fatalf("unexpected job: %+v (%v)", job, err)
+	}
+
+	plain, _ := contracts.NewJobCloudEvent("simple-process/test", contracts.Job{JobID: "j2", UoW: "hash"})
+	for _, h := range encodeMessage(plain).Headers {
+		if h.Key == "ce_priority" {
+			t.Fatalf("expected no ce_priority header for the default priority")
+		}
+	}
+
+	msg = encodeMessage(event)
+	for i := range msg.Headers {
+		if msg.Headers[i].Key == "ce_priority" {
+			msg.Headers[i].Value = []byte("high")
+		}
+	}
+	if _, err := decodeMessage(msg); err == nil {
+		t.Fatalf("expected an error for a malformed ce_priority header")
+	}
+}
+
+func TestPartitionKeys(t *testing.T) {
+	job := contracts.Job{File: contracts.File{ID: "f1", TenantID: "t1"}}
+	if ByFile(job) != "f1" || ByTenant(job) != "t1" {
+		t.Fatalf("unexpected keys: %q %q", ByFile(job), ByTenant(job))
+	}
+	job.File.TenantID = ""
+	if ByTenant(job) != "f1" {
+		t.Fatalf("expected ByTenant to fall back to the file id, got %q", ByTenant(job))
+	}
+}
@@ -0,0 +1,85 @@
+//go:build kafka && integration
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// testBrokers returns KAFKA_BROKERS, defaulting to a local single-node broker, and
+// skips the test when none is reachable.
+func testBrokers(t *testing.T) []string {
+	t.Helper()
+	brokers := []string{"localhost:9092"}
+	if env := os.Getenv("KAFKA_BROKERS"); env != "" {
+		brokers = strings.Split(env, ",")
+	}
+	conn, err := kafkago.Dial("tcp", brokers[0])
+	if err != nil {
+		t.Skipf("skipping: unable to connect to kafka (%v)", err)
+	}
+	conn.Close()
+	return brokers
+}
+
+func TestWorkerPreservesPerFileOrder(t *testing.T) {
+	topic := fmt.Sprintf("test-jobs-%d", time.Now().UnixNano())
+	brokers := testBrokers(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	bus, err := NewBus(brokers, topic, "simple-process/test")
+	if err != nil {
+		t.Fatalf("NewBus error: %v", err)
+	}
+	defer bus.Close()
+
+	var want []string
+	for i := 0; i < 3; i++ {
+		for _, file := range []string{"a", "b"} {
+			job := contracts.Job{JobID: fmt.Sprintf("%s-%d", file, i), File: contracts.File{ID: file}}
+			if err := bus.Publish(ctx, job); err != nil {
+				t.Fatalf("Publish error: %v", err)
+			}
+			want = append(want, job.JobID)
+		}
+	}
+
+	var (
+		mu     sync.Mutex
+		seen   = map[string][]string{}
+		total  int
+		failed bool
+	)
+	err = RunWorker(ctx, WorkerConfig{Brokers: brokers, Topic: topic, GroupID: "test", RetryDelay: 10 * time.Millisecond}, func(_ context.Context, job contracts.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if job.JobID == "a-1" && !failed {
+			failed = true
+			return errors.New("transient")
+		}
+		seen[job.File.ID] = append(seen[job.File.ID], job.JobID)
+		if total++; total == len(want) {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunWorker error: %v", err)
+	}
+
+	if fmt.Sprint(seen["a"]) != "[a-0 a-1 a-2]" || fmt.Sprint(seen["b"]) != "[b-0 b-1 b-2]" {
+		t.Fatalf("expected per-file order to be preserved, got %v", seen)
+	}
+}
@@ -0,0 +1,169 @@
+//go:build kafka
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/adapters/bus"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// WorkerHandler processes a job consumed from Kafka. The message offset is
+// committed only after it returns nil, so handlers should apply the job's result
+// (for example with metadata.ApplyResult) before returning.
+type WorkerHandler func(context.Context, contracts.Job) error
+
+// WorkerConfig describes how a worker joins a topic's consumer group.
+type WorkerConfig struct {
+	Brokers []string
+	Topic   string
+	// GroupID defaults to "simple-process-workers".
+	GroupID string
+	// MaxAttempts bounds how often a failing job is retried in place before it is
+	// skipped; retrying in place keeps later jobs for the same key in order. Defaults to 5.
+	MaxAttempts int
+	// RetryDelay is the pause between attempts; defaults to one second.
+	RetryDelay time.Duration
+}
+
+func (c *WorkerConfig) validate() error {
+	if len(c.Brokers) == 0 {
+		return errors.New("at least one broker is required")
+	}
+	if c.Topic == "" {
+		return errors.New("topic is required")
+	}
+	if c.GroupID == "" {
+		c.GroupID = "simple-process-workers"
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = time.Second
+	}
+	return nil
+}
+
+// RunWorker consumes jobs from the topic's consumer group until ctx is cancelled,
+// committing each offset manually once the handler succeeds.
+func RunWorker(ctx context.Context, cfg WorkerConfig, handler WorkerHandler) error {
+	if handler == nil {
+		return errors.New("handler is required")
+	}
+	return run(ctx, cfg, func(ctx context.Context, msg adapters.Message) error {
+		return handler(ctx, msg.Job())
+	})
+}
+
+// Subscriber adapts Kafka consumer groups to adapters.Subscriber. Ack lets the
+// offset be committed; Nack retries the message in place after RetryDelay until
+// MaxAttempts, after which it is skipped.
+type Subscriber struct {
+	cfg WorkerConfig
+}
+
+// NewSubscriber creates a Subscriber. cfg supplies the brokers and retry tuning;
+// its Topic and GroupID are replaced by the arguments to Subscribe.
+func NewSubscriber(cfg WorkerConfig) (*Subscriber, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("at least one broker is required")
+	}
+	return &Subscriber{cfg: cfg}, nil
+}
+
+// Subscribe consumes topic as a member of group until ctx is cancelled.
+func (s *Subscriber) Subscribe(ctx context.Context, topic, group string, handler adapters.MessageHandler) error {
+	if handler == nil {
+		return errors.New("handler is required")
+	}
+	cfg := s.cfg
+	cfg.Topic, cfg.GroupID = topic, group
+	return run(ctx, cfg, handler)
+}
+
+func run(ctx context.Context, cfg WorkerConfig, handler adapters.MessageHandler) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	reader := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers: cfg.Brokers,
+		Topic:   cfg.Topic,
+		GroupID: cfg.GroupID,
+		// A zero CommitInterval makes CommitMessages synchronous.
+		CommitInterval: 0,
+	})
+	defer reader.Close()
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("fetch message: %w", err)
+		}
+
+		if err := handle(ctx, cfg, msg, handler); err != nil {
+			if ctx.Err() != nil {
+				// Leave the offset uncommitted so the job is redelivered after a restart.
+				return nil
+			}
+			fmt.Printf("kafka worker: skipping message at %s/%d@%d: %v\n", msg.Topic, msg.Partition, msg.Offset, err)
+		}
+
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("commit offset: %w", err)
+		}
+	}
+}
+
+func handle(ctx context.Context, cfg WorkerConfig, msg kafkago.Message, handler adapters.MessageHandler) error {
+	event, err := decodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	job, err := event.DecodeJob()
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		nacked := false
+		m := bus.NewMessage(job, attempt, nil, func(context.Context) error {
+			nacked = true
+			return nil
+		})
+		err = bus.Dispatch(ctx, m, handler)
+		if !nacked {
+			return nil
+		}
+		if err == nil {
+			err = errors.New("nacked")
+		}
+		if attempt >= cfg.MaxAttempts {
+			return err
+		}
+		fmt.Printf("kafka worker: job %s attempt %d: %v\n", job.JobID, attempt, err)
+
+		timer := time.NewTimer(cfg.RetryDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+var _ adapters.Subscriber = (*Subscriber)(nil)
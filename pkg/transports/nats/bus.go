@@ -7,9 +7,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	natsclient "github.com/nats-io/nats.go"
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/adapters/bus"
 	"github.com/tendant/simple-process/pkg/contracts"
 )
 
@@ -90,20 +93,89 @@ func SubscribeWorker(conn *natsclient.Conn, subject, queue string, handler Worke
 	}
 
 	return conn.QueueSubscribe(subject, queue, func(msg *natsclient.Msg) {
-		var event contracts.CloudEvent
-		if err := json.Unmarshal(msg.Data, &event); err != nil {
-			fmt.Printf("nats worker: failed to decode event: %v\n", err)
+		job, err := decodeJob(msg)
+		if err != nil {
+			fmt.Printf("nats worker: %v\n", err)
 			return
 		}
 
-		job, err := event.DecodeJob()
+		if err := handler(context.Background(), job); err != nil {
+			fmt.Printf("nats worker: handler error: %v\n", err)
+		}
+	})
+}
+
+// attemptHeader carries the delivery attempt on messages republished by Nack.
+const attemptHeader = "Simple-Process-Attempt"
+
+// Subscriber adapts NATS queue subscriptions to adapters.Subscriber. Core NATS has
+// no acknowledgements, so Ack is a no-op and Nack republishes the message to its
+// subject for another queue member to pick up.
+type Subscriber struct {
+	conn *natsclient.Conn
+}
+
+// NewSubscriber wires an existing NATS connection into the adapters.Subscriber interface.
+func NewSubscriber(conn *natsclient.Conn) (*Subscriber, error) {
+	if conn == nil {
+		return nil, errors.New("nats connection is required")
+	}
+	return &Subscriber{conn: conn}, nil
+}
+
+// Subscribe joins the queue group for subject and delivers messages to handler
+// until ctx is cancelled, then drains the subscription.
+func (s *Subscriber) Subscribe(ctx context.Context, subject, group string, handler adapters.MessageHandler) error {
+	if subject == "" {
+		return errors.New("subject is required")
+	}
+	if handler == nil {
+		return errors.New("handler is required")
+	}
+	if group == "" {
+		group = "simple-process-workers"
+	}
+
+	sub, err := s.conn.QueueSubscribe(subject, group, func(msg *natsclient.Msg) {
+		job, err := decodeJob(msg)
 		if err != nil {
-			fmt.Printf("nats worker: failed to extract job: %v\n", err)
+			fmt.Printf("nats worker: %v\n", err)
 			return
 		}
 
-		if err := handler(context.Background(), job); err != nil {
+		attempt := 1
+		if n, err := strconv.Atoi(msg.Header.Get(attemptHeader)); err == nil && n > 0 {
+			attempt = n
+		}
+		m := bus.NewMessage(job, attempt, nil, func(context.Context) error {
+			retry := natsclient.NewMsg(msg.Subject)
+			retry.Data = msg.Data
+			retry.Header.Set(attemptHeader, strconv.Itoa(attempt+1))
+			return s.conn.PublishMsg(retry)
+		})
+		if err := bus.Dispatch(ctx, m, handler); err != nil {
 			fmt.Printf("nats worker: handler error: %v\n", err)
 		}
 	})
+	if err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	return sub.Drain()
+}
+
+func decodeJob(msg *natsclient.Msg) (contracts.Job, error) {
+	var event contracts.CloudEvent
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		return contracts.Job{}, fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	job, err := event.DecodeJob()
+	if err != nil {
+		return contracts.Job{}, fmt.Errorf("failed to extract job: %w", err)
+	}
+	return job, nil
 }
+
+var _ adapters.Subscriber = (*Subscriber)(nil)
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	natsclient "github.com/nats-io/nats.go"
+	"github.com/tendant/simple-process/pkg/adapters"
 	"github.com/tendant/simple-process/pkg/contracts"
 )
 
@@ -50,3 +51,48 @@ func TestBusPublishAndSubscribe(t *testing.T) {
 		t.Fatalf("timed out waiting for job: %v", ctx.Err())
 	}
 }
+
+func TestSubscriberRedeliversNackedMessages(t *testing.T) {
+	conn, err := natsclient.Connect(natsclient.DefaultURL)
+	if err != nil {
+		t.Skipf("skipping: unable to connect to NATS (%v)", err)
+	}
+	t.Cleanup(func() { conn.Drain() })
+
+	bus, err := NewBus(conn, "test.subscriber", "simple-process/test")
+	if err != nil {
+		t.Fatalf("NewBus error: %v", err)
+	}
+	sub, err := NewSubscriber(conn)
+	if err != nil {
+		t.Fatalf("NewSubscriber error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	attempts := make(chan int, 2)
+	done := make(chan error, 1)
+	go func() {
+		done <- sub.Subscribe(ctx, bus.Subject(), "test-group", func(_ context.Context, msg adapters.Message) error {
+			attempts <- msg.Attempt()
+			if msg.Attempt() == 1 {
+				return msg.Nack(ctx)
+			}
+			cancel()
+			return nil
+		})
+	}()
+	// Give the queue subscription time to register before publishing.
+	time.Sleep(100 * time.Millisecond)
+
+	if err := bus.Publish(ctx, contracts.Job{JobID: "nack"}); err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+	if first, second := <-attempts, <-attempts; first != 1 || second != 2 {
+		t.Fatalf("expected attempts 1 then 2, got %d and %d", first, second)
+	}
+}
@@ -0,0 +1,136 @@
+//go:build postgres
+
+// Package postgres turns a Postgres table into a job queue. Jobs are stored as
+// CloudEvents and claimed by workers with FOR UPDATE SKIP LOCKED, so services that
+// already run Postgres need no separate broker.
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// NotifyChannel is the LISTEN/NOTIFY channel used to wake idle workers.
+const NotifyChannel = "sp_jobs"
+
+const schema = `CREATE TABLE IF NOT EXISTS sp_jobs (
+	id BIGSERIAL PRIMARY KEY,
+	queue TEXT NOT NULL,
+	job_id TEXT NOT NULL,
+	event JSONB NOT NULL,
+	priority INTEGER NOT NULL DEFAULT 0,
+	run_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	locked_until TIMESTAMPTZ,
+	locked_by TEXT,
+	last_error TEXT,
+	failed_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS sp_jobs_ready ON sp_jobs (queue, priority DESC, run_at, id) WHERE failed_at IS NULL`
+
+// Migrate creates the queue table. It is safe to call on every start.
+func Migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	if pool == nil {
+		return errors.New("postgres pool is required")
+	}
+	if _, err := pool.Exec(ctx, schema); err != nil {
+		return fmt.Errorf("create queue table: %w", err)
+	}
+	return nil
+}
+
+// Bus enqueues Jobs into the sp_jobs table for workers to claim.
+type Bus struct {
+	pool   *pgxpool.Pool
+	queue  string
+	source string
+}
+
+// NewBus wires an existing connection pool into the adapters.Bus interface.
+func NewBus(pool *pgxpool.Pool, queue, source string) (*Bus, error) {
+	if pool == nil {
+		return nil, errors.New("postgres pool is required")
+	}
+	if queue == "" {
+		return nil, errors.New("queue is required")
+	}
+	if source == "" {
+		source = "simple-process/postgres"
+	}
+	return &Bus{pool: pool, queue: queue, source: source}, nil
+}
+
+// EnqueueOptions schedules and prioritises a job.
+type EnqueueOptions struct {
+	// RunAt delays the job until the given time; zero means the job's NotBefore, or immediately.
+	RunAt time.Time
+	// Priority orders ready jobs; higher values are claimed first. Zero means the job's Priority.
+	Priority int
+}
+
+// Publish enqueues the job at its own priority, to run at its NotBefore time or
+// immediately.
+func (b *Bus) Publish(ctx context.Context, job contracts.Job) error {
+	return b.Enqueue(ctx, job, EnqueueOptions{})
+}
+
+// PublishAt enqueues the job at its own priority, to run no earlier than at.
+func (b *Bus) PublishAt(ctx context.Context, job contracts.Job, at time.Time) error {
+	return b.Enqueue(ctx, job, EnqueueOptions{RunAt: at})
+}
+
+// Enqueue inserts the job as a CloudEvent and notifies idle workers.
+func (b *Bus) Enqueue(ctx context.Context, job contracts.Job, opts EnqueueOptions) error {
+	event, err := contracts.NewJobCloudEvent(b.source, job)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal cloudevent: %w", err)
+	}
+
+	runAt := opts.RunAt
+	if runAt.IsZero() && job.NotBefore != nil {
+		runAt = *job.NotBefore
+	}
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+	priority := opts.Priority
+	if priority == 0 {
+		priority = job.Priority
+	}
+
+	tx, err := b.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `INSERT INTO sp_jobs (queue, job_id, event, priority, run_at) VALUES ($1, $2, $3, $4, $5)`,
+		b.queue, job.JobID, payload, priority, runAt); err != nil {
+		return fmt.Errorf("enqueue job: %w", err)
+	}
+	// Notifications are delivered on commit, so workers never wake before the row is visible.
+	if _, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, NotifyChannel, b.queue); err != nil {
+		return fmt.Errorf("notify workers: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// Queue exposes the queue name used for publishing jobs.
+func (b *Bus) Queue() string {
+	return b.queue
+}
+
+var _ adapters.DelayingBus = (*Bus)(nil)
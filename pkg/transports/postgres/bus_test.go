@@ -0,0 +1,160 @@
+//go:build postgres && integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+func newTestPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		url = "postgres://postgres@localhost:5432/postgres?sslmode=disable"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, url)
+	if err == nil {
+		err = pool.Ping(ctx)
+	}
+	if err != nil {
+		t.Skipf("skipping: unable to connect to postgres (%v)", err)
+	}
+	t.Cleanup(pool.Close)
+
+	if err := Migrate(ctx, pool); err != nil {
+		t.Fatalf("Migrate error: %v", err)
+	}
+	return pool
+}
+
+func TestWorkerClaimsByPriorityAndRetries(t *testing.T) {
+	pool := newTestPool(t)
+	queue := fmt.Sprintf("test-%d", time.Now().UnixNano())
+
+	bus, err := NewBus(pool, queue, "simple-process/test")
+	if err != nil {
+		t.Fatalf("NewBus error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := bus.Enqueue(ctx, contracts.Job{JobID: "later"}, EnqueueOptions{RunAt: time.Now().Add(300 * time.Millisecond), Priority: 100}); err != nil {
+		t.Fatalf("Enqueue error: %v", err)
+	}
+	if err := bus.Enqueue(ctx, contracts.Job{JobID: "low"}, EnqueueOptions{Priority: 1}); err != nil {
+		t.Fatalf("Enqueue error: %v", err)
+	}
+	if err := bus.Enqueue(ctx, contracts.Job{JobID: "high"}, EnqueueOptions{Priority: 10}); err != nil {
+		t.Fatalf("Enqueue error: %v", err)
+	}
+	if err := bus.Publish(ctx, contracts.Job{JobID: "flaky"}); err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		order []string
+		tries int
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cfg := WorkerConfig{Queue: queue, Batch: 1, PollInterval: 50 * time.Millisecond, RetryDelay: 50 * time.Millisecond}
+		err := RunWorker(ctx, pool, cfg, func(_ context.Context, job contracts.Job) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if job.JobID == "flaky" {
+				tries++
+				if tries == 1 {
+					return errors.New("transient")
+				}
+			}
+			order = append(order, job.JobID)
+			if len(order) == 4 {
+				cancel()
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("RunWorker error: %v", err)
+		}
+	}()
+	<-done
+
+	want := []string{"high", "low", "flaky", "later"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %v", want, order)
+	}
+
+	var remaining int
+	if err := pool.QueryRow(context.Background(), `SELECT COUNT(*) FROM sp_jobs WHERE queue = $1`, queue).Scan(&remaining); err != nil {
+		t.Fatalf("count jobs: %v", err)
+	}
+	if remaining != 0 {
+		t.Fatalf("expected completed jobs to be deleted, %d remain", remaining)
+	}
+}
+
+func TestWorkersSkipBatchedJobsReclaimedAfterTheirLease(t *testing.T) {
+	pool := newTestPool(t)
+	queue := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	bus, _ := NewBus(pool, queue, "simple-process/test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 1; i <= 3; i++ {
+		if err := bus.Publish(ctx, contracts.Job{JobID: fmt.Sprintf("job-%d", i)}); err != nil {
+			t.Fatalf("Publish error: %v", err)
+		}
+	}
+
+	var (
+		mu   sync.Mutex
+		runs = map[string]int{}
+		wg   sync.WaitGroup
+	)
+	handler := func(_ context.Context, job contracts.Job) error {
+		mu.Lock()
+		runs[job.JobID]++
+		if len(runs) == 3 {
+			time.AfterFunc(time.Second, cancel)
+		}
+		mu.Unlock()
+		// Three jobs of 300ms outlive the 500ms lease of the batch that claimed them.
+		time.Sleep(300 * time.Millisecond)
+		return nil
+	}
+	for _, batch := range []int{3, 1} {
+		cfg := WorkerConfig{Queue: queue, Batch: batch, VisibilityTimeout: 500 * time.Millisecond, PollInterval: 50 * time.Millisecond}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			RunWorker(ctx, pool, cfg, handler)
+		}()
+		// Let the batching worker claim everything first.
+		time.Sleep(100 * time.Millisecond)
+	}
+	wg.Wait()
+
+	for id, n := range runs {
+		if n != 1 {
+			t.Fatalf("expected %s to run once, ran %d times", id, n)
+		}
+	}
+	if len(runs) != 3 {
+		t.Fatalf("expected 3 jobs to run, got %v", runs)
+	}
+}
@@ -0,0 +1,303 @@
+//go:build postgres
+
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/adapters/bus"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// WorkerHandler processes a job claimed from the queue. Returning an error
+// reschedules the job after RetryDelay until MaxAttempts is reached.
+type WorkerHandler func(context.Context, contracts.Job) error
+
+// WorkerConfig describes how a worker claims jobs from a queue.
+type WorkerConfig struct {
+	Queue string
+	// WorkerID is recorded in locked_by for debugging; defaults to "worker".
+	WorkerID string
+	// Batch bounds the jobs claimed per round trip; defaults to 10. Claimed jobs run
+	// one after another, so each lease is renewed as its job starts.
+	Batch int
+	// VisibilityTimeout is how long a started job stays hidden from other workers.
+	// Jobs whose worker crashed become claimable again afterwards; defaults to 5 minutes.
+	VisibilityTimeout time.Duration
+	// PollInterval bounds the wait between claims when no notification arrives; defaults to 5s.
+	PollInterval time.Duration
+	// MaxAttempts marks a job failed after that many unsuccessful runs; defaults to 5.
+	MaxAttempts int
+	// RetryDelay postpones a failed job before it is retried; defaults to 10s.
+	RetryDelay time.Duration
+}
+
+func (c *WorkerConfig) validate() error {
+	if c.Queue == "" {
+		return errors.New("queue is required")
+	}
+	if c.WorkerID == "" {
+		c.WorkerID = "worker"
+	}
+	if c.Batch <= 0 {
+		c.Batch = 10
+	}
+	if c.VisibilityTimeout <= 0 {
+		c.VisibilityTimeout = 5 * time.Minute
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = 5 * time.Second
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = 10 * time.Second
+	}
+	return nil
+}
+
+// claimed is a locked queue row; attempts fences completion against reclaims.
+type claimed struct {
+	id       int64
+	attempts int
+	event    []byte
+}
+
+// RunWorker claims and processes jobs until ctx is cancelled. Ready jobs are
+// claimed highest priority first with FOR UPDATE SKIP LOCKED, so any number of
+// workers can share a queue. Idle workers wake on LISTEN/NOTIFY and fall back to
+// polling every PollInterval.
+func RunWorker(ctx context.Context, pool *pgxpool.Pool, cfg WorkerConfig, handler WorkerHandler) error {
+	if pool == nil {
+		return errors.New("postgres pool is required")
+	}
+	if handler == nil {
+		return errors.New("handler is required")
+	}
+	return run(ctx, pool, cfg, func(ctx context.Context, msg adapters.Message) error {
+		return handler(ctx, msg.Job())
+	})
+}
+
+// Subscriber adapts a queue to adapters.Subscriber. Ack completes the job; Nack
+// reschedules it after RetryDelay, or marks it failed once MaxAttempts is reached.
+// A queue has a single implicit consumer group, so every subscriber competes for its jobs.
+type Subscriber struct {
+	pool *pgxpool.Pool
+	cfg  WorkerConfig
+}
+
+// NewSubscriber creates a Subscriber. cfg supplies the worker tuning; its Queue is
+// replaced by the topic passed to Subscribe.
+func NewSubscriber(pool *pgxpool.Pool, cfg WorkerConfig) (*Subscriber, error) {
+	if pool == nil {
+		return nil, errors.New("postgres pool is required")
+	}
+	return &Subscriber{pool: pool, cfg: cfg}, nil
+}
+
+// Subscribe processes jobs from queue until ctx is cancelled. group is ignored.
+func (s *Subscriber) Subscribe(ctx context.Context, queue, group string, handler adapters.MessageHandler) error {
+	if handler == nil {
+		return errors.New("handler is required")
+	}
+	cfg := s.cfg
+	cfg.Queue = queue
+	return run(ctx, s.pool, cfg, handler)
+}
+
+func run(ctx context.Context, pool *pgxpool.Pool, cfg WorkerConfig, handler adapters.MessageHandler) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	wake := make(chan struct{}, 1)
+	listenCtx, stopListening := context.WithCancel(ctx)
+	defer stopListening()
+	go listen(listenCtx, pool, cfg.Queue, wake)
+
+	for ctx.Err() == nil {
+		jobs, err := claim(ctx, pool, cfg)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return err
+		}
+		for _, c := range jobs {
+			process(ctx, pool, cfg, c, handler)
+		}
+		if len(jobs) == cfg.Batch {
+			continue
+		}
+
+		timer := time.NewTimer(cfg.PollInterval)
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	return nil
+}
+
+func claim(ctx context.Context, pool *pgxpool.Pool, cfg WorkerConfig) ([]claimed, error) {
+	rows, err := pool.Query(ctx, `UPDATE sp_jobs SET attempts = attempts + 1, locked_by = $2,
+	locked_until = now() + make_interval(secs => $3)
+WHERE id IN (
+	SELECT id FROM sp_jobs
+	WHERE queue = $1 AND failed_at IS NULL AND run_at <= now()
+		AND (locked_until IS NULL OR locked_until < now())
+	ORDER BY priority DESC, run_at, id
+	LIMIT $4
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, attempts, event`, cfg.Queue, cfg.WorkerID, cfg.VisibilityTimeout.Seconds(), cfg.Batch)
+	if err != nil {
+		return nil, fmt.Errorf("claim jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []claimed
+	for rows.Next() {
+		var c claimed
+		if err := rows.Scan(&c.id, &c.attempts, &c.event); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, c)
+	}
+	return jobs, rows.Err()
+}
+
+// lease renews the claim on c for a full VisibilityTimeout before it starts. It
+// reports false when the claim expired while earlier jobs of the batch ran and
+// another worker has since reclaimed the job.
+func lease(ctx context.Context, pool *pgxpool.Pool, cfg WorkerConfig, c claimed) (bool, error) {
+	tag, err := pool.Exec(ctx, `UPDATE sp_jobs SET locked_until = now() + make_interval(secs => $3)
+WHERE id = $1 AND attempts = $2`, c.id, c.attempts, cfg.VisibilityTimeout.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("renew lease: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func process(ctx context.Context, pool *pgxpool.Pool, cfg WorkerConfig, c claimed, handler adapters.MessageHandler) {
+	if ok, err := lease(ctx, pool, cfg, c); !ok {
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("postgres worker: job %d: %v\n", c.id, err)
+		}
+		return
+	}
+
+	var event contracts.CloudEvent
+	if err := json.Unmarshal(c.event, &event); err != nil {
+		fail(ctx, pool, c, fmt.Errorf("decode event: %w", err), time.Time{})
+		return
+	}
+	job, err := event.DecodeJob()
+	if err != nil {
+		fail(ctx, pool, c, err, time.Time{})
+		return
+	}
+
+	cause := errors.New("nacked")
+	msg := bus.NewMessage(job, c.attempts, func(ctx context.Context) error {
+		// The attempts check drops the completion if the visibility timeout expired and
+		// another worker reclaimed the job in the meantime.
+		_, err := pool.Exec(ctx, `DELETE FROM sp_jobs WHERE id = $1 AND attempts = $2`, c.id, c.attempts)
+		if err != nil {
+			fmt.Printf("postgres worker: complete job %d: %v\n", c.id, err)
+		}
+		return err
+	}, func(ctx context.Context) error {
+		retryAt := time.Now().Add(cfg.RetryDelay)
+		if c.attempts >= cfg.MaxAttempts {
+			retryAt = time.Time{}
+		}
+		fail(ctx, pool, c, cause, retryAt)
+		return nil
+	}).WithExtend(func(ctx context.Context) error {
+		ok, err := lease(ctx, pool, cfg, c)
+		if err == nil && !ok {
+			err = fmt.Errorf("job %d was reclaimed", c.id)
+		}
+		return err
+	})
+	// Both settlement callbacks log their own outcome, so the returned error adds nothing.
+	_ = bus.Dispatch(ctx, msg, func(ctx context.Context, msg adapters.Message) error {
+		err := handler(ctx, msg)
+		if err != nil {
+			cause = err
+		}
+		return err
+	})
+}
+
+// fail records the error and either reschedules the job at retryAt or, when retryAt
+// is zero, marks it permanently failed.
+func fail(ctx context.Context, pool *pgxpool.Pool, c claimed, cause error, retryAt time.Time) {
+	fmt.Printf("postgres worker: job %d: %v\n", c.id, cause)
+
+	var err error
+	if retryAt.IsZero() {
+		_, err = pool.Exec(ctx, `UPDATE sp_jobs SET locked_until = NULL, locked_by = NULL, last_error = $3, failed_at = now()
+WHERE id = $1 AND attempts = $2`, c.id, c.attempts, cause.Error())
+	} else {
+		_, err = pool.Exec(ctx, `UPDATE sp_jobs SET locked_until = NULL, locked_by = NULL, last_error = $3, run_at = $4
+WHERE id = $1 AND attempts = $2`, c.id, c.attempts, cause.Error(), retryAt)
+	}
+	if err != nil {
+		fmt.Printf("postgres worker: record failure for job %d: %v\n", c.id, err)
+	}
+}
+
+// listen forwards notifications for queue to wake until ctx is cancelled. Errors
+// are not fatal: the worker keeps polling and listening is retried after a pause.
+func listen(ctx context.Context, pool *pgxpool.Pool, queue string, wake chan<- struct{}) {
+	for ctx.Err() == nil {
+		if err := listenOnce(ctx, pool, queue, wake); err != nil && ctx.Err() == nil {
+			fmt.Printf("postgres worker: listen: %v\n", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+func listenOnce(ctx context.Context, pool *pgxpool.Pool, queue string, wake chan<- struct{}) error {
+	pooled, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// A connection interrupted mid-wait is in an unknown state, so never return it to the pool.
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+NotifyChannel); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if n.Payload != queue {
+			continue
+		}
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+var _ adapters.Subscriber = (*Subscriber)(nil)
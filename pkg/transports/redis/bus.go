@@ -0,0 +1,84 @@
+//go:build redis
+
+// Package redis carries jobs over Redis Streams. Jobs are appended to a stream as
+// CloudEvents and consumed by worker consumer groups with at-least-once delivery.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// eventField is the stream entry field holding the JSON CloudEvent.
+const eventField = "event"
+
+// Bus publishes Jobs to a Redis stream so remote workers can execute them.
+type Bus struct {
+	client goredis.UniversalClient
+	stream string
+	source string
+	maxLen int64
+}
+
+// BusOption customises a Bus.
+type BusOption func(*Bus)
+
+// WithMaxLen caps the stream at roughly n entries; older entries are trimmed on publish.
+func WithMaxLen(n int64) BusOption {
+	return func(b *Bus) { b.maxLen = n }
+}
+
+// NewBus wires an existing Redis client into the adapters.Bus interface.
+func NewBus(client goredis.UniversalClient, stream, source string, opts ...BusOption) (*Bus, error) {
+	if client == nil {
+		return nil, errors.New("redis client is required")
+	}
+	if stream == "" {
+		return nil, errors.New("stream is required")
+	}
+	if source == "" {
+		source = "simple-process/redis"
+	}
+	b := &Bus{client: client, stream: stream, source: source}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.maxLen < 0 {
+		return nil, errors.New("max length must not be negative")
+	}
+	return b, nil
+}
+
+// Publish wraps the job in a CloudEvent and appends it to the stream.
+func (b *Bus) Publish(ctx context.Context, job contracts.Job) error {
+	event, err := contracts.NewJobCloudEvent(b.source, job)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal cloudevent: %w", err)
+	}
+
+	args := &goredis.XAddArgs{
+		Stream: b.stream,
+		Values: map[string]interface{}{eventField: payload},
+	}
+	if b.maxLen > 0 {
+		// Approximate trimming lets Redis drop whole macro nodes, which is much cheaper.
+		args.MaxLen = b.maxLen
+		args.Approx = true
+	}
+	return b.client.XAdd(ctx, args).Err()
+}
+
+// Stream exposes the Redis stream used for publishing jobs.
+func (b *Bus) Stream() string {
+	return b.stream
+}
@@ -0,0 +1,161 @@
+//go:build redis
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// newTestClient connects to REDIS_ADDR when set and to an in-process stand-in otherwise.
+func newTestClient(t *testing.T) *goredis.Client {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = miniredis.RunT(t).Addr()
+	}
+	client := goredis.NewClient(&goredis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("skipping: unable to connect to redis (%v)", err)
+	}
+	return client
+}
+
+func TestWorkerReclaimsEntriesFromFailedConsumer(t *testing.T) {
+	client := newTestClient(t)
+	stream := fmt.Sprintf("test.jobs.%d", time.Now().UnixNano())
+	ctx := context.Background()
+
+	bus, err := NewBus(client, stream, "simple-process/test")
+	if err != nil {
+		t.Fatalf("NewBus error: %v", err)
+	}
+	for _, id := range []string{"ok-1", "flaky", "ok-2"} {
+		if err := bus.Publish(ctx, contracts.Job{JobID: id, UoW: "hash"}); err != nil {
+			t.Fatalf("Publish error: %v", err)
+		}
+	}
+
+	var (
+		mu   sync.Mutex
+		seen = map[string]string{}
+	)
+	run := func(consumer string, handler WorkerHandler) {
+		wctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		defer cancel()
+		cfg := WorkerConfig{Stream: stream, Group: "workers", Consumer: consumer, Block: 50 * time.Millisecond, MinIdle: 100 * time.Millisecond}
+		if err := RunWorker(wctx, client, cfg, handler); err != nil {
+			t.Fatalf("RunWorker error: %v", err)
+		}
+	}
+
+	run("a", func(_ context.Context, job contracts.Job) error {
+		if job.JobID == "flaky" {
+			return errors.New("worker crashed")
+		}
+		mu.Lock()
+		seen[job.JobID] = "a"
+		mu.Unlock()
+		return nil
+	})
+	run("b", func(_ context.Context, job contracts.Job) error {
+		mu.Lock()
+		seen[job.JobID] = "b"
+		mu.Unlock()
+		return nil
+	})
+
+	want := map[string]string{"ok-1": "a", "ok-2": "a", "flaky": "b"}
+	for id, consumer := range want {
+		if seen[id] != consumer {
+			t.Fatalf("expected %s to be handled by %s, got %v", id, consumer, seen)
+		}
+	}
+
+	pending, err := client.XPending(ctx, stream, "workers").Result()
+	if err != nil {
+		t.Fatalf("XPending error: %v", err)
+	}
+	if pending.Count != 0 {
+		t.Fatalf("expected no pending entries, got %d", pending.Count)
+	}
+}
+
+func TestSubscriberRedeliversNackedEntries(t *testing.T) {
+	client := newTestClient(t)
+	stream := fmt.Sprintf("test.subscribe.%d", time.Now().UnixNano())
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	bus, err := NewBus(client, stream, "")
+	if err != nil {
+		t.Fatalf("NewBus error: %v", err)
+	}
+	if err := bus.Publish(ctx, contracts.Job{JobID: "job-1"}); err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+
+	sub, err := NewSubscriber(client, WorkerConfig{Consumer: "a", Block: 50 * time.Millisecond, MinIdle: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewSubscriber error: %v", err)
+	}
+	var attempts []int
+	err = sub.Subscribe(ctx, stream, "workers", func(ctx context.Context, msg adapters.Message) error {
+		attempts = append(attempts, msg.Attempt())
+		if msg.Attempt() == 1 {
+			return msg.Nack(ctx)
+		}
+		cancel()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+	if len(attempts) != 2 || attempts[1] != 2 {
+		t.Fatalf("expected a second attempt after nack, got %v", attempts)
+	}
+
+	pending, err := client.XPending(context.Background(), stream, "workers").Result()
+	if err != nil {
+		t.Fatalf("XPending error: %v", err)
+	}
+	if pending.Count != 0 {
+		t.Fatalf("expected no pending entries, got %d", pending.Count)
+	}
+}
+
+func TestBusTrimsStream(t *testing.T) {
+	client := newTestClient(t)
+	stream := fmt.Sprintf("test.trim.%d", time.Now().UnixNano())
+	ctx := context.Background()
+
+	bus, err := NewBus(client, stream, "", WithMaxLen(10))
+	if err != nil {
+		t.Fatalf("NewBus error: %v", err)
+	}
+	for i := 0; i < 250; i++ {
+		if err := bus.Publish(ctx, contracts.Job{JobID: fmt.Sprint(i)}); err != nil {
+			t.Fatalf("Publish error: %v", err)
+		}
+	}
+
+	// Trimming is approximate, so only assert that the stream stayed well below what was published.
+	length, err := client.XLen(ctx, stream).Result()
+	if err != nil {
+		t.Fatalf("XLen error: %v", err)
+	}
+	if length >= 250 {
+		t.Fatalf("expected stream to be trimmed, got %d entries", length)
+	}
+}
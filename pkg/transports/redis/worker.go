@@ -0,0 +1,265 @@
+//go:build redis
+
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/adapters/bus"
+	"github.com/tendant/simple-process/pkg/contracts"
+)
+
+// WorkerHandler processes a job pulled from Redis. Returning an error leaves the
+// entry pending so it is redelivered once it has been idle for MinIdle.
+type WorkerHandler func(context.Context, contracts.Job) error
+
+// WorkerConfig describes how a worker joins a stream's consumer group.
+type WorkerConfig struct {
+	Stream string
+	// Group defaults to "simple-process-workers"; it is created on first use.
+	Group string
+	// Consumer must be unique per worker process.
+	Consumer string
+	// Count bounds the entries fetched per read; defaults to 10.
+	Count int64
+	// Block is how long a read waits for new entries; defaults to 2s.
+	Block time.Duration
+	// MinIdle is how long an entry stays pending before another consumer reclaims it
+	// with XAUTOCLAIM, e.g. after its worker crashed; defaults to one minute.
+	MinIdle time.Duration
+}
+
+func (c *WorkerConfig) validate() error {
+	if c.Stream == "" {
+		return errors.New("stream is required")
+	}
+	if c.Consumer == "" {
+		return errors.New("consumer name is required")
+	}
+	if c.Group == "" {
+		c.Group = "simple-process-workers"
+	}
+	if c.Count <= 0 {
+		c.Count = 10
+	}
+	if c.Block <= 0 {
+		c.Block = 2 * time.Second
+	}
+	if c.MinIdle <= 0 {
+		c.MinIdle = time.Minute
+	}
+	return nil
+}
+
+// RunWorker consumes jobs from the stream's consumer group until ctx is cancelled.
+// Entries are acknowledged with XACK only after the handler succeeds; entries left
+// pending by failed handlers or crashed workers are reclaimed with XAUTOCLAIM.
+func RunWorker(ctx context.Context, client goredis.UniversalClient, cfg WorkerConfig, handler WorkerHandler) error {
+	if client == nil {
+		return errors.New("redis client is required")
+	}
+	if handler == nil {
+		return errors.New("handler is required")
+	}
+	return run(ctx, client, cfg, func(ctx context.Context, msg adapters.Message) error {
+		return handler(ctx, msg.Job())
+	})
+}
+
+// Subscriber adapts Redis consumer groups to adapters.Subscriber. Ack issues XACK;
+// Nack leaves the entry pending so it is reclaimed once idle for MinIdle.
+type Subscriber struct {
+	client goredis.UniversalClient
+	cfg    WorkerConfig
+}
+
+// NewSubscriber creates a Subscriber. cfg supplies the consumer name and tuning;
+// its Stream and Group are replaced by the arguments to Subscribe.
+func NewSubscriber(client goredis.UniversalClient, cfg WorkerConfig) (*Subscriber, error) {
+	if client == nil {
+		return nil, errors.New("redis client is required")
+	}
+	if cfg.Consumer == "" {
+		return nil, errors.New("consumer name is required")
+	}
+	return &Subscriber{client: client, cfg: cfg}, nil
+}
+
+// Subscribe consumes stream as a member of group until ctx is cancelled.
+func (s *Subscriber) Subscribe(ctx context.Context, stream, group string, handler adapters.MessageHandler) error {
+	if handler == nil {
+		return errors.New("handler is required")
+	}
+	cfg := s.cfg
+	cfg.Stream, cfg.Group = stream, group
+	return run(ctx, s.client, cfg, handler)
+}
+
+func run(ctx context.Context, client goredis.UniversalClient, cfg WorkerConfig, handler adapters.MessageHandler) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	err := client.XGroupCreateMkStream(ctx, cfg.Stream, cfg.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create consumer group: %w", err)
+	}
+
+	w := &worker{client: client, cfg: cfg, handler: handler, cursor: "0-0"}
+	for ctx.Err() == nil {
+		if err := w.poll(ctx); err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type worker struct {
+	client  goredis.UniversalClient
+	cfg     WorkerConfig
+	handler adapters.MessageHandler
+	cursor  string
+}
+
+func (w *worker) poll(ctx context.Context) error {
+	claimed, next, err := w.client.XAutoClaim(ctx, &goredis.XAutoClaimArgs{
+		Stream:   w.cfg.Stream,
+		Group:    w.cfg.Group,
+		Consumer: w.cfg.Consumer,
+		MinIdle:  w.cfg.MinIdle,
+		Start:    w.cursor,
+		Count:    w.cfg.Count,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("reclaim pending entries: %w", err)
+	}
+	w.cursor = next
+	if len(claimed) > 0 {
+		deliveries, err := w.deliveries(ctx, claimed)
+		if err != nil {
+			return err
+		}
+		for _, msg := range claimed {
+			w.handle(ctx, msg, max(deliveries[msg.ID], 1))
+		}
+	}
+
+	streams, err := w.client.XReadGroup(ctx, &goredis.XReadGroupArgs{
+		Group:    w.cfg.Group,
+		Consumer: w.cfg.Consumer,
+		Streams:  []string{w.cfg.Stream, ">"},
+		Count:    w.cfg.Count,
+		Block:    w.cfg.Block,
+	}).Result()
+	if errors.Is(err, goredis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			w.handle(ctx, msg, 1)
+		}
+	}
+	return nil
+}
+
+func (w *worker) handle(ctx context.Context, msg goredis.XMessage, attempt int) {
+	job, err := decodeJob(msg)
+	if err != nil {
+		// Malformed entries can never succeed, so acknowledge them instead of reclaiming forever.
+		fmt.Printf("redis worker: dropping entry %s: %v\n", msg.ID, err)
+		w.ack(ctx, msg.ID)
+		return
+	}
+
+	m := bus.NewMessage(job, attempt, func(ctx context.Context) error {
+		return w.client.XAck(ctx, w.cfg.Stream, w.cfg.Group, msg.ID).Err()
+	}, nil).WithExtend(func(ctx context.Context) error {
+		return w.extend(ctx, msg.ID)
+	})
+	if err := bus.Dispatch(ctx, m, w.handler); err != nil {
+		fmt.Printf("redis worker: handler error: %v\n", err)
+	}
+}
+
+// extend resets the idle time of an entry this consumer still owns, so it is not
+// reclaimed after MinIdle while it waits to be handled.
+func (w *worker) extend(ctx context.Context, id string) error {
+	pending, err := w.client.XPendingExt(ctx, &goredis.XPendingExtArgs{
+		Stream:   w.cfg.Stream,
+		Group:    w.cfg.Group,
+		Start:    id,
+		End:      id,
+		Count:    1,
+		Consumer: w.cfg.Consumer,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("inspect pending entry: %w", err)
+	}
+	if len(pending) == 0 {
+		return fmt.Errorf("entry %s was reclaimed", id)
+	}
+	// JUSTID leaves the delivery count alone.
+	return w.client.XClaimJustID(ctx, &goredis.XClaimArgs{
+		Stream:   w.cfg.Stream,
+		Group:    w.cfg.Group,
+		Consumer: w.cfg.Consumer,
+		Messages: []string{id},
+	}).Err()
+}
+
+// deliveries looks up how often each reclaimed entry has been delivered.
+func (w *worker) deliveries(ctx context.Context, msgs []goredis.XMessage) (map[string]int, error) {
+	pending, err := w.client.XPendingExt(ctx, &goredis.XPendingExtArgs{
+		Stream:   w.cfg.Stream,
+		Group:    w.cfg.Group,
+		Start:    msgs[0].ID,
+		End:      msgs[len(msgs)-1].ID,
+		Count:    int64(len(msgs)),
+		Consumer: w.cfg.Consumer,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("inspect pending entries: %w", err)
+	}
+
+	counts := make(map[string]int, len(pending))
+	for _, p := range pending {
+		counts[p.ID] = int(p.RetryCount)
+	}
+	return counts, nil
+}
+
+func (w *worker) ack(ctx context.Context, id string) {
+	if err := w.client.XAck(ctx, w.cfg.Stream, w.cfg.Group, id).Err(); err != nil {
+		fmt.Printf("redis worker: ack %s: %v\n", id, err)
+	}
+}
+
+func decodeJob(msg goredis.XMessage) (contracts.Job, error) {
+	var payload []byte
+	switch v := msg.Values[eventField].(type) {
+	case string:
+		payload = []byte(v)
+	case []byte:
+		payload = v
+	default:
+		return contracts.Job{}, fmt.Errorf("missing %q field", eventField)
+	}
+
+	var event contracts.CloudEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return contracts.Job{}, fmt.Errorf("decode event: %w", err)
+	}
+	return event.DecodeJob()
+}
+
+var _ adapters.Subscriber = (*Subscriber)(nil)
@@ -0,0 +1,110 @@
+package uow
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry maps UoW names to implementations, so jobs and pipeline definitions
+// can refer to units of work by name.
+type Registry struct {
+	mu     sync.RWMutex
+	uows   map[string]UoW
+	limits map[string]Limits
+}
+
+// Limits bound how a worker runs the jobs of one UoW, e.g. one calling a
+// rate-limited service or a memory-hungry one. Jobs over a limit wait in the
+// worker instead of failing. Zero values mean no limit.
+type Limits struct {
+	// MaxConcurrency caps the UoW's jobs running at once.
+	MaxConcurrency int
+	// Rate caps how many jobs start per second, refilling a token bucket.
+	Rate float64
+	// Burst is the bucket size: how many jobs may start at once after a quiet
+	// period. It defaults to 1 when Rate is set.
+	Burst int
+	// Memory is the weight each job counts against the worker's memory budget,
+	// in whatever unit the budget uses, such as megabytes.
+	Memory int64
+}
+
+// RegisterOption customises a registration.
+type RegisterOption func(*registration)
+
+type registration struct {
+	limits Limits
+}
+
+// WithLimits attaches limits to the UoW, see worker.Config.Registry.
+func WithLimits(limits Limits) RegisterOption {
+	return func(r *registration) { r.limits = limits }
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{uows: make(map[string]UoW), limits: make(map[string]Limits)}
+}
+
+// Register adds u under name. Names must be unique.
+func (r *Registry) Register(name string, u UoW, opts ...RegisterOption) error {
+	if name == "" {
+		return errors.New("uow name is required")
+	}
+	if u == nil {
+		return errors.New("uow is required")
+	}
+	var reg registration
+	for _, opt := range opts {
+		opt(&reg)
+	}
+	l := reg.limits
+	if l.MaxConcurrency < 0 || l.Rate < 0 || l.Burst < 0 || l.Memory < 0 {
+		return fmt.Errorf("uow %q limits must not be negative", name)
+	}
+	if l.Rate > 0 && l.Burst == 0 {
+		reg.limits.Burst = 1
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.uows[name]; ok {
+		return fmt.Errorf("uow %q already registered", name)
+	}
+	r.uows[name] = u
+	r.limits[name] = reg.limits
+	return nil
+}
+
+// Limits returns the limits registered for name, which are zero when none were set.
+func (r *Registry) Limits(name string) Limits {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.limits[name]
+}
+
+// Lookup returns the UoW registered under name.
+func (r *Registry) Lookup(name string) (UoW, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.uows[name]
+	return u, ok
+}
+
+// Names returns the registered names in ascending order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.uows))
+	for name := range r.uows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
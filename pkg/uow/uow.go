@@ -14,3 +14,25 @@ type UoW interface {
 	Process(ctx context.Context, job contracts.Job) (*contracts.Result, error)
 }
 
+// Compensator is implemented by UoWs that can undo their effects, such as the
+// artifacts and attributes of a result, when a later step of the pipeline fails
+// permanently.
+type Compensator interface {
+	// Compensate reverts what the UoW did when it processed job into result.
+	Compensate(ctx context.Context, job contracts.Job, result contracts.Result) error
+}
+
+// Versioned is implemented by UoWs that declare the version of their
+// implementation. Results record it, so files processed by an older version can
+// be found and backfilled.
+type Versioned interface {
+	Version() string
+}
+
+// VersionOf returns the version u declares, or "" if it is not Versioned.
+func VersionOf(u UoW) string {
+	if v, ok := u.(Versioned); ok {
+		return v.Version()
+	}
+	return ""
+}
@@ -0,0 +1,479 @@
+// Package worker runs handlers for jobs taken from any adapters.Subscriber. A
+// Pool holds a window of delivered messages, runs a bounded number of them at
+// once and picks the next one by priority, then fairly across tenants, so one
+// tenant's burst cannot starve everyone else on a shared bus. Per-UoW limits
+// from a uow.Registry hold jobs back while their UoW is saturated.
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/clock"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/uow"
+)
+
+// TenantPolicy sets a tenant's share of a Pool.
+type TenantPolicy struct {
+	// Weight is the tenant's share relative to other tenants with waiting jobs; defaults to 1.
+	Weight float64
+	// MaxConcurrency caps the tenant's jobs running at once. Zero means no cap.
+	MaxConcurrency int
+}
+
+// Config describes how a Pool schedules jobs.
+type Config struct {
+	// Concurrency bounds the handlers running at once; defaults to 1.
+	Concurrency int
+	// Prefetch bounds the messages taken from the subscriber but not yet finished,
+	// whether running or waiting; defaults to twice Concurrency. Priorities,
+	// fairness and limits only apply among these messages, so it should exceed
+	// Concurrency. Each one is a subscription of its own on the transport, see
+	// Pool.Subscribe.
+	Prefetch int
+	// LeaseRenewal is how often the transport lease of a waiting message that
+	// implements adapters.ExtendableMessage is renewed; defaults to 30 seconds.
+	// Keep it well below the lease, such as VisibilityTimeout on Postgres or
+	// MinIdle on Redis.
+	LeaseRenewal time.Duration
+	// DefaultTenant applies to tenants missing from Tenants.
+	DefaultTenant TenantPolicy
+	// Tenants overrides the policy of individual tenants, keyed by File.TenantID.
+	Tenants map[string]TenantPolicy
+	// Registry supplies the uow.Limits of each job's UoW. Without it jobs are only
+	// bounded by Concurrency and the tenant policies.
+	Registry *uow.Registry
+	// MemoryBudget bounds the sum of the Memory limits of running jobs. Zero means
+	// no budget. A job weighing more than the whole budget runs alone.
+	MemoryBudget int64
+	// ObserveWait, when set, is called as each job starts with how long it waited
+	// in the pool, e.g. to feed a histogram.
+	ObserveWait func(job contracts.Job, wait time.Duration)
+	// Clock times rate limits and waits; defaults to the system clock.
+	Clock clock.Clock
+}
+
+func (c *Config) validate() error {
+	if c.Concurrency <= 0 {
+		c.Concurrency = 1
+	}
+	if c.Prefetch <= 0 {
+		c.Prefetch = 2 * c.Concurrency
+	}
+	if c.LeaseRenewal < 0 {
+		return errors.New("lease renewal must not be negative")
+	}
+	if c.LeaseRenewal == 0 {
+		c.LeaseRenewal = 30 * time.Second
+	}
+	if c.Prefetch < c.Concurrency {
+		return errors.New("prefetch must be at least the concurrency")
+	}
+	if c.DefaultTenant.Weight < 0 || c.DefaultTenant.MaxConcurrency < 0 {
+		return errors.New("default tenant policy must not be negative")
+	}
+	for tenant, policy := range c.Tenants {
+		if policy.Weight < 0 || policy.MaxConcurrency < 0 {
+			return errors.New("policy of tenant " + tenant + " must not be negative")
+		}
+	}
+	if c.MemoryBudget < 0 {
+		return errors.New("memory budget must not be negative")
+	}
+	if c.Clock == nil {
+		c.Clock = clock.Real{}
+	}
+	return nil
+}
+
+// Stats is a snapshot of a Pool.
+type Stats struct {
+	// Running is the number of handlers running.
+	Running int
+	// Waiting is the number of delivered messages waiting for a slot.
+	Waiting int
+	// Memory is the memory weight of the running jobs.
+	Memory int64
+	// UoWs breaks the counts down by UoW name.
+	UoWs map[string]UoWStats
+}
+
+// UoWStats describes the jobs of one UoW seen by a Pool.
+type UoWStats struct {
+	Running int
+	Waiting int
+	// Started counts the jobs started so far; TotalWait/Started is the mean wait.
+	Started   int64
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// Pool schedules the messages of a Subscriber. It implements adapters.Subscriber
+// itself, so it can wrap the MemoryBus or any transport subscriber.
+//
+// Jobs whose UoW is at its limits wait, and the pool runs the next job that may
+// run. Among those, higher Job.Priority runs first. Jobs of equal priority are
+// shared across tenants in proportion to their weights using start-time fair
+// queuing: each tenant is charged 1/weight per job started, and the tenant with
+// the least charge goes next. A tenant that was idle starts level with the others
+// rather than with credit for the time it did not use.
+type Pool struct {
+	sub adapters.Subscriber
+	cfg Config
+
+	mu      sync.Mutex
+	running int
+	waiting int
+	memory  int64
+	seq     uint64
+	// vtime is the start tag of the last job started; idle tenants rejoin at it.
+	vtime   float64
+	tenants map[string]*tenantState
+	uows    map[string]*uowState
+	// wakeAt is when the pending rate limit timer fires, if any.
+	wakeAt time.Time
+}
+
+type tenantState struct {
+	policy  TenantPolicy
+	waiting []*waiter
+	running int
+	// finish is the tenant's charge after its last started job.
+	finish float64
+}
+
+type uowState struct {
+	limits uow.Limits
+	tokens float64
+	filled time.Time
+	stats  UoWStats
+}
+
+type waiter struct {
+	job      contracts.Job
+	seq      uint64
+	enqueued time.Time
+	wait     time.Duration
+	ready    chan struct{}
+	started  bool
+}
+
+// NewPool creates a Pool taking messages from sub.
+func NewPool(sub adapters.Subscriber, cfg Config) (*Pool, error) {
+	if sub == nil {
+		return nil, errors.New("subscriber is required")
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &Pool{sub: sub, cfg: cfg, tenants: make(map[string]*tenantState), uows: make(map[string]*uowState)}, nil
+}
+
+// Subscribe runs Prefetch competing subscriptions to topic and group on the
+// wrapped subscriber, which must allow several subscribers in one group, as every
+// subscriber in this module does. Each delivered message waits in the pool until
+// it is scheduled and is then passed to handler and settled as usual. Messages
+// still waiting when ctx is cancelled are nacked, so the transport redelivers them.
+//
+// Every subscription costs what a separate worker would: a LISTEN connection on
+// Postgres and a group member on Kafka, where many members mean slow rebalances.
+// Waiting messages keep their lease through adapters.ExtendableMessage; one whose
+// lease cannot be renewed is nacked instead of run, since another consumer may
+// have it by now. Transports that fetch in batches, such as Postgres and Redis,
+// also hold the rest of a batch outside the pool, so fetch one message at a time.
+func (p *Pool) Subscribe(ctx context.Context, topic, group string, handler adapters.MessageHandler) error {
+	if handler == nil {
+		return errors.New("handler is required")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	schedule := func(ctx context.Context, msg adapters.Message) error {
+		return p.run(ctx, msg, handler)
+	}
+	errs := make(chan error, p.cfg.Prefetch)
+	for i := 0; i < p.cfg.Prefetch; i++ {
+		go func() { errs <- p.sub.Subscribe(ctx, topic, group, schedule) }()
+	}
+
+	var err error
+	for i := 0; i < p.cfg.Prefetch; i++ {
+		if subErr := <-errs; subErr != nil && err == nil {
+			err = subErr
+			cancel()
+		}
+	}
+	return err
+}
+
+// Stats returns the running and waiting jobs and the wait times per UoW.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := Stats{Running: p.running, Waiting: p.waiting, Memory: p.memory, UoWs: make(map[string]UoWStats, len(p.uows))}
+	for name, u := range p.uows {
+		stats.UoWs[name] = u.stats
+	}
+	return stats
+}
+
+func (p *Pool) run(ctx context.Context, msg adapters.Message, handler adapters.MessageHandler) error {
+	w, err := p.acquire(ctx, msg)
+	if err != nil {
+		return err
+	}
+	defer p.release(w)
+	if p.cfg.ObserveWait != nil {
+		p.cfg.ObserveWait(w.job, w.wait)
+	}
+	return handler(ctx, msg)
+}
+
+// acquire waits until the message is scheduled or ctx is done, renewing its lease
+// meanwhile.
+func (p *Pool) acquire(ctx context.Context, msg adapters.Message) (*waiter, error) {
+	job := msg.Job()
+	p.mu.Lock()
+	t := p.tenantLocked(job.File.TenantID)
+	p.uowLocked(job.UoW).stats.Waiting++
+	p.seq++
+	w := &waiter{job: job, seq: p.seq, enqueued: p.cfg.Clock.Now(), ready: make(chan struct{})}
+	// Keep each tenant's waiters ordered by priority, then arrival.
+	i := len(t.waiting)
+	for i > 0 && t.waiting[i-1].job.Priority < job.Priority {
+		i--
+	}
+	t.waiting = append(t.waiting, nil)
+	copy(t.waiting[i+1:], t.waiting[i:])
+	t.waiting[i] = w
+	p.waiting++
+	p.dispatchLocked()
+	started := w.started
+	p.mu.Unlock()
+	if started {
+		return w, nil
+	}
+
+	var renew <-chan time.Time
+	extendable, ok := msg.(adapters.ExtendableMessage)
+	if ok {
+		renew = p.cfg.Clock.After(p.cfg.LeaseRenewal)
+	}
+	var err error
+	for err == nil {
+		select {
+		case <-w.ready:
+			return w, nil
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-renew:
+			if extendErr := extendable.Extend(ctx); extendErr != nil {
+				err = fmt.Errorf("renew lease of job %s: %w", job.JobID, extendErr)
+			} else {
+				renew = p.cfg.Clock.After(p.cfg.LeaseRenewal)
+			}
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if w.started {
+		// Scheduled while giving up; give the slot back.
+		p.releaseLocked(w)
+		return nil, err
+	}
+	for i, other := range t.waiting {
+		if other == w {
+			t.waiting = append(t.waiting[:i], t.waiting[i+1:]...)
+			break
+		}
+	}
+	p.waiting--
+	p.uows[job.UoW].stats.Waiting--
+	p.forgetLocked(job.File.TenantID)
+	return nil, err
+}
+
+func (p *Pool) release(w *waiter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.releaseLocked(w)
+}
+
+func (p *Pool) releaseLocked(w *waiter) {
+	p.running--
+	p.memory -= p.uows[w.job.UoW].limits.Memory
+	p.uows[w.job.UoW].stats.Running--
+	p.tenants[w.job.File.TenantID].running--
+	p.forgetLocked(w.job.File.TenantID)
+	p.dispatchLocked()
+}
+
+// dispatchLocked starts waiting jobs while there are free slots.
+func (p *Pool) dispatchLocked() {
+	now := p.cfg.Clock.Now()
+	for p.running < p.cfg.Concurrency {
+		var (
+			next *tenantState
+			at   int
+		)
+		for _, t := range p.tenants {
+			if t.policy.MaxConcurrency > 0 && t.running >= t.policy.MaxConcurrency {
+				continue
+			}
+			i := p.runnableLocked(t, now)
+			if i < 0 {
+				continue
+			}
+			if next == nil || p.beforeLocked(t, t.waiting[i], next, next.waiting[at]) {
+				next, at = t, i
+			}
+		}
+		if next == nil {
+			p.wakeLocked(now)
+			return
+		}
+
+		w := next.waiting[at]
+		next.waiting = append(next.waiting[:at], next.waiting[at+1:]...)
+		start := p.startLocked(next)
+		next.finish = start + 1/next.policy.Weight
+		p.vtime = start
+		next.running++
+		p.running++
+		p.waiting--
+
+		u := p.uows[w.job.UoW]
+		if u.limits.Rate > 0 {
+			u.tokens--
+		}
+		p.memory += u.limits.Memory
+		w.wait = now.Sub(w.enqueued)
+		u.stats.Waiting--
+		u.stats.Running++
+		u.stats.Started++
+		u.stats.TotalWait += w.wait
+		u.stats.MaxWait = max(u.stats.MaxWait, w.wait)
+
+		w.started = true
+		close(w.ready)
+	}
+}
+
+// runnableLocked returns the index of the tenant's first waiter whose UoW is
+// within its limits, or -1.
+func (p *Pool) runnableLocked(t *tenantState, now time.Time) int {
+	for i, w := range t.waiting {
+		u := p.uows[w.job.UoW]
+		if u.limits.MaxConcurrency > 0 && u.stats.Running >= u.limits.MaxConcurrency {
+			continue
+		}
+		if u.limits.Rate > 0 && u.refill(now) < 1 {
+			continue
+		}
+		if p.cfg.MemoryBudget > 0 && p.memory > 0 && p.memory+u.limits.Memory > p.cfg.MemoryBudget {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// wakeLocked arms a timer for the earliest token a rate-limited waiter needs, as
+// nothing else would dispatch it.
+func (p *Pool) wakeLocked(now time.Time) {
+	var at time.Time
+	for _, u := range p.uows {
+		if u.stats.Waiting == 0 || u.limits.Rate <= 0 || u.tokens >= 1 {
+			continue
+		}
+		ready := now.Add(time.Duration((1 - u.tokens) / u.limits.Rate * float64(time.Second)))
+		if at.IsZero() || ready.Before(at) {
+			at = ready
+		}
+	}
+	if at.IsZero() || (!p.wakeAt.IsZero() && !at.Before(p.wakeAt)) {
+		return
+	}
+
+	p.wakeAt = at
+	fired := p.cfg.Clock.After(at.Sub(now))
+	go func() {
+		<-fired
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.wakeAt.Equal(at) {
+			p.wakeAt = time.Time{}
+		}
+		p.dispatchLocked()
+	}()
+}
+
+// refill tops up the token bucket for the time elapsed and returns the tokens.
+func (u *uowState) refill(now time.Time) float64 {
+	if elapsed := now.Sub(u.filled); elapsed > 0 {
+		u.tokens = min(float64(u.limits.Burst), u.tokens+elapsed.Seconds()*u.limits.Rate)
+		u.filled = now
+	}
+	return u.tokens
+}
+
+// beforeLocked reports whether waiter wa of tenant a should run before waiter wb of tenant b.
+func (p *Pool) beforeLocked(a *tenantState, wa *waiter, b *tenantState, wb *waiter) bool {
+	if wa.job.Priority != wb.job.Priority {
+		return wa.job.Priority > wb.job.Priority
+	}
+	if sa, sb := p.startLocked(a), p.startLocked(b); sa != sb {
+		return sa < sb
+	}
+	return wa.seq < wb.seq
+}
+
+func (p *Pool) startLocked(t *tenantState) float64 {
+	return max(p.vtime, t.finish)
+}
+
+func (p *Pool) tenantLocked(tenant string) *tenantState {
+	t, ok := p.tenants[tenant]
+	if !ok {
+		policy, ok := p.cfg.Tenants[tenant]
+		if !ok {
+			policy = p.cfg.DefaultTenant
+		}
+		if policy.Weight == 0 {
+			policy.Weight = 1
+		}
+		t = &tenantState{policy: policy}
+		p.tenants[tenant] = t
+	}
+	return t
+}
+
+func (p *Pool) uowLocked(name string) *uowState {
+	u, ok := p.uows[name]
+	if !ok {
+		u = &uowState{filled: p.cfg.Clock.Now()}
+		if p.cfg.Registry != nil {
+			u.limits = p.cfg.Registry.Limits(name)
+		}
+		u.tokens = float64(u.limits.Burst)
+		p.uows[name] = u
+	}
+	return u
+}
+
+// forgetLocked drops an idle tenant; it rejoins at the current virtual time.
+func (p *Pool) forgetLocked(tenant string) {
+	if t := p.tenants[tenant]; t != nil && t.running == 0 && len(t.waiting) == 0 {
+		delete(p.tenants, tenant)
+	}
+}
+
+var _ adapters.Subscriber = (*Pool)(nil)
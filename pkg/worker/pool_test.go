@@ -0,0 +1,311 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/adapters/bus"
+	"github.com/tendant/simple-process/pkg/clock"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/uow"
+)
+
+func tenantJob(tenant string, n, priority int) contracts.Job {
+	return contracts.Job{JobID: fmt.Sprintf("%s%d", tenant, n), UoW: "scan", Priority: priority, File: contracts.File{ID: "f", TenantID: tenant}}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the pool")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolSharesFairlyAcrossTenants(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	memory := bus.NewMemoryBus(64)
+	pool, err := NewPool(memory, Config{Concurrency: 1, Prefetch: 32})
+	if err != nil {
+		t.Fatalf("NewPool error: %v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	gate := make(chan struct{})
+	wg.Add(14)
+	done := make(chan error, 1)
+	go func() {
+		done <- pool.Subscribe(ctx, bus.DefaultTopic, "workers", func(ctx context.Context, msg adapters.Message) error {
+			defer wg.Done()
+			<-gate
+			mu.Lock()
+			order = append(order, msg.Job().File.TenantID)
+			mu.Unlock()
+			return nil
+		})
+	}()
+
+	// Tenant a floods the bus first; b and c arrive behind its backlog.
+	for i := 1; i <= 10; i++ {
+		memory.Publish(ctx, tenantJob("a", i, 0))
+	}
+	waitFor(t, func() bool { s := pool.Stats(); return s.Running == 1 && s.Waiting == 9 })
+	for i := 1; i <= 3; i++ {
+		memory.Publish(ctx, tenantJob("b", i, 0))
+	}
+	memory.Publish(ctx, tenantJob("c", 1, 5))
+	waitFor(t, func() bool { return pool.Stats().Waiting == 13 })
+	close(gate)
+	wg.Wait()
+
+	// c jumps the queue on priority, then b and a alternate until b runs out.
+	if got := strings.Join(order, ""); got != "acbababaaaaaaa" {
+		t.Fatalf("unexpected schedule %s", got)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+}
+
+func TestPoolCapsTenantConcurrency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	memory := bus.NewMemoryBus(64)
+	pool, _ := NewPool(memory, Config{Concurrency: 4, Tenants: map[string]TenantPolicy{"a": {MaxConcurrency: 1}}})
+
+	var (
+		mu              sync.Mutex
+		running, peak   map[string]int
+		total, maxTotal int
+		wg              sync.WaitGroup
+	)
+	running, peak = map[string]int{}, map[string]int{}
+	for i := 1; i <= 4; i++ {
+		memory.Publish(ctx, tenantJob("a", i, 0))
+		memory.Publish(ctx, tenantJob("b", i, 0))
+	}
+	wg.Add(8)
+	go pool.Subscribe(ctx, bus.DefaultTopic, "workers", func(ctx context.Context, msg adapters.Message) error {
+		defer wg.Done()
+		tenant := msg.Job().File.TenantID
+		mu.Lock()
+		running[tenant]++
+		total++
+		peak[tenant] = max(peak[tenant], running[tenant])
+		maxTotal = max(maxTotal, total)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running[tenant]--
+		total--
+		mu.Unlock()
+		return nil
+	})
+	wg.Wait()
+
+	if peak["a"] != 1 {
+		t.Fatalf("expected tenant a to be capped at 1, peaked at %d", peak["a"])
+	}
+	if maxTotal < 2 || maxTotal > 4 {
+		t.Fatalf("expected other tenants to use the spare slots, peaked at %d", maxTotal)
+	}
+}
+
+type noopUoW struct{}
+
+func (noopUoW) Process(ctx context.Context, job contracts.Job) (*contracts.Result, error) {
+	return &contracts.Result{JobID: job.JobID}, nil
+}
+
+func TestPoolHoldsJobsOverUoWLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry := uow.NewRegistry()
+	registry.Register("thumbnail", noopUoW{}, uow.WithLimits(uow.Limits{MaxConcurrency: 2}))
+	registry.Register("ocr", noopUoW{}, uow.WithLimits(uow.Limits{Memory: 2}))
+	registry.Register("hash", noopUoW{})
+	if err := registry.Register("bad", noopUoW{}, uow.WithLimits(uow.Limits{Rate: -1})); err == nil {
+		t.Fatal("expected negative limits to be rejected")
+	}
+
+	memory := bus.NewMemoryBus(64)
+	pool, _ := NewPool(memory, Config{Concurrency: 6, Registry: registry, MemoryBudget: 3})
+	var (
+		mu            sync.Mutex
+		running, peak = map[string]int{}, map[string]int{}
+		wg            sync.WaitGroup
+	)
+	for i := 1; i <= 4; i++ {
+		for _, name := range []string{"thumbnail", "ocr", "hash"} {
+			memory.Publish(ctx, contracts.Job{JobID: fmt.Sprintf("%s%d", name, i), UoW: name})
+		}
+	}
+	wg.Add(12)
+	go pool.Subscribe(ctx, bus.DefaultTopic, "workers", func(ctx context.Context, msg adapters.Message) error {
+		defer wg.Done()
+		name := msg.Job().UoW
+		mu.Lock()
+		running[name]++
+		peak[name] = max(peak[name], running[name])
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running[name]--
+		mu.Unlock()
+		return nil
+	})
+	wg.Wait()
+
+	if peak["thumbnail"] != 2 || peak["ocr"] != 1 || peak["hash"] < 2 {
+		t.Fatalf("unexpected peaks %v", peak)
+	}
+	if stats := pool.Stats().UoWs["ocr"]; stats.Started != 4 || stats.MaxWait <= 0 {
+		t.Fatalf("unexpected ocr stats %+v", stats)
+	}
+}
+
+func TestPoolRateLimitsUoWs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	registry := uow.NewRegistry()
+	registry.Register("geocode", noopUoW{}, uow.WithLimits(uow.Limits{Rate: 10, Burst: 2}))
+
+	var (
+		mu    sync.Mutex
+		waits []time.Duration
+	)
+	memory := bus.NewMemoryBus(64)
+	pool, _ := NewPool(memory, Config{Concurrency: 4, Registry: registry, Clock: fake, ObserveWait: func(job contracts.Job, wait time.Duration) {
+		mu.Lock()
+		waits = append(waits, wait)
+		mu.Unlock()
+	}})
+	for i := 1; i <= 5; i++ {
+		memory.Publish(ctx, contracts.Job{JobID: fmt.Sprintf("g%d", i), UoW: "geocode"})
+	}
+	go pool.Subscribe(ctx, bus.DefaultTopic, "workers", func(ctx context.Context, msg adapters.Message) error { return nil })
+
+	started := func(n int64) func() bool {
+		return func() bool { return pool.Stats().UoWs["geocode"].Started == n }
+	}
+	// The burst starts straight away; the rest wait for tokens instead of failing.
+	waitFor(t, started(2))
+	waitFor(t, func() bool { return pool.Stats().Waiting == 3 && fake.Waiters() == 1 })
+	fake.Advance(100 * time.Millisecond)
+	waitFor(t, started(3))
+	waitFor(t, func() bool { return fake.Waiters() == 1 })
+	fake.Advance(200 * time.Millisecond)
+	waitFor(t, started(5))
+
+	stats := pool.Stats().UoWs["geocode"]
+	if stats.MaxWait != 300*time.Millisecond || stats.TotalWait != 700*time.Millisecond {
+		t.Fatalf("unexpected wait stats %+v", stats)
+	}
+	waitFor(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(waits) == 5 })
+}
+
+// leasedSubscriber delivers jobs as messages whose lease extend renews.
+type leasedSubscriber struct {
+	jobs   chan contracts.Job
+	extend func(job contracts.Job) error
+
+	mu    sync.Mutex
+	nacks []string
+}
+
+func (s *leasedSubscriber) Subscribe(ctx context.Context, topic, group string, handler adapters.MessageHandler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case job := <-s.jobs:
+			nack := func(context.Context) error {
+				s.mu.Lock()
+				s.nacks = append(s.nacks, job.JobID)
+				s.mu.Unlock()
+				return nil
+			}
+			msg := bus.NewMessage(job, 1, nil, nack).WithExtend(func(context.Context) error { return s.extend(job) })
+			bus.Dispatch(ctx, msg, handler)
+		}
+	}
+}
+
+func TestPoolRenewsLeasesOfWaitingMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	var (
+		mu       sync.Mutex
+		extended []string
+		lost     bool
+	)
+	sub := &leasedSubscriber{jobs: make(chan contracts.Job, 2), extend: func(job contracts.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if lost {
+			return fmt.Errorf("job %s was reclaimed", job.JobID)
+		}
+		extended = append(extended, job.JobID)
+		return nil
+	}}
+	pool, err := NewPool(sub, Config{Concurrency: 1, Prefetch: 2, LeaseRenewal: 10 * time.Second, Clock: fake})
+	if err != nil {
+		t.Fatalf("NewPool error: %v", err)
+	}
+
+	gate := make(chan struct{})
+	var ran []string
+	go pool.Subscribe(ctx, bus.DefaultTopic, "workers", func(ctx context.Context, msg adapters.Message) error {
+		ran = append(ran, msg.Job().JobID)
+		<-gate
+		return nil
+	})
+	sub.jobs <- tenantJob("a", 1, 0)
+	waitFor(t, func() bool { return pool.Stats().Running == 1 })
+	sub.jobs <- tenantJob("a", 2, 0)
+	waitFor(t, func() bool { return pool.Stats().Waiting == 1 && fake.Waiters() == 1 })
+
+	// The waiting message keeps its lease for as long as it waits.
+	fake.Advance(10 * time.Second)
+	waitFor(t, func() bool { return fake.Waiters() == 1 })
+	fake.Advance(10 * time.Second)
+	waitFor(t, func() bool { return fake.Waiters() == 1 })
+	mu.Lock()
+	if strings.Join(extended, ",") != "a2,a2" {
+		t.Fatalf("expected two renewals of a2, got %v", extended)
+	}
+	lost = true
+	mu.Unlock()
+
+	// Once the lease is lost the message is given back instead of run.
+	fake.Advance(10 * time.Second)
+	waitFor(t, func() bool { return pool.Stats().Waiting == 0 })
+	close(gate)
+	waitFor(t, func() bool { return pool.Stats().Running == 0 })
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if strings.Join(sub.nacks, ",") != "a2" || strings.Join(ran, ",") != "a1" {
+		t.Fatalf("expected a2 nacked without running, got nacks %v and runs %v", sub.nacks, ran)
+	}
+}
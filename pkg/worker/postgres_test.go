@@ -0,0 +1,94 @@
+//go:build postgres && integration
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/contracts"
+	"github.com/tendant/simple-process/pkg/transports/postgres"
+)
+
+func TestPoolKeepsPostgresLeasesWhileWaiting(t *testing.T) {
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		url = "postgres://postgres@localhost:5432/postgres?sslmode=disable"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db, err := pgxpool.New(ctx, url)
+	if err == nil {
+		err = db.Ping(ctx)
+	}
+	if err != nil {
+		t.Skipf("skipping: unable to connect to postgres (%v)", err)
+	}
+	defer db.Close()
+	if err := postgres.Migrate(ctx, db); err != nil {
+		t.Fatalf("Migrate error: %v", err)
+	}
+
+	queue := fmt.Sprintf("pool-%d", time.Now().UnixNano())
+	publisher, err := postgres.NewBus(db, queue, "simple-process/test")
+	if err != nil {
+		t.Fatalf("NewBus error: %v", err)
+	}
+	// Waiting messages outlive the visibility timeout several times over.
+	cfg := postgres.WorkerConfig{Queue: queue, Batch: 1, VisibilityTimeout: time.Second, PollInterval: 100 * time.Millisecond}
+	sub, err := postgres.NewSubscriber(db, cfg)
+	if err != nil {
+		t.Fatalf("NewSubscriber error: %v", err)
+	}
+	pool, err := NewPool(sub, Config{Concurrency: 1, Prefetch: 2, LeaseRenewal: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewPool error: %v", err)
+	}
+
+	var (
+		mu   sync.Mutex
+		runs = map[string]int{}
+	)
+	record := func(who string) adapters.MessageHandler {
+		return func(ctx context.Context, msg adapters.Message) error {
+			mu.Lock()
+			runs[who+":"+msg.Job().JobID]++
+			mu.Unlock()
+			return nil
+		}
+	}
+	gate := make(chan struct{})
+	poolHandler := record("pool")
+	go pool.Subscribe(ctx, queue, "workers", func(ctx context.Context, msg adapters.Message) error {
+		<-gate
+		return poolHandler(ctx, msg)
+	})
+
+	for _, id := range []string{"j1", "j2"} {
+		if err := publisher.Publish(ctx, contracts.Job{JobID: id}); err != nil {
+			t.Fatalf("Publish error: %v", err)
+		}
+	}
+	waitFor(t, func() bool { s := pool.Stats(); return s.Running == 1 && s.Waiting == 1 })
+
+	// A competing worker must not reclaim the message waiting in the pool.
+	rival, _ := postgres.NewSubscriber(db, cfg)
+	go rival.Subscribe(ctx, queue, "workers", record("rival"))
+	time.Sleep(3 * time.Second)
+	close(gate)
+	waitFor(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(runs) == 2 })
+	time.Sleep(500 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(runs) != 2 || runs["pool:j1"] != 1 || runs["pool:j2"] != 1 {
+		t.Fatalf("expected the pool to run each job once, got %v", runs)
+	}
+}
@@ -3,22 +3,37 @@ package hash
 import (
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 
 	"github.com/tendant/simple-process/pkg/adapters"
+	"github.com/tendant/simple-process/pkg/adapters/storage"
 	"github.com/tendant/simple-process/pkg/contracts"
 )
 
 // HashUoW is a UoW that calculates the SHA256 hash of a file.
+// Without a Storage adapter it reads through Job.PresignedGet and writes its
+// artifact through Job.ArtifactUpload, so it can run on credential-less workers.
 type HashUoW struct {
 	Storage adapters.Storage
+	// Metadata, when set, lets the UoW skip files that already carry a sha256 attribute.
+	Metadata adapters.MetadataReader
 }
 
 // Process executes the hash calculation.
 func (u *HashUoW) Process(ctx context.Context, job contracts.Job) (*contracts.Result, error) {
-	reader, err := u.Storage.Get(ctx, job.File.Blob.Location)
+	if existing, ok := u.existingHash(ctx, job.File.ID); ok {
+		return &contracts.Result{
+			JobID:           job.JobID,
+			UoW:             job.UoW,
+			FileID:          job.File.ID,
+			AttributesPatch: map[string]interface{}{"sha256": existing},
+		}, nil
+	}
+
+	reader, err := storage.OpenJobBlob(ctx, u.Storage, job)
 	if err != nil {
 		return nil, err
 	}
@@ -32,8 +47,18 @@ func (u *HashUoW) Process(ctx context.Context, job contracts.Job) (*contracts.Re
 	sha256sum := fmt.Sprintf("%x", h.Sum(nil))
 
 	artifactLocation := fmt.Sprintf("artifacts/%s.sha256", job.File.ID)
-	if err := u.Storage.Put(ctx, artifactLocation, strings.NewReader(sha256sum)); err != nil {
-		return nil, err
+	switch {
+	case u.Storage != nil:
+		if err := u.Storage.Put(ctx, artifactLocation, strings.NewReader(sha256sum)); err != nil {
+			return nil, err
+		}
+	case job.ArtifactUpload != nil:
+		artifactLocation, err = storage.UploadArtifact(ctx, nil, *job.ArtifactUpload, job.File.ID+".sha256", strings.NewReader(sha256sum))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("hash: no storage adapter or artifact upload to write the checksum")
 	}
 
 	return &contracts.Result{
@@ -49,7 +74,20 @@ func (u *HashUoW) Process(ctx context.Context, job contracts.Job) (*contracts.Re
 				MIME:     "text/plain",
 				Bytes:    int64(len(sha256sum)),
 				Location: artifactLocation,
+				Checksum: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(sha256sum))),
 			},
 		},
 	}, nil
 }
+
+func (u *HashUoW) existingHash(ctx context.Context, fileID string) (string, bool) {
+	if u.Metadata == nil {
+		return "", false
+	}
+	attrs, err := u.Metadata.GetFileAttributes(ctx, fileID)
+	if err != nil {
+		return "", false
+	}
+	sum, ok := attrs["sha256"].(string)
+	return sum, ok && sum != ""
+}